@@ -15,6 +15,8 @@ type AttemptStrategy struct {
 
 type Attempt struct {
 	strategy AttemptStrategy
+	now      func() time.Time
+	sleep    func(time.Duration)
 	last     time.Time
 	end      time.Time
 	force    bool
@@ -23,11 +25,20 @@ type Attempt struct {
 
 // Start begins a new sequence of attempts for the given strategy.
 func (s AttemptStrategy) Start() *Attempt {
-	now := time.Now()
+	return s.StartClock(time.Now, time.Sleep)
+}
+
+// StartClock is like Start, but the attempts tell the time with now and
+// wait with sleep rather than with time.Now and time.Sleep, so that
+// they can follow a fake clock.
+func (s AttemptStrategy) StartClock(now func() time.Time, sleep func(time.Duration)) *Attempt {
+	t := now()
 	return &Attempt{
 		strategy: s,
-		last:     now,
-		end:      now.Add(s.Total),
+		now:      now,
+		sleep:    sleep,
+		last:     t,
+		end:      t.Add(s.Total),
 		force:    true,
 	}
 }
@@ -35,15 +46,15 @@ func (s AttemptStrategy) Start() *Attempt {
 // Next waits until it is time to perform the next attempt or returns
 // false if it is time to stop trying.
 func (a *Attempt) Next() bool {
-	now := time.Now()
+	now := a.now()
 	sleep := a.nextSleep(now)
 	if !a.force && !now.Add(sleep).Before(a.end) && a.strategy.Min <= a.count {
 		return false
 	}
 	a.force = false
 	if sleep > 0 && a.count > 0 {
-		time.Sleep(sleep)
-		now = time.Now()
+		a.sleep(sleep)
+		now = a.now()
 	}
 	a.count++
 	a.last = now
@@ -65,7 +76,7 @@ func (a *Attempt) HasNext() bool {
 	if a.force || a.strategy.Min > a.count {
 		return true
 	}
-	now := time.Now()
+	now := a.now()
 	if now.Add(a.nextSleep(now)).Before(a.end) {
 		a.force = true
 		return true
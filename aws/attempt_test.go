@@ -57,3 +57,20 @@ func (S) TestAttemptNextHasNext(c *C) {
 	c.Assert(a.HasNext(), Equals, false)
 	c.Assert(a.Next(), Equals, false)
 }
+
+func (S) TestAttemptClock(c *C) {
+	// A fake clock that only moves when slept on.
+	t := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	var slept []time.Duration
+	now := func() time.Time { return t }
+	sleep := func(d time.Duration) {
+		slept = append(slept, d)
+		t = t.Add(d)
+	}
+	n := 0
+	for a := (aws.AttemptStrategy{Total: 5e9, Delay: 2e9}).StartClock(now, sleep); a.Next(); {
+		n++
+	}
+	c.Assert(n, Equals, 3)
+	c.Assert(slept, DeepEquals, []time.Duration{2e9, 2e9})
+}
@@ -154,6 +154,20 @@ var Regions = map[string]Region{
 	SAEast.Name:       SAEast,
 }
 
+// CustomRegion returns a Region for an S3-compatible service reachable at
+// s3Endpoint, such as "https://storage.example.com". Requests are signed
+// with Signature Version 4 using name as the region in the signing scope,
+// which is also sent as the bucket location constraint unless it is
+// us-east-1. Other endpoints are left empty and may be set on the result.
+func CustomRegion(name, s3Endpoint string) Region {
+	return Region{
+		Name:                 name,
+		S3Endpoint:           s3Endpoint,
+		S3LocationConstraint: name != USEast.Name,
+		S3V4Signature:        true,
+	}
+}
+
 type Auth struct {
 	AccessKey, SecretKey string
 }
@@ -1,7 +1,9 @@
 package aws_test
 
 import (
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
@@ -63,6 +65,91 @@ func (s *S) TestEnvAuthLegacy(c *C) {
 	c.Assert(auth, Equals, aws.Auth{SecretKey: "secret", AccessKey: "access"})
 }
 
+func (s *S) TestDefaultAuthEnv(c *C) {
+	os.Clearenv()
+	os.Setenv("HOME", c.MkDir())
+	os.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	os.Setenv("AWS_ACCESS_KEY_ID", "access")
+	auth, err := aws.DefaultAuth()
+	c.Assert(err, IsNil)
+	c.Assert(auth, Equals, aws.Auth{SecretKey: "secret", AccessKey: "access"})
+}
+
+func (s *S) TestDefaultAuthSharedFile(c *C) {
+	os.Clearenv()
+	home := c.MkDir()
+	os.Setenv("HOME", home)
+	os.Mkdir(filepath.Join(home, ".aws"), 0700)
+	err := ioutil.WriteFile(filepath.Join(home, ".aws", "credentials"), []byte(`
+[default]
+aws_access_key_id = default-access
+aws_secret_access_key = default-secret
+
+[work]
+aws_access_key_id=work-access
+aws_secret_access_key=work-secret
+`), 0600)
+	c.Assert(err, IsNil)
+
+	auth, err := aws.DefaultAuth()
+	c.Assert(err, IsNil)
+	c.Assert(auth, Equals, aws.Auth{SecretKey: "default-secret", AccessKey: "default-access"})
+
+	os.Setenv("AWS_PROFILE", "work")
+	auth, err = aws.DefaultAuth()
+	c.Assert(err, IsNil)
+	c.Assert(auth, Equals, aws.Auth{SecretKey: "work-secret", AccessKey: "work-access"})
+
+	os.Setenv("AWS_PROFILE", "missing")
+	_, err = aws.DefaultAuth()
+	c.Assert(err, ErrorMatches, `no AWS credentials found: .*; no credentials for profile "missing" in .*`)
+}
+
+func (s *S) TestDefaultAuthMissing(c *C) {
+	os.Clearenv()
+	os.Setenv("HOME", c.MkDir())
+	_, err := aws.DefaultAuth()
+	c.Assert(err, ErrorMatches, `no AWS credentials found: AWS_SECRET_ACCESS_KEY not found in environment; no credentials for profile "default" in .*`)
+}
+
+func (s *S) TestDefaultRegion(c *C) {
+	os.Clearenv()
+	home := c.MkDir()
+	os.Setenv("HOME", home)
+	_, err := aws.DefaultRegion()
+	c.Assert(err, Equals, aws.ErrNoRegion)
+
+	os.Mkdir(filepath.Join(home, ".aws"), 0700)
+	err = ioutil.WriteFile(filepath.Join(home, ".aws", "config"), []byte(`
+[default]
+region = eu-west-1
+
+[profile work]
+region = eu-central-1
+`), 0600)
+	c.Assert(err, IsNil)
+	region, err := aws.DefaultRegion()
+	c.Assert(err, IsNil)
+	c.Assert(region, Equals, aws.EUWest)
+
+	os.Setenv("AWS_PROFILE", "work")
+	region, err = aws.DefaultRegion()
+	c.Assert(err, IsNil)
+	c.Assert(region.Name, Equals, "eu-central-1")
+	c.Assert(region.S3Endpoint, Equals, "https://s3.eu-central-1.amazonaws.com")
+	c.Assert(region.S3V4Signature, Equals, true)
+
+	os.Setenv("AWS_DEFAULT_REGION", "us-west-1")
+	region, err = aws.DefaultRegion()
+	c.Assert(err, IsNil)
+	c.Assert(region, Equals, aws.USWest)
+
+	os.Setenv("AWS_REGION", "us-east-1")
+	region, err = aws.DefaultRegion()
+	c.Assert(err, IsNil)
+	c.Assert(region, Equals, aws.USEast)
+}
+
 func (s *S) TestEncode(c *C) {
 	c.Assert(aws.Encode("foo"), Equals, "foo")
 	c.Assert(aws.Encode("/"), Equals, "%2F")
@@ -0,0 +1,135 @@
+package aws
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrNoRegion is returned by DefaultRegion when no region is configured.
+var ErrNoRegion = errors.New("no AWS region found in AWS_REGION, AWS_DEFAULT_REGION or the shared config file")
+
+// profile returns the name of the profile to read from the shared
+// credentials and config files.
+func profile() string {
+	if p := os.Getenv("AWS_PROFILE"); p != "" {
+		return p
+	}
+	return "default"
+}
+
+// sharedFile returns the path held by the environment variable env, or
+// else the file with the given name in the ~/.aws directory.
+func sharedFile(env, name string) string {
+	if path := os.Getenv(env); path != "" {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".aws", name)
+}
+
+// readINISection returns the key/value pairs of the given section of
+// the INI file at path. It returns nil if the file or the section
+// doesn't exist.
+func readINISection(path, section string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var values map[string]string
+	in := false
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "" || line[0] == '#' || line[0] == ';':
+		case line[0] == '[' && line[len(line)-1] == ']':
+			in = strings.TrimSpace(line[1:len(line)-1]) == section
+			if in && values == nil {
+				values = make(map[string]string)
+			}
+		case in:
+			if i := strings.Index(line, "="); i >= 0 {
+				values[strings.TrimSpace(line[:i])] = strings.TrimSpace(line[i+1:])
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("cannot read %s: %v", path, err)
+	}
+	return values, nil
+}
+
+// SharedAuth creates an Auth from the shared credentials file used by
+// the AWS CLI and SDKs, ~/.aws/credentials or the file named by the
+// AWS_SHARED_CREDENTIALS_FILE environment variable. The profile named
+// by AWS_PROFILE is used, or else the default one.
+func SharedAuth() (auth Auth, err error) {
+	path := sharedFile("AWS_SHARED_CREDENTIALS_FILE", "credentials")
+	name := profile()
+	values, err := readINISection(path, name)
+	if err != nil {
+		return auth, err
+	}
+	auth.AccessKey = values["aws_access_key_id"]
+	auth.SecretKey = values["aws_secret_access_key"]
+	if auth.AccessKey == "" || auth.SecretKey == "" {
+		return auth, fmt.Errorf("no credentials for profile %q in %s", name, path)
+	}
+	return auth, nil
+}
+
+// DefaultAuth creates an Auth from the environment (see EnvAuth) or,
+// failing that, from the shared credentials file (see SharedAuth).
+func DefaultAuth() (auth Auth, err error) {
+	auth, envErr := EnvAuth()
+	if envErr == nil {
+		return auth, nil
+	}
+	auth, err = SharedAuth()
+	if err != nil {
+		return auth, fmt.Errorf("no AWS credentials found: %v; %v", envErr, err)
+	}
+	return auth, nil
+}
+
+// DefaultRegion returns the region named by the AWS_REGION or
+// AWS_DEFAULT_REGION environment variables or, failing that, by the
+// region setting of the profile in the shared config file used by the
+// AWS CLI and SDKs, ~/.aws/config or the file named by AWS_CONFIG_FILE.
+// Regions missing from Regions are assumed to use the standard S3
+// endpoint and Signature Version 4.
+func DefaultRegion() (Region, error) {
+	name := os.Getenv("AWS_REGION")
+	if name == "" {
+		name = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	if name == "" {
+		section := "profile " + profile()
+		if section == "profile default" {
+			section = "default"
+		}
+		values, err := readINISection(sharedFile("AWS_CONFIG_FILE", "config"), section)
+		if err != nil {
+			return Region{}, err
+		}
+		name = values["region"]
+	}
+	if name == "" {
+		return Region{}, ErrNoRegion
+	}
+	if region, ok := Regions[name]; ok {
+		return region, nil
+	}
+	return CustomRegion(name, "https://s3."+name+".amazonaws.com"), nil
+}
@@ -0,0 +1,118 @@
+package s3
+
+// GranteeType is the kind of a Grantee.
+type GranteeType string
+
+const (
+	GranteeCanonicalUser         = GranteeType("CanonicalUser")
+	GranteeAmazonCustomerByEmail = GranteeType("AmazonCustomerByEmail")
+	GranteeGroup                 = GranteeType("Group")
+)
+
+// URIs of the predefined groups.
+const (
+	AllUsersURI           = "http://acs.amazonaws.com/groups/global/AllUsers"
+	AuthenticatedUsersURI = "http://acs.amazonaws.com/groups/global/AuthenticatedUsers"
+	LogDeliveryURI        = "http://acs.amazonaws.com/groups/s3/LogDelivery"
+)
+
+// Permission is a permission that may be granted.
+type Permission string
+
+const (
+	PermFullControl = Permission("FULL_CONTROL")
+	PermRead        = Permission("READ")
+	PermWrite       = Permission("WRITE")
+	PermReadACP     = Permission("READ_ACP")
+	PermWriteACP    = Permission("WRITE_ACP")
+)
+
+// CustomACL is reported by AccessControlPolicy.CannedACL when the grants
+// match no canned ACL. Unlike the other ACL values it can't be sent to
+// S3.
+const CustomACL = ACL("custom")
+
+// Grantee identifies who a grant applies to: a user, by ID or email
+// address, or a predefined group, by URI.
+type Grantee struct {
+	Type         GranteeType `xml:"http://www.w3.org/2001/XMLSchema-instance type,attr"`
+	ID           string      `xml:",omitempty"`
+	DisplayName  string      `xml:",omitempty"`
+	EmailAddress string      `xml:",omitempty"`
+	URI          string      `xml:",omitempty"`
+}
+
+// Grant gives a permission to a grantee.
+type Grant struct {
+	Grantee    Grantee
+	Permission Permission
+}
+
+// AccessControlPolicy is the access control list of a bucket or object.
+type AccessControlPolicy struct {
+	Owner  Owner
+	Grants []Grant `xml:"AccessControlList>Grant"`
+}
+
+// GetACL retrieves the access control list of the object at path, or of
+// the bucket itself if path is "/".
+//
+// See http://docs.aws.amazon.com/AmazonS3/latest/API/RESTObjectGETacl.html
+// for details.
+func (b *Bucket) GetACL(path string) (*AccessControlPolicy, error) {
+	req := &request{
+		bucket: b.Name,
+		path:   path,
+		params: map[string][]string{"acl": {}},
+	}
+	for attempt := b.S3.startAttempts(); attempt.Next(); {
+		policy := &AccessControlPolicy{}
+		err := b.S3.query(req, policy)
+		if b.S3.shouldRetry(req.method, err) && attempt.HasNext() {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return policy, nil
+	}
+	panic("unreachable")
+}
+
+// CannedACL returns the canned ACL whose grants are those of p: Private,
+// PublicRead, PublicReadWrite or AuthenticatedRead. Each of them grants
+// full control to the owner, and the public ones also grant READ (and
+// WRITE) to the AllUsers or AuthenticatedUsers group. The order of the
+// grants doesn't matter, but any other grant makes the ACL CustomACL.
+func (p *AccessControlPolicy) CannedACL() ACL {
+	type grant struct {
+		uri        string
+		permission Permission
+	}
+	owner := false
+	others := make(map[grant]bool)
+	for _, g := range p.Grants {
+		switch {
+		case g.Grantee.Type == GranteeCanonicalUser && g.Grantee.ID == p.Owner.ID && g.Permission == PermFullControl:
+			owner = true
+		case g.Grantee.Type == GranteeGroup:
+			others[grant{g.Grantee.URI, g.Permission}] = true
+		default:
+			return CustomACL
+		}
+	}
+	if !owner {
+		return CustomACL
+	}
+	switch {
+	case len(others) == 0:
+		return Private
+	case len(others) == 1 && others[grant{AllUsersURI, PermRead}]:
+		return PublicRead
+	case len(others) == 2 && others[grant{AllUsersURI, PermRead}] && others[grant{AllUsersURI, PermWrite}]:
+		return PublicReadWrite
+	case len(others) == 1 && others[grant{AuthenticatedUsersURI, PermRead}]:
+		return AuthenticatedRead
+	}
+	return CustomACL
+}
@@ -0,0 +1,74 @@
+package s3_test
+
+import (
+	. "gopkg.in/check.v1"
+
+	"github.com/koofr/goamz/s3"
+)
+
+func (s *S) TestGetACL(c *C) {
+	testServer.Response(200, nil, GetACLResultDump)
+
+	b := s.s3.Bucket("bucket")
+	policy, err := b.GetACL("name")
+	c.Assert(err, IsNil)
+
+	req := testServer.WaitRequest()
+	c.Assert(req.Method, Equals, "GET")
+	c.Assert(req.URL.Path, Equals, "/bucket/name")
+	c.Assert(req.Form["acl"], DeepEquals, []string{""})
+
+	owner := "75aa57f09aa0c8caeab4f8c24e99d10f8e7faeebf76c078efc7c6caea54ba06a"
+	c.Assert(policy.Owner.ID, Equals, owner)
+	c.Assert(policy.Grants, DeepEquals, []s3.Grant{{
+		Grantee: s3.Grantee{
+			Type:        s3.GranteeCanonicalUser,
+			ID:          owner,
+			DisplayName: "CustomersName@amazon.com",
+		},
+		Permission: s3.PermFullControl,
+	}, {
+		Grantee:    s3.Grantee{Type: s3.GranteeGroup, URI: s3.AllUsersURI},
+		Permission: s3.PermRead,
+	}})
+	c.Assert(policy.CannedACL(), Equals, s3.PublicRead)
+}
+
+func (s *S) TestCannedACL(c *C) {
+	owner := s3.Grant{
+		Grantee:    s3.Grantee{Type: s3.GranteeCanonicalUser, ID: "owner"},
+		Permission: s3.PermFullControl,
+	}
+	group := func(uri string, permission s3.Permission) s3.Grant {
+		return s3.Grant{
+			Grantee:    s3.Grantee{Type: s3.GranteeGroup, URI: uri},
+			Permission: permission,
+		}
+	}
+	tests := []struct {
+		grants []s3.Grant
+		acl    s3.ACL
+	}{
+		{[]s3.Grant{owner}, s3.Private},
+		{[]s3.Grant{owner, group(s3.AllUsersURI, s3.PermRead)}, s3.PublicRead},
+		{[]s3.Grant{group(s3.AllUsersURI, s3.PermWrite), owner, group(s3.AllUsersURI, s3.PermRead)}, s3.PublicReadWrite},
+		{[]s3.Grant{owner, group(s3.AuthenticatedUsersURI, s3.PermRead)}, s3.AuthenticatedRead},
+		{nil, s3.CustomACL},
+		{[]s3.Grant{group(s3.AllUsersURI, s3.PermRead)}, s3.CustomACL},
+		{[]s3.Grant{owner, group(s3.AllUsersURI, s3.PermWrite)}, s3.CustomACL},
+		{[]s3.Grant{owner, group(s3.AllUsersURI, s3.PermReadACP)}, s3.CustomACL},
+		{[]s3.Grant{owner, group(s3.AllUsersURI, s3.PermRead), group(s3.AuthenticatedUsersURI, s3.PermRead)}, s3.CustomACL},
+		{[]s3.Grant{owner, group(s3.LogDeliveryURI, s3.PermWrite)}, s3.CustomACL},
+		{[]s3.Grant{owner, {
+			Grantee:    s3.Grantee{Type: s3.GranteeCanonicalUser, ID: "other"},
+			Permission: s3.PermRead,
+		}}, s3.CustomACL},
+	}
+	for i, t := range tests {
+		policy := s3.AccessControlPolicy{
+			Owner:  s3.Owner{ID: "owner"},
+			Grants: t.grants,
+		}
+		c.Assert(policy.CannedACL(), Equals, t.acl, Commentf("test %d", i))
+	}
+}
@@ -0,0 +1,167 @@
+package s3
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// archiveWriter writes entries to a tar or zip archive.
+type archiveWriter interface {
+	create(name string, size int64, mtime time.Time) (io.Writer, error)
+	mkdir(name string, mtime time.Time) error
+	Close() error
+}
+
+type tarArchive struct {
+	*tar.Writer
+}
+
+func (a tarArchive) create(name string, size int64, mtime time.Time) (io.Writer, error) {
+	err := a.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Size:     size,
+		Mode:     0644,
+		ModTime:  mtime,
+	})
+	return a.Writer, err
+}
+
+func (a tarArchive) mkdir(name string, mtime time.Time) error {
+	return a.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeDir,
+		Name:     name,
+		Mode:     0755,
+		ModTime:  mtime,
+	})
+}
+
+type zipArchive struct {
+	*zip.Writer
+}
+
+func (a zipArchive) create(name string, size int64, mtime time.Time) (io.Writer, error) {
+	return a.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   zip.Deflate,
+		Modified: mtime,
+	})
+}
+
+func (a zipArchive) mkdir(name string, mtime time.Time) error {
+	// A name ending in a slash makes a directory.
+	_, err := a.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Modified: mtime,
+	})
+	return err
+}
+
+// ArchivePrefix writes to w an archive of the objects whose keys begin
+// with prefix, in the given format, "tar" or "zip". Each object is
+// stored under its key without the prefix, in the order of the listing;
+// keys equal to the prefix are left out, and keys ending in a slash,
+// which stand for folders, are written as directories. The content of
+// the objects is streamed from S3 to w, retrieving up to concurrency
+// objects at a time so that the next ones are ready when the current
+// one is written.
+//
+// If an object changes while the archive is written, ArchivePrefix
+// fails as its size no longer matches the listing. In any case, the
+// archive is only valid if no error is returned.
+func (b *Bucket) ArchivePrefix(prefix string, w io.Writer, format string, concurrency int) error {
+	if concurrency < 1 {
+		return fmt.Errorf("bad concurrency: %d", concurrency)
+	}
+	var aw archiveWriter
+	switch format {
+	case "tar":
+		aw = tarArchive{tar.NewWriter(w)}
+	case "zip":
+		aw = zipArchive{zip.NewWriter(w)}
+	default:
+		return fmt.Errorf("bad archive format: %q", format)
+	}
+	var keys []Key
+	err := b.walkPrefix(prefix, func(key *Key) {
+		if key.Key != prefix {
+			keys = append(keys, *key)
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	type object struct {
+		rc  io.ReadCloser
+		err error
+	}
+	objects := make([]chan object, len(keys))
+	for i := range objects {
+		objects[i] = make(chan object, 1)
+	}
+	next := 0
+	for i, key := range keys {
+		// Keep up to concurrency objects in flight, including the
+		// current one.
+		for ; next < len(keys) && next < i+concurrency; next++ {
+			go func(n int) {
+				if isArchiveDir(&keys[n]) {
+					objects[n] <- object{}
+					return
+				}
+				rc, err := b.GetReader(keys[n].Key)
+				objects[n] <- object{rc, err}
+			}(next)
+		}
+		obj := <-objects[i]
+		name := strings.TrimPrefix(key.Key, prefix)
+		err := obj.err
+		switch {
+		case err != nil:
+		case obj.rc == nil:
+			mtime, _ := time.Parse(time.RFC3339, key.LastModified)
+			err = aw.mkdir(name, mtime)
+		default:
+			err = writeArchiveEntry(aw, name, &key, obj.rc)
+			obj.rc.Close()
+		}
+		if err != nil {
+			for j := i + 1; j < next; j++ {
+				if obj := <-objects[j]; obj.rc != nil {
+					obj.rc.Close()
+				}
+			}
+			return err
+		}
+	}
+	return aw.Close()
+}
+
+// isArchiveDir reports whether key is a folder placeholder, which is
+// archived as a directory rather than retrieved.
+func isArchiveDir(key *Key) bool {
+	return strings.HasSuffix(key.Key, "/")
+}
+
+// writeArchiveEntry writes the content of the object described by key,
+// read from r, to aw under name.
+func writeArchiveEntry(aw archiveWriter, name string, key *Key, r io.Reader) error {
+	mtime, _ := time.Parse(time.RFC3339, key.LastModified)
+	ew, err := aw.create(name, key.Size, mtime)
+	if err != nil {
+		return err
+	}
+	n, err := io.Copy(ew, r)
+	if err != nil {
+		return err
+	}
+	if n != key.Size {
+		return fmt.Errorf("s3: object %q changed while archiving: got %d bytes, expected %d", key.Key, n, key.Size)
+	}
+	return nil
+}
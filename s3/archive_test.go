@@ -0,0 +1,83 @@
+package s3_test
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"io"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/koofr/goamz/s3"
+)
+
+func (s *LocalBucketSuite) putArchiveObjects(c *C) {
+	for key, content := range map[string]string{
+		"export/":          "",
+		"export/a.txt":     "alpha",
+		"export/dir/b.txt": "beta",
+		"export/empty/":    "",
+		"export/c.txt":     "gamma",
+		"other/d.txt":      "delta",
+	} {
+		c.Assert(s.b.Put(key, []byte(content), "text/plain", s3.Private), IsNil)
+	}
+}
+
+func (s *LocalBucketSuite) TestArchivePrefixTar(c *C) {
+	s.putArchiveObjects(c)
+	b := s.b
+
+	var buf bytes.Buffer
+	err := b.ArchivePrefix("export/", &buf, "tar", 2)
+	c.Assert(err, IsNil)
+
+	var names, contents []string
+	var types []byte
+	tr := tar.NewReader(&buf)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		c.Assert(err, IsNil)
+		names = append(names, hdr.Name)
+		types = append(types, hdr.Typeflag)
+		contents = append(contents, readAll(tr))
+		c.Assert(hdr.ModTime.IsZero(), Equals, false)
+	}
+	c.Assert(names, DeepEquals, []string{"a.txt", "c.txt", "dir/b.txt", "empty/"})
+	c.Assert(types, DeepEquals, []byte{tar.TypeReg, tar.TypeReg, tar.TypeReg, tar.TypeDir})
+	c.Assert(contents, DeepEquals, []string{"alpha", "gamma", "beta", ""})
+
+	err = b.ArchivePrefix("export/", &buf, "tar", 0)
+	c.Assert(err, ErrorMatches, "bad concurrency: 0")
+}
+
+func (s *LocalBucketSuite) TestArchivePrefixZip(c *C) {
+	s.putArchiveObjects(c)
+	b := s.b
+
+	var buf bytes.Buffer
+	err := b.ArchivePrefix("export/", &buf, "zip", 4)
+	c.Assert(err, IsNil)
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	c.Assert(err, IsNil)
+	var names, contents []string
+	var dirs []bool
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		c.Assert(err, IsNil)
+		names = append(names, f.Name)
+		dirs = append(dirs, f.FileInfo().IsDir())
+		contents = append(contents, readAll(rc))
+		rc.Close()
+	}
+	c.Assert(names, DeepEquals, []string{"a.txt", "c.txt", "dir/b.txt", "empty/"})
+	c.Assert(dirs, DeepEquals, []bool{false, false, false, true})
+	c.Assert(contents, DeepEquals, []string{"alpha", "gamma", "beta", ""})
+
+	err = b.ArchivePrefix("export/", &buf, "rar", 4)
+	c.Assert(err, ErrorMatches, `bad archive format: "rar"`)
+}
@@ -0,0 +1,75 @@
+package s3
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+)
+
+// Capabilities reports which optional features an S3-compatible backend
+// supports, as detected by ProbeCapabilities.
+type Capabilities struct {
+	Multipart  bool
+	Versioning bool
+	Tagging    bool
+}
+
+// ProbeCapabilities detects which optional features the backend serving
+// b supports, so callers may degrade gracefully on S3-compatible stores
+// such as MinIO, Ceph or Wasabi. It only sends read requests that don't
+// change anything: it lists multipart uploads, reads the versioning
+// configuration of b and reads the tags of a key that doesn't exist.
+//
+// A feature is reported as unsupported when the backend rejects the
+// request as not implemented or not allowed. Other errors, such as
+// access being denied, are returned since nothing can be concluded from
+// them.
+func (b *Bucket) ProbeCapabilities() (*Capabilities, error) {
+	var caps Capabilities
+	var err error
+	caps.Multipart, err = b.probe("/", map[string][]string{"uploads": {}, "max-uploads": {"1"}})
+	if err != nil {
+		return nil, err
+	}
+	caps.Versioning, err = b.probe("/", map[string][]string{"versioning": {}})
+	if err != nil {
+		return nil, err
+	}
+	var id [8]byte
+	_, err = rand.Read(id[:])
+	if err != nil {
+		return nil, err
+	}
+	caps.Tagging, err = b.probe(".goamz-probe-"+hex.EncodeToString(id[:]), map[string][]string{"tagging": {}})
+	if err != nil {
+		return nil, err
+	}
+	return &caps, nil
+}
+
+// probe sends a GET request for path with params and reports whether
+// the backend supports it.
+func (b *Bucket) probe(path string, params map[string][]string) (bool, error) {
+	for attempt := b.S3.startAttempts(); attempt.Next(); {
+		req := &request{
+			bucket: b.Name,
+			path:   path,
+			params: params,
+		}
+		err := b.S3.query(req, nil)
+		if b.S3.shouldRetry(req.method, err) && attempt.HasNext() {
+			continue
+		}
+		switch {
+		case err == nil:
+			return true, nil
+		case hasStatus(err, http.StatusNotImplemented), hasCode(err, "NotImplemented"), hasCode(err, "MethodNotAllowed"):
+			return false, nil
+		case hasCode(err, "NoSuchKey"), hasCode(err, "NoSuchTagSet"):
+			// The request was understood, there was just nothing to read.
+			return true, nil
+		}
+		return false, err
+	}
+	panic("unreachable")
+}
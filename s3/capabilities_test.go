@@ -0,0 +1,49 @@
+package s3_test
+
+import (
+	. "gopkg.in/check.v1"
+
+	"github.com/koofr/goamz/s3"
+)
+
+func (s *LocalBucketSuite) TestProbeCapabilities(c *C) {
+	// s3test implements multipart uploads, but neither versioning
+	// nor tagging.
+	b := s.b
+
+	caps, err := b.ProbeCapabilities()
+	c.Assert(err, IsNil)
+	c.Assert(*caps, Equals, s3.Capabilities{Multipart: true})
+
+	objects, err := b.List("", "", "", 0)
+	c.Assert(err, IsNil)
+	c.Assert(objects.Contents, HasLen, 0)
+}
+
+func (s *S) TestProbeCapabilitiesAllSupported(c *C) {
+	testServer.Response(200, nil, ListMultiResultDump)
+	testServer.Response(200, nil, `<VersioningConfiguration/>`)
+	testServer.Response(404, nil, NoSuchKeyErrorDump)
+
+	b := s.s3.Bucket("bucket")
+	caps, err := b.ProbeCapabilities()
+	c.Assert(err, IsNil)
+	c.Assert(*caps, Equals, s3.Capabilities{Multipart: true, Versioning: true, Tagging: true})
+
+	reqs := testServer.WaitRequests(3)
+	c.Assert(reqs[0].URL.RawQuery, Equals, "max-uploads=1&uploads")
+	c.Assert(reqs[1].URL.RawQuery, Equals, "versioning")
+	c.Assert(reqs[2].URL.RawQuery, Equals, "tagging")
+	c.Assert(reqs[2].URL.Path, Matches, `/bucket/\.goamz-probe-[0-9a-f]{16}`)
+	for _, req := range reqs {
+		c.Assert(req.Method, Equals, "GET")
+	}
+}
+
+func (s *S) TestProbeCapabilitiesAccessDenied(c *C) {
+	testServer.Response(403, nil, AccessDeniedErrorDump)
+
+	b := s.s3.Bucket("bucket")
+	_, err := b.ProbeCapabilities()
+	c.Assert(err, ErrorMatches, "Access Denied")
+}
@@ -0,0 +1,68 @@
+package s3
+
+import (
+	"sort"
+	"strings"
+)
+
+// FileInfo describes a local file for Bucket.Diff.
+type FileInfo struct {
+	Size int64
+	// MD5 is the hex encoded MD5 sum of the content of the file.
+	MD5 string
+	// MultipartETag is the ETag expected for the file once uploaded in
+	// parts, as returned by FileMultipartETag for the part size used
+	// when uploading it. It is only needed to compare the file with
+	// objects uploaded via multipart upload, whose ETag is not the MD5
+	// sum of their content.
+	MultipartETag string
+}
+
+// Diff compares the objects whose keys begin with prefix with the local
+// files, keyed by their name relative to prefix, and returns the keys
+// of the files to upload, as they are new or changed, and of the
+// objects to delete, as they have no local file. Both lists are sorted.
+//
+// A file is unchanged if its size matches that of the object and its
+// MD5 sum matches the ETag of the object. If the object was uploaded
+// in parts, its ETag is compared with MultipartETag instead, and the
+// file is uploaded again if MultipartETag is empty or was computed for
+// a different part size.
+func (b *Bucket) Diff(prefix string, local map[string]FileInfo) (toUpload, toDelete []string, err error) {
+	seen := make(map[string]bool, len(local))
+	err = b.walkPrefix(prefix, func(key *Key) {
+		name := strings.TrimPrefix(key.Key, prefix)
+		info, ok := local[name]
+		if !ok {
+			toDelete = append(toDelete, key.Key)
+			return
+		}
+		seen[name] = true
+		if !info.matches(key) {
+			toUpload = append(toUpload, key.Key)
+		}
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	for name := range local {
+		if !seen[name] {
+			toUpload = append(toUpload, prefix+name)
+		}
+	}
+	sort.Strings(toUpload)
+	return toUpload, toDelete, nil
+}
+
+// matches reports whether the file described by info has the content of
+// the object described by key.
+func (info FileInfo) matches(key *Key) bool {
+	if info.Size != key.Size {
+		return false
+	}
+	etag := strings.Trim(key.ETag, `"`)
+	if strings.Contains(etag, "-") {
+		return info.MultipartETag != "" && strings.EqualFold(etag, strings.Trim(info.MultipartETag, `"`))
+	}
+	return strings.EqualFold(etag, info.MD5)
+}
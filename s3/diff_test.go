@@ -0,0 +1,37 @@
+package s3_test
+
+import (
+	. "gopkg.in/check.v1"
+
+	"github.com/koofr/goamz/s3"
+)
+
+func (s *S) TestDiff(c *C) {
+	testServer.Response(200, nil, DiffListResultDump)
+
+	b := s.s3.Bucket("bucket")
+	toUpload, toDelete, err := b.Diff("backup/", map[string]s3.FileInfo{
+		"unchanged":       {Size: 5, MD5: "828EF3FDFA96F00AD9F27C383FC9AC7F"},
+		"changed-content": {Size: 5, MD5: "5d41402abc4b2a76b9719d911017c592"},
+		"changed-size":    {Size: 6, MD5: "828ef3fdfa96f00ad9f27c383fc9ac7f"},
+		"multipart": {
+			Size:          10485760,
+			MD5:           "f1c9645dbc14efddc7d8a322685f26eb",
+			MultipartETag: "3858f62230ac3c915f300c664312c11f-2",
+		},
+		"multipart-unknown": {Size: 10485760, MD5: "f1c9645dbc14efddc7d8a322685f26eb"},
+		"new":               {Size: 3, MD5: "acbd18db4cc2f85cedef654fccc4a4d8"},
+	})
+	c.Assert(err, IsNil)
+	c.Assert(toUpload, DeepEquals, []string{
+		"backup/changed-content",
+		"backup/changed-size",
+		"backup/multipart-unknown",
+		"backup/new",
+	})
+	c.Assert(toDelete, DeepEquals, []string{"backup/deleted"})
+
+	req := testServer.WaitRequest()
+	c.Assert(req.Method, Equals, "GET")
+	c.Assert(req.Form["prefix"], DeepEquals, []string{"backup/"})
+}
@@ -0,0 +1,79 @@
+package s3
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// DryRunRequest is a request recorded by a DryRunLog in place of being
+// sent.
+type DryRunRequest struct {
+	Method string
+	URL    string
+	// Header holds the headers of the request as signed, including
+	// the Authorization header.
+	Header http.Header
+	// ContentLength is the length of the body of the request, or -1
+	// if it is unknown.
+	ContentLength int64
+	// BodySHA256 is the hex encoded SHA-256 sum of the body of the
+	// request, which is the sum of no data for requests without a body.
+	BodySHA256 string
+}
+
+// DryRunLog records the requests of a client in dry run mode (see
+// S3.DryRun). It is safe for concurrent use.
+type DryRunLog struct {
+	mu       sync.Mutex
+	requests []DryRunRequest
+}
+
+// Requests returns the requests recorded so far, in the order they
+// would have been sent.
+func (l *DryRunLog) Requests() []DryRunRequest {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]DryRunRequest(nil), l.requests...)
+}
+
+// Reset forgets the requests recorded so far.
+func (l *DryRunLog) Reset() {
+	l.mu.Lock()
+	l.requests = nil
+	l.mu.Unlock()
+}
+
+// record adds hreq, whose body is read in full, to l and returns the
+// successful response standing in for that of S3.
+func (l *DryRunLog) record(hreq *http.Request) (*http.Response, error) {
+	h := sha256.New()
+	if hreq.Body != nil {
+		if _, err := io.Copy(h, hreq.Body); err != nil {
+			return nil, err
+		}
+	}
+	l.mu.Lock()
+	l.requests = append(l.requests, DryRunRequest{
+		Method:        hreq.Method,
+		URL:           hreq.URL.String(),
+		Header:        hreq.Header.Clone(),
+		ContentLength: hreq.ContentLength,
+		BodySHA256:    hex.EncodeToString(h.Sum(nil)),
+	})
+	l.mu.Unlock()
+	return &http.Response{
+		Status:     "200 OK",
+		StatusCode: 200,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     make(http.Header),
+		Body:       ioutil.NopCloser(strings.NewReader("")),
+		Request:    hreq,
+	}, nil
+}
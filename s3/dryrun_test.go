@@ -0,0 +1,45 @@
+package s3_test
+
+import (
+	"net/url"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/koofr/goamz/aws"
+	"github.com/koofr/goamz/s3"
+)
+
+func (s *S) TestDryRun(c *C) {
+	log := &s3.DryRunLog{}
+	client := s3.New(aws.Auth{AccessKey: "abc", SecretKey: "123"}, aws.Region{Name: "faux-region-1", S3Endpoint: testServer.URL})
+	client.DryRun = log
+
+	b := client.Bucket("bucket")
+	err := b.Put("name", []byte("content"), "text/plain", s3.Private)
+	c.Assert(err, IsNil)
+
+	requests := log.Requests()
+	c.Assert(requests, HasLen, 1)
+	r := requests[0]
+	c.Assert(r.Method, Equals, "PUT")
+	u, err := url.Parse(r.URL)
+	c.Assert(err, IsNil)
+	c.Assert(u.Path, Equals, "/bucket/name")
+	c.Assert(r.Header.Get("Content-Type"), Equals, "text/plain")
+	c.Assert(r.Header["x-amz-acl"], DeepEquals, []string{"private"})
+	c.Assert(r.Header.Get("Authorization"), Not(Equals), "")
+	c.Assert(r.ContentLength, Equals, int64(7))
+	c.Assert(r.BodySHA256, Equals, s3.SHA256Hex([]byte("content")))
+
+	log.Reset()
+	c.Assert(log.Requests(), HasLen, 0)
+
+	// Nothing was sent: the first request the server sees is the one
+	// sent once dry run mode is off.
+	client.DryRun = nil
+	testServer.Response(200, nil, "")
+	err = b.Put("other", []byte("content"), "text/plain", s3.Private)
+	c.Assert(err, IsNil)
+	req := testServer.WaitRequest()
+	c.Assert(req.URL.Path, Equals, "/bucket/other")
+}
@@ -1,6 +1,10 @@
 package s3
 
 import (
+	"net/http"
+	"net/url"
+	"time"
+
 	"github.com/koofr/goamz/aws"
 )
 
@@ -25,3 +29,68 @@ func SetListPartsMax(n int) {
 func SetListMultiMax(n int) {
 	listMultiMax = n
 }
+
+func SpoolFileName(s *SpooledReader) string {
+	if s.file == nil {
+		return ""
+	}
+	return s.file.Name()
+}
+
+func SetRegionCacheLimits(size int, ttl time.Duration) {
+	regionCacheSize = size
+	regionCacheTTL = ttl
+}
+
+func RegionCacheLimits() (int, time.Duration) {
+	return regionCacheSize, regionCacheTTL
+}
+
+func SetSignedURLSourceClock(s *SignedURLSource, now func() time.Time) {
+	s.now = now
+}
+
+func SetClock(s3 *S3, now func() time.Time) {
+	s3.clock = now
+}
+
+func SetSignerClock(s *V4Signer, now func() time.Time) {
+	s.now = now
+}
+
+func SetSleep(s3 *S3, sleep func(time.Duration)) {
+	s3.sleep = sleep
+}
+
+func VerifyPresignedRequestAt(req *http.Request, secretKey string, now func() time.Time) (valid bool, expired bool, err error) {
+	return verifyPresignedRequest(req, secretKey, now)
+}
+
+func SetPutFilePartSize(n int64) {
+	putFilePartSize = n
+}
+
+func SetAWSChunkSize(n int64) {
+	awsChunkSize = n
+}
+
+func ShouldRetry(err error) bool {
+	return shouldRetry(err)
+}
+
+func SetCopySizes(max, part int64) {
+	maxCopySize = max
+	copyPartSize = part
+}
+
+func SetPoolPartBuffers(enabled bool) {
+	poolPartBuffers = enabled
+}
+
+func SetMinPartSize(n int64) {
+	minPartSize = n
+}
+
+func CanonicalQueryString(s *V4Signer, u *url.URL) string {
+	return s.canonicalQueryString(u)
+}
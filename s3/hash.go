@@ -5,7 +5,11 @@ import (
 	"crypto/md5"
 	"crypto/sha256"
 	"encoding/base64"
+	"encoding/binary"
 	"fmt"
+	"hash/crc64"
+	"io"
+	"os"
 )
 
 var EmptyStringSHA256Hex = SHA256Hex(nil)
@@ -30,3 +34,169 @@ func HMAC(key, data []byte) []byte {
 	h.Write(data)
 	return h.Sum(nil)
 }
+
+// ComputeMultipartETag returns the ETag S3 reports for an object uploaded
+// in parts with the given MD5 sums, without the surrounding quotes: the
+// hex encoded MD5 sum of the concatenated part sums, followed by a dash
+// and the number of parts.
+func ComputeMultipartETag(partMD5s [][]byte) string {
+	h := md5.New()
+	for _, sum := range partMD5s {
+		h.Write(sum)
+	}
+	return fmt.Sprintf("%x-%d", h.Sum(nil), len(partMD5s))
+}
+
+// FileMultipartETag returns the ETag S3 reports for the local file at path
+// once uploaded in parts of partSize bytes (see ComputeMultipartETag). It
+// allows checking that an uploaded object matches a local file without
+// downloading it.
+func FileMultipartETag(path string, partSize int64) (string, error) {
+	if partSize <= 0 {
+		return "", fmt.Errorf("bad part size: %d", partSize)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	var sums [][]byte
+	for {
+		h := md5.New()
+		n, err := io.CopyN(h, f, partSize)
+		if err != nil && err != io.EOF {
+			return "", err
+		}
+		if n > 0 || len(sums) == 0 {
+			sums = append(sums, h.Sum(nil))
+		}
+		if n < partSize {
+			break
+		}
+	}
+	return ComputeMultipartETag(sums), nil
+}
+
+// crc32Combine returns the CRC-32 checksum, with the reversed polynomial
+// poly, of the concatenation of two blocks of data with checksums crc1
+// and crc2, the second of which is len2 bytes long. It is a port of
+// crc32_combine from zlib.
+func crc32Combine(poly uint32, crc1, crc2 uint32, len2 int64) uint32 {
+	if len2 <= 0 {
+		return crc1 ^ crc2
+	}
+	// odd holds the operator for one zero bit, even for two.
+	var even, odd [32]uint32
+	odd[0] = poly
+	row := uint32(1)
+	for n := 1; n < 32; n++ {
+		odd[n] = row
+		row <<= 1
+	}
+	gf2MatrixSquare(even[:], odd[:])
+	gf2MatrixSquare(odd[:], even[:])
+
+	// Apply len2 zero bytes to crc1, squaring the operator for each
+	// bit of len2.
+	for {
+		gf2MatrixSquare(even[:], odd[:])
+		if len2&1 != 0 {
+			crc1 = gf2MatrixTimes(even[:], crc1)
+		}
+		len2 >>= 1
+		if len2 == 0 {
+			break
+		}
+		gf2MatrixSquare(odd[:], even[:])
+		if len2&1 != 0 {
+			crc1 = gf2MatrixTimes(odd[:], crc1)
+		}
+		len2 >>= 1
+		if len2 == 0 {
+			break
+		}
+	}
+	return crc1 ^ crc2
+}
+
+func gf2MatrixTimes(mat []uint32, vec uint32) uint32 {
+	var sum uint32
+	for i := 0; vec != 0; i, vec = i+1, vec>>1 {
+		if vec&1 != 0 {
+			sum ^= mat[i]
+		}
+	}
+	return sum
+}
+
+func gf2MatrixSquare(square, mat []uint32) {
+	for n := range square {
+		square[n] = gf2MatrixTimes(mat, mat[n])
+	}
+}
+
+// crc64NVMEPoly is the reversed polynomial of CRC-64/NVME, the checksum
+// S3 uses by default for full object checksums. Other than the
+// polynomial, it is computed like the checksums of hash/crc64.
+const crc64NVMEPoly = 0x9a6c9329ac4bc9b5
+
+var crc64NVMETable = crc64.MakeTable(crc64NVMEPoly)
+
+// CRC64NVMEB64 returns the base64 encoded CRC-64/NVME checksum of data,
+// as sent in the x-amz-checksum-crc64nvme header.
+func CRC64NVMEB64(data []byte) string {
+	var sum [8]byte
+	binary.BigEndian.PutUint64(sum[:], crc64.Checksum(data, crc64NVMETable))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// crc64Combine is like crc32Combine for CRC-64 checksums.
+func crc64Combine(poly uint64, crc1, crc2 uint64, len2 int64) uint64 {
+	if len2 <= 0 {
+		return crc1 ^ crc2
+	}
+	var even, odd [64]uint64
+	odd[0] = poly
+	row := uint64(1)
+	for n := 1; n < 64; n++ {
+		odd[n] = row
+		row <<= 1
+	}
+	gf2Matrix64Square(even[:], odd[:])
+	gf2Matrix64Square(odd[:], even[:])
+	for {
+		gf2Matrix64Square(even[:], odd[:])
+		if len2&1 != 0 {
+			crc1 = gf2Matrix64Times(even[:], crc1)
+		}
+		len2 >>= 1
+		if len2 == 0 {
+			break
+		}
+		gf2Matrix64Square(odd[:], even[:])
+		if len2&1 != 0 {
+			crc1 = gf2Matrix64Times(odd[:], crc1)
+		}
+		len2 >>= 1
+		if len2 == 0 {
+			break
+		}
+	}
+	return crc1 ^ crc2
+}
+
+func gf2Matrix64Times(mat []uint64, vec uint64) uint64 {
+	var sum uint64
+	for i := 0; vec != 0; i, vec = i+1, vec>>1 {
+		if vec&1 != 0 {
+			sum ^= mat[i]
+		}
+	}
+	return sum
+}
+
+func gf2Matrix64Square(square, mat []uint64) {
+	for n := range square {
+		square[n] = gf2Matrix64Times(mat, mat[n])
+	}
+}
@@ -0,0 +1,51 @@
+package s3_test
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"io/ioutil"
+	"path/filepath"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/koofr/goamz/s3"
+)
+
+func (s *S) TestComputeMultipartETag(c *C) {
+	var sums [][]byte
+	for _, h := range []string{"f814893777bcc2295fff05f00e508da6", "7d793037a0760186574b0282f2f435e7"} {
+		sum, err := hex.DecodeString(h)
+		c.Assert(err, IsNil)
+		sums = append(sums, sum)
+	}
+	c.Assert(s3.ComputeMultipartETag(sums), Equals, "e09e4fd6265b36115fe3db32df945d84-2")
+}
+
+func (s *S) TestFileMultipartETag(c *C) {
+	path := filepath.Join(c.MkDir(), "file")
+	c.Assert(ioutil.WriteFile(path, []byte("hello world"), 0644), IsNil)
+
+	etag, err := s3.FileMultipartETag(path, 6)
+	c.Assert(err, IsNil)
+	c.Assert(etag, Equals, "e09e4fd6265b36115fe3db32df945d84-2")
+
+	// A file that fits in a single part, and an empty one.
+	etag, err = s3.FileMultipartETag(path, 11)
+	c.Assert(err, IsNil)
+	c.Assert(etag, Matches, "[0-9a-f]{32}-1")
+	c.Assert(ioutil.WriteFile(path, nil, 0644), IsNil)
+	etag, err = s3.FileMultipartETag(path, 6)
+	c.Assert(err, IsNil)
+	c.Assert(etag, Matches, "[0-9a-f]{32}-1")
+
+	_, err = s3.FileMultipartETag(path, 0)
+	c.Assert(err, ErrorMatches, "bad part size: 0")
+}
+
+func (s *S) TestCRC64NVMEB64(c *C) {
+	// The check value of CRC-64/NVME.
+	sum, err := hex.DecodeString("ae8b14860a799888")
+	c.Assert(err, IsNil)
+	c.Assert(s3.CRC64NVMEB64([]byte("123456789")), Equals, base64.StdEncoding.EncodeToString(sum))
+	c.Assert(s3.CRC64NVMEB64(nil), Equals, "AAAAAAAAAAA=")
+}
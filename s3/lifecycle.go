@@ -0,0 +1,209 @@
+package s3
+
+import (
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// StorageClass identifies an S3 storage class.
+type StorageClass string
+
+const (
+	Standard           = StorageClass("STANDARD")
+	ReducedRedundancy  = StorageClass("REDUCED_REDUNDANCY")
+	StandardIA         = StorageClass("STANDARD_IA")
+	OnezoneIA          = StorageClass("ONEZONE_IA")
+	IntelligentTiering = StorageClass("INTELLIGENT_TIERING")
+	GlacierIR          = StorageClass("GLACIER_IR")
+	Glacier            = StorageClass("GLACIER")
+	DeepArchive        = StorageClass("DEEP_ARCHIVE")
+)
+
+// transitionTiers ranks the storage classes objects may be transitioned
+// to, from the warmest to the coldest. Objects may only move to colder
+// tiers as they age.
+var transitionTiers = map[StorageClass]int{
+	StandardIA:         1,
+	IntelligentTiering: 2,
+	OnezoneIA:          3,
+	GlacierIR:          4,
+	Glacier:            5,
+	DeepArchive:        6,
+}
+
+// minTransitionDays holds the minimum age in days at which objects may
+// be transitioned to a storage class, for classes with a minimum.
+var minTransitionDays = map[StorageClass]int{
+	StandardIA: 30,
+	OnezoneIA:  30,
+}
+
+// LifecycleTransition moves objects to another storage class.
+type LifecycleTransition struct {
+	// Days is the age of the objects in days at which they are
+	// transitioned. It's ignored if Date is set.
+	Days int
+	// Date is the date at which objects are transitioned, if set.
+	// It must be midnight UTC.
+	Date         time.Time
+	StorageClass StorageClass
+}
+
+// LifecycleRule describes how S3 manages the objects under a prefix
+// as they age.
+type LifecycleRule struct {
+	ID          string
+	Prefix      string
+	Enabled     bool
+	Transitions []LifecycleTransition
+	// ExpirationDays is the age of the objects in days at which they
+	// are deleted, or zero for objects not to expire.
+	ExpirationDays int
+}
+
+// Validate checks that r describes a configuration S3 accepts, so that
+// mistakes are reported before sending it. Transitions must target a
+// storage class objects may be moved to, respect the minimum age for
+// the class, and move objects to colder classes as they age.
+func (r LifecycleRule) Validate() error {
+	if len(r.ID) > 255 {
+		return fmt.Errorf("s3: lifecycle rule %q: ID longer than 255 characters", r.ID)
+	}
+	if len(r.Transitions) == 0 && r.ExpirationDays == 0 {
+		return fmt.Errorf("s3: lifecycle rule %q: no transitions or expiration", r.ID)
+	}
+	if r.ExpirationDays < 0 {
+		return fmt.Errorf("s3: lifecycle rule %q: negative expiration days: %d", r.ID, r.ExpirationDays)
+	}
+	byDate := false
+	for i, t := range r.Transitions {
+		tier, ok := transitionTiers[t.StorageClass]
+		if !ok {
+			return fmt.Errorf("s3: lifecycle rule %q: cannot transition objects to storage class %q", r.ID, t.StorageClass)
+		}
+		if i > 0 && byDate != !t.Date.IsZero() {
+			return fmt.Errorf("s3: lifecycle rule %q: transitions mix days and dates", r.ID)
+		}
+		byDate = !t.Date.IsZero()
+		if byDate {
+			if !t.Date.Equal(t.Date.UTC().Truncate(24 * time.Hour)) {
+				return fmt.Errorf("s3: lifecycle rule %q: transition date %s is not midnight UTC", r.ID, t.Date)
+			}
+		} else {
+			if t.Days < 0 {
+				return fmt.Errorf("s3: lifecycle rule %q: negative transition days: %d", r.ID, t.Days)
+			}
+			if min := minTransitionDays[t.StorageClass]; t.Days < min {
+				return fmt.Errorf("s3: lifecycle rule %q: transition to %s requires at least %d days, got %d", r.ID, t.StorageClass, min, t.Days)
+			}
+			if r.ExpirationDays > 0 && t.Days >= r.ExpirationDays {
+				return fmt.Errorf("s3: lifecycle rule %q: transition to %s after %d days is not before expiration after %d days", r.ID, t.StorageClass, t.Days, r.ExpirationDays)
+			}
+		}
+		for _, prev := range r.Transitions[:i] {
+			if prev.StorageClass == t.StorageClass {
+				return fmt.Errorf("s3: lifecycle rule %q: more than one transition to %s", r.ID, t.StorageClass)
+			}
+			warm, cold := prev, t
+			if transitionTiers[prev.StorageClass] > tier {
+				warm, cold = t, prev
+			}
+			if !cold.after(warm) {
+				return fmt.Errorf("s3: lifecycle rule %q: transition to %s must happen after transition to %s", r.ID, cold.StorageClass, warm.StorageClass)
+			}
+		}
+	}
+	return nil
+}
+
+// after reports whether t happens after u.
+func (t LifecycleTransition) after(u LifecycleTransition) bool {
+	if !t.Date.IsZero() {
+		return t.Date.After(u.Date)
+	}
+	return t.Days > u.Days
+}
+
+type lifecycleConfiguration struct {
+	XMLName xml.Name        `xml:"LifecycleConfiguration"`
+	Rules   []lifecycleRule `xml:"Rule"`
+}
+
+type lifecycleRule struct {
+	ID          string `xml:",omitempty"`
+	Prefix      string `xml:"Filter>Prefix"`
+	Status      string
+	Transitions []lifecycleTransition `xml:"Transition"`
+	Expiration  *lifecycleExpiration  `xml:",omitempty"`
+}
+
+type lifecycleTransition struct {
+	Date         string `xml:",omitempty"`
+	Days         string `xml:",omitempty"`
+	StorageClass StorageClass
+}
+
+type lifecycleExpiration struct {
+	Days int
+}
+
+// PutLifecycle replaces the lifecycle configuration of b with rules,
+// after checking that each of them is valid (see LifecycleRule.Validate).
+//
+// See http://docs.aws.amazon.com/AmazonS3/latest/API/RESTBucketPUTlifecycle.html
+// for details.
+func (b *Bucket) PutLifecycle(rules []LifecycleRule) error {
+	var config lifecycleConfiguration
+	for _, r := range rules {
+		if err := r.Validate(); err != nil {
+			return err
+		}
+		rule := lifecycleRule{
+			ID:     r.ID,
+			Prefix: r.Prefix,
+			Status: "Disabled",
+		}
+		if r.Enabled {
+			rule.Status = "Enabled"
+		}
+		for _, t := range r.Transitions {
+			transition := lifecycleTransition{StorageClass: t.StorageClass}
+			if t.Date.IsZero() {
+				transition.Days = strconv.Itoa(t.Days)
+			} else {
+				transition.Date = t.Date.UTC().Format("2006-01-02T15:04:05.000Z")
+			}
+			rule.Transitions = append(rule.Transitions, transition)
+		}
+		if r.ExpirationDays > 0 {
+			rule.Expiration = &lifecycleExpiration{Days: r.ExpirationDays}
+		}
+		config.Rules = append(config.Rules, rule)
+	}
+	data, err := xml.Marshal(&config)
+	if err != nil {
+		return err
+	}
+	headers := map[string][]string{
+		"Content-Length": {strconv.Itoa(len(data))},
+		"Content-MD5":    {MD5B64(data)},
+	}
+	req := &request{
+		method:  "PUT",
+		bucket:  b.Name,
+		path:    "/",
+		params:  map[string][]string{"lifecycle": {}},
+		headers: headers,
+		payload: getPayload(data),
+	}
+	for attempt := b.S3.startAttempts(); attempt.Next(); {
+		err = b.S3.query(req, nil)
+		if b.S3.shouldRetry(req.method, err) && attempt.HasNext() {
+			continue
+		}
+		return err
+	}
+	panic("unreachable")
+}
@@ -0,0 +1,134 @@
+package s3_test
+
+import (
+	"io/ioutil"
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/koofr/goamz/s3"
+)
+
+func (s *S) TestPutLifecycle(c *C) {
+	testServer.Response(200, nil, "")
+
+	b := s.s3.Bucket("bucket")
+	err := b.PutLifecycle([]s3.LifecycleRule{{
+		ID:      "archive",
+		Prefix:  "logs/",
+		Enabled: true,
+		Transitions: []s3.LifecycleTransition{
+			{Days: 30, StorageClass: s3.StandardIA},
+			{Days: 0, StorageClass: s3.IntelligentTiering},
+			{Days: 90, StorageClass: s3.Glacier},
+		},
+		ExpirationDays: 365,
+	}, {
+		Prefix: "tmp/",
+		Transitions: []s3.LifecycleTransition{
+			{Date: time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC), StorageClass: s3.DeepArchive},
+		},
+	}})
+	c.Assert(err, ErrorMatches, `s3: lifecycle rule "archive": transition to INTELLIGENT_TIERING must happen after transition to STANDARD_IA`)
+
+	err = b.PutLifecycle([]s3.LifecycleRule{{
+		ID:      "archive",
+		Prefix:  "logs/",
+		Enabled: true,
+		Transitions: []s3.LifecycleTransition{
+			{Days: 30, StorageClass: s3.StandardIA},
+			{Days: 90, StorageClass: s3.Glacier},
+		},
+		ExpirationDays: 365,
+	}, {
+		Prefix: "tmp/",
+		Transitions: []s3.LifecycleTransition{
+			{Date: time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC), StorageClass: s3.DeepArchive},
+		},
+	}})
+	c.Assert(err, IsNil)
+
+	req := testServer.WaitRequest()
+	c.Assert(req.Method, Equals, "PUT")
+	c.Assert(req.URL.Path, Equals, "/bucket/")
+	c.Assert(req.Form["lifecycle"], DeepEquals, []string{""})
+	data, err := ioutil.ReadAll(req.Body)
+	c.Assert(err, IsNil)
+	c.Assert(req.Header["Content-Md5"], DeepEquals, []string{s3.MD5B64(data)})
+	c.Assert(string(data), Equals, "<LifecycleConfiguration>"+
+		"<Rule><ID>archive</ID><Filter><Prefix>logs/</Prefix></Filter><Status>Enabled</Status>"+
+		"<Transition><Days>30</Days><StorageClass>STANDARD_IA</StorageClass></Transition>"+
+		"<Transition><Days>90</Days><StorageClass>GLACIER</StorageClass></Transition>"+
+		"<Expiration><Days>365</Days></Expiration></Rule>"+
+		"<Rule><Filter><Prefix>tmp/</Prefix></Filter><Status>Disabled</Status>"+
+		"<Transition><Date>2030-01-01T00:00:00.000Z</Date><StorageClass>DEEP_ARCHIVE</StorageClass></Transition></Rule>"+
+		"</LifecycleConfiguration>")
+}
+
+var lifecycleValidationTests = []struct {
+	transitions []s3.LifecycleTransition
+	expiration  int
+	err         string
+}{{
+	transitions: []s3.LifecycleTransition{{Days: 0, StorageClass: s3.Glacier}},
+}, {
+	transitions: []s3.LifecycleTransition{{Days: 0, StorageClass: s3.DeepArchive}},
+}, {
+	transitions: []s3.LifecycleTransition{{Days: 30, StorageClass: s3.OnezoneIA}, {Days: 60, StorageClass: s3.GlacierIR}},
+	expiration:  90,
+}, {
+	expiration: 1,
+}, {
+	err: `s3: lifecycle rule "rule": no transitions or expiration`,
+}, {
+	transitions: []s3.LifecycleTransition{{Days: 30, StorageClass: s3.Standard}},
+	err:         `s3: lifecycle rule "rule": cannot transition objects to storage class "STANDARD"`,
+}, {
+	transitions: []s3.LifecycleTransition{{Days: 30, StorageClass: s3.ReducedRedundancy}},
+	err:         `s3: lifecycle rule "rule": cannot transition objects to storage class "REDUCED_REDUNDANCY"`,
+}, {
+	transitions: []s3.LifecycleTransition{{Days: 29, StorageClass: s3.StandardIA}},
+	err:         `s3: lifecycle rule "rule": transition to STANDARD_IA requires at least 30 days, got 29`,
+}, {
+	transitions: []s3.LifecycleTransition{{Days: 10, StorageClass: s3.OnezoneIA}},
+	err:         `s3: lifecycle rule "rule": transition to ONEZONE_IA requires at least 30 days, got 10`,
+}, {
+	transitions: []s3.LifecycleTransition{{Days: -1, StorageClass: s3.Glacier}},
+	err:         `s3: lifecycle rule "rule": negative transition days: -1`,
+}, {
+	transitions: []s3.LifecycleTransition{{Days: 90, StorageClass: s3.Glacier}, {Days: 60, StorageClass: s3.DeepArchive}},
+	err:         `s3: lifecycle rule "rule": transition to DEEP_ARCHIVE must happen after transition to GLACIER`,
+}, {
+	transitions: []s3.LifecycleTransition{{Days: 30, StorageClass: s3.Glacier}, {Days: 60, StorageClass: s3.Glacier}},
+	err:         `s3: lifecycle rule "rule": more than one transition to GLACIER`,
+}, {
+	transitions: []s3.LifecycleTransition{{Days: 30, StorageClass: s3.Glacier}},
+	expiration:  30,
+	err:         `s3: lifecycle rule "rule": transition to GLACIER after 30 days is not before expiration after 30 days`,
+}, {
+	transitions: []s3.LifecycleTransition{{Date: time.Date(2030, 1, 1, 12, 0, 0, 0, time.UTC), StorageClass: s3.Glacier}},
+	err:         `s3: lifecycle rule "rule": transition date .* is not midnight UTC`,
+}, {
+	transitions: []s3.LifecycleTransition{
+		{Date: time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC), StorageClass: s3.StandardIA},
+		{Days: 90, StorageClass: s3.Glacier},
+	},
+	err: `s3: lifecycle rule "rule": transitions mix days and dates`,
+}}
+
+func (s *S) TestLifecycleRuleValidate(c *C) {
+	for i, t := range lifecycleValidationTests {
+		c.Logf("test %d", i)
+		rule := s3.LifecycleRule{
+			ID:             "rule",
+			Transitions:    t.transitions,
+			ExpirationDays: t.expiration,
+		}
+		err := rule.Validate()
+		if t.err == "" {
+			c.Check(err, IsNil)
+		} else {
+			c.Check(err, ErrorMatches, t.err)
+		}
+	}
+}
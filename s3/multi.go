@@ -1,11 +1,21 @@
 package s3
 
 import (
+	"context"
+	"encoding/base64"
+	"encoding/binary"
 	"encoding/xml"
 	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"hash/crc64"
 	"io"
+	"net/http"
 	"sort"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 )
 
@@ -15,12 +25,80 @@ import (
 // After all parts have been sent, the upload must be explicitly
 // completed by calling Complete with the list of parts.
 //
+// A Multi holds no state that changes while parts are uploaded, so it
+// may be shared by goroutines uploading parts concurrently, as long as
+// each part number is sent by a single goroutine.
+//
 // See http://goo.gl/vJfTG for an overview of multipart uploads.
 type Multi struct {
 	Bucket    *Bucket
 	Key       string
 	UploadId  string
 	Initiated *time.Time
+	// Initiator and Owner are the user who initiated the upload and
+	// the owner of the object being uploaded, as reported by ListMulti.
+	Initiator    Owner
+	Owner        Owner
+	StorageClass StorageClass
+	// AbortDate and AbortRuleID are the time after which the upload
+	// will be aborted by a lifecycle rule of the bucket, and the ID of
+	// that rule, as reported by InitMulti. They are empty otherwise.
+	AbortDate   time.Time `xml:"-"`
+	AbortRuleID string    `xml:"-"`
+	// ChecksumType and ChecksumAlgorithm are the type and algorithm
+	// of the checksums the upload was initiated with, if any (see
+	// MultiOptions).
+	ChecksumType      ChecksumType
+	ChecksumAlgorithm ChecksumAlgorithm
+}
+
+// ChecksumType selects how S3 checksums objects uploaded in parts.
+type ChecksumType string
+
+const (
+	// ChecksumComposite checksums the object with a checksum of the
+	// checksums of its parts, followed by a dash and the number of
+	// parts, much like multipart ETags.
+	ChecksumComposite = ChecksumType("COMPOSITE")
+	// ChecksumFullObject checksums the object as a whole, as if it
+	// was uploaded in a single request.
+	ChecksumFullObject = ChecksumType("FULL_OBJECT")
+)
+
+// ChecksumAlgorithm selects the algorithm of the checksums S3 verifies
+// objects uploaded in parts with.
+type ChecksumAlgorithm string
+
+const (
+	ChecksumCRC32C    = ChecksumAlgorithm("CRC32C")
+	ChecksumCRC64NVME = ChecksumAlgorithm("CRC64NVME")
+)
+
+// MultiOptions holds optional settings for multipart uploads.
+type MultiOptions struct {
+	// ChecksumType, if set, makes S3 verify the upload with checksums
+	// of the given type. Parts are then sent with their checksum, and
+	// Complete sends the checksums consistently with the type: the
+	// checksum of each part for ChecksumComposite, and also the
+	// checksum of the whole object, derived from those of the parts,
+	// for ChecksumFullObject.
+	ChecksumType ChecksumType
+	// ChecksumAlgorithm is the algorithm of the checksums. It defaults
+	// to ChecksumCRC32C. ChecksumCRC64NVME only supports
+	// ChecksumFullObject, which is then the default type.
+	ChecksumAlgorithm ChecksumAlgorithm
+	// Meta holds user-defined metadata to store with the object, sent
+	// as x-amz-meta-* headers.
+	Meta map[string][]string
+	// Tags holds the tags to store with the object (see Options.Tags).
+	Tags map[string]string
+	// StorageClass, ServerSideEncryption, SSEKMSKeyID and Grants are
+	// applied to the assembled object, as with the Options of a single
+	// upload.
+	StorageClass         StorageClass
+	ServerSideEncryption string
+	SSEKMSKeyID          string
+	Grants               Grants
 }
 
 // That's the default. Here just for testing.
@@ -47,13 +125,27 @@ type listMultiResp struct {
 //
 // See http://goo.gl/ePioY for details.
 func (b *Bucket) ListMulti(prefix, delim string) (multis []*Multi, prefixes []string, err error) {
+	return b.ListMultiWithOptions(prefix, delim, ListMultiOptions{})
+}
+
+// ListMultiOptions holds optional settings for listings of multipart
+// uploads.
+type ListMultiOptions struct {
+	// InitiatorID, if set, leaves out the uploads initiated by other
+	// users, as S3 can't filter them itself.
+	InitiatorID string
+}
+
+// ListMultiWithOptions is like ListMulti but also applies the given
+// listing options.
+func (b *Bucket) ListMultiWithOptions(prefix, delim string, options ListMultiOptions) (multis []*Multi, prefixes []string, err error) {
 	params := map[string][]string{
 		"uploads":     {},
 		"max-uploads": {strconv.FormatInt(int64(listMultiMax), 10)},
 		"prefix":      {prefix},
 		"delimiter":   {delim},
 	}
-	for attempt := attempts.Start(); attempt.Next(); {
+	for attempt := b.S3.startAttempts(); attempt.Next(); {
 		req := &request{
 			method: "GET",
 			bucket: b.Name,
@@ -61,7 +153,7 @@ func (b *Bucket) ListMulti(prefix, delim string) (multis []*Multi, prefixes []st
 		}
 		var resp listMultiResp
 		err := b.S3.query(req, &resp)
-		if shouldRetry(err) && attempt.HasNext() {
+		if b.S3.shouldRetry(req.method, err) && attempt.HasNext() {
 			continue
 		}
 		if err != nil {
@@ -69,6 +161,9 @@ func (b *Bucket) ListMulti(prefix, delim string) (multis []*Multi, prefixes []st
 		}
 		for i := range resp.Upload {
 			multi := &resp.Upload[i]
+			if options.InitiatorID != "" && multi.Initiator.ID != options.InitiatorID {
+				continue
+			}
 			multi.Bucket = b
 			multis = append(multis, multi)
 		}
@@ -78,11 +173,74 @@ func (b *Bucket) ListMulti(prefix, delim string) (multis []*Multi, prefixes []st
 		}
 		params["key-marker"] = []string{resp.NextKeyMarker}
 		params["upload-id-marker"] = []string{resp.NextUploadIdMarker}
-		attempt = attempts.Start() // Last request worked.
+		attempt = b.S3.startAttempts() // Last request worked.
 	}
 	panic("unreachable")
 }
 
+// MultiUsage describes the storage held by an unfinished multipart
+// upload.
+type MultiUsage struct {
+	Multi *Multi
+	// Parts is the number of parts uploaded so far.
+	Parts int
+	// Size is the total size of the uploaded parts in bytes.
+	Size int64
+}
+
+// ListMultiUsage is like ListMulti, but also lists the parts of each
+// upload to report how many parts it has and how many bytes they hold,
+// which allows estimating the storage used by unfinished uploads. Parts
+// are listed for at most concurrency uploads at a time. Uploads completed
+// or aborted before their parts are listed are left out.
+func (b *Bucket) ListMultiUsage(prefix, delim string, concurrency int) (usage []MultiUsage, prefixes []string, err error) {
+	if concurrency < 1 {
+		return nil, nil, fmt.Errorf("bad concurrency: %d", concurrency)
+	}
+	multis, prefixes, err := b.ListMulti(prefix, delim)
+	if err != nil {
+		return nil, nil, err
+	}
+	usage = make([]MultiUsage, len(multis))
+	errs := make([]error, len(multis))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, m := range multis {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, m *Multi) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			parts, err := m.ListParts()
+			if hasCode(err, "NoSuchUpload") {
+				return
+			}
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			usage[i].Multi = m
+			usage[i].Parts = len(parts)
+			for _, p := range parts {
+				usage[i].Size += p.Size
+			}
+		}(i, m)
+	}
+	wg.Wait()
+	listed := usage[:0]
+	for i, err := range errs {
+		if err != nil {
+			return nil, nil, err
+		}
+		if usage[i].Multi != nil {
+			listed = append(listed, usage[i])
+		}
+	}
+	return listed, prefixes, nil
+}
+
 // Multi returns a multipart upload handler for the provided key
 // inside b. If a multipart upload exists for key, it is returned,
 // otherwise a new multipart upload is initiated with contType and perm.
@@ -104,11 +262,51 @@ func (b *Bucket) Multi(key, contType string, perm ACL) (*Multi, error) {
 //
 // See http://goo.gl/XP8kL for details.
 func (b *Bucket) InitMulti(key string, contType string, perm ACL) (*Multi, error) {
+	return b.InitMultiWithOptions(key, contType, perm, MultiOptions{})
+}
+
+// InitMultiWithOptions is like InitMulti but also applies the given
+// multipart upload options.
+func (b *Bucket) InitMultiWithOptions(key string, contType string, perm ACL, options MultiOptions) (*Multi, error) {
 	headers := map[string][]string{
 		"Content-Type":   {contType},
 		"Content-Length": {"0"},
 		"x-amz-acl":      {string(perm)},
 	}
+	switch options.ChecksumAlgorithm {
+	case "":
+		if options.ChecksumType != "" {
+			options.ChecksumAlgorithm = ChecksumCRC32C
+		}
+	case ChecksumCRC32C:
+	case ChecksumCRC64NVME:
+		if options.ChecksumType == "" {
+			options.ChecksumType = ChecksumFullObject
+		}
+		if options.ChecksumType != ChecksumFullObject {
+			return nil, fmt.Errorf("bad checksum type for %s: %q", options.ChecksumAlgorithm, options.ChecksumType)
+		}
+	default:
+		return nil, fmt.Errorf("bad checksum algorithm: %q", options.ChecksumAlgorithm)
+	}
+	switch options.ChecksumType {
+	case "":
+	case ChecksumComposite, ChecksumFullObject:
+		headers["x-amz-checksum-algorithm"] = []string{string(options.ChecksumAlgorithm)}
+		headers["x-amz-checksum-type"] = []string{string(options.ChecksumType)}
+	default:
+		return nil, fmt.Errorf("bad checksum type: %q", options.ChecksumType)
+	}
+	for name, values := range options.Meta {
+		headers["x-amz-meta-"+strings.ToLower(name)] = values
+	}
+	if len(options.Tags) > 0 {
+		if err := ValidateTags(options.Tags); err != nil {
+			return nil, err
+		}
+		headers["x-amz-tagging"] = []string{encodeTags(options.Tags)}
+	}
+	addObjectHeaders(headers, options.StorageClass, options.ServerSideEncryption, options.SSEKMSKeyID, options.Grants)
 	params := map[string][]string{
 		"uploads": {},
 	}
@@ -120,27 +318,47 @@ func (b *Bucket) InitMulti(key string, contType string, perm ACL) (*Multi, error
 		params:  params,
 	}
 	var err error
+	var header http.Header
 	var resp struct {
 		UploadId string `xml:"UploadId"`
 	}
-	for attempt := attempts.Start(); attempt.Next(); {
-		err = b.S3.query(req, &resp)
-		if !shouldRetry(err) {
+	for attempt := b.S3.startAttempts(); attempt.Next(); {
+		header, err = b.S3.queryHeader(req, &resp)
+		if !b.S3.shouldRetry(req.method, err) {
 			break
 		}
 	}
 	if err != nil {
 		return nil, err
 	}
-	return &Multi{Bucket: b, Key: key, UploadId: resp.UploadId}, nil
+	abortDate, _ := time.Parse(time.RFC1123, header.Get("x-amz-abort-date"))
+	return &Multi{
+		Bucket:            b,
+		Key:               key,
+		UploadId:          resp.UploadId,
+		ChecksumType:      options.ChecksumType,
+		ChecksumAlgorithm: options.ChecksumAlgorithm,
+		AbortDate:         abortDate,
+		AbortRuleID:       header.Get("x-amz-abort-rule-id"),
+	}, nil
 }
 
 // PutPartHash sends part n of the multipart upload, reading all the content from r
 // with partSize and MD5 base64 encoded hash.
 // Each part, except for the last one, must be at least 5MB in size.
+// It is safe to call PutPartHash concurrently for distinct part numbers.
+// As r is seekable, a part rejected with BadDigest is sent once more
+// before the error is returned, unless the RetryPolicy of the client
+// doesn't retry PUT requests.
 //
 // See http://goo.gl/pqZer for details.
 func (m *Multi) PutPartHash(n int, r io.ReadSeeker, partSize int64, md5b64 string, sha256hex string) (Part, error) {
+	return m.PutPartHashContext(context.Background(), n, r, partSize, md5b64, sha256hex)
+}
+
+// PutPartHashContext is like PutPartHash, but the upload is abandoned,
+// and not retried, once ctx is done.
+func (m *Multi) PutPartHashContext(ctx context.Context, n int, r io.ReadSeeker, partSize int64, md5b64 string, sha256hex string) (Part, error) {
 	headers := map[string][]string{
 		"Content-Length": {strconv.FormatInt(partSize, 10)},
 		"Content-MD5":    {md5b64},
@@ -149,7 +367,27 @@ func (m *Multi) PutPartHash(n int, r io.ReadSeeker, partSize int64, md5b64 strin
 		"uploadId":   {m.UploadId},
 		"partNumber": {strconv.FormatInt(int64(n), 10)},
 	}
-	for attempt := attempts.Start(); attempt.Next(); {
+	if m.ChecksumType != "" {
+		var h hash.Hash = crc32.New(crc32cTable)
+		name := "x-amz-checksum-crc32c"
+		if m.ChecksumAlgorithm == ChecksumCRC64NVME {
+			h = crc64.New(crc64NVMETable)
+			name = "x-amz-checksum-crc64nvme"
+		}
+		// The checksum must cover the bytes sent, which start at the
+		// beginning of r.
+		_, err := r.Seek(0, 0)
+		if err != nil {
+			return Part{}, err
+		}
+		_, err = io.CopyN(h, r, partSize)
+		if err != nil {
+			return Part{}, err
+		}
+		headers[name] = []string{base64.StdEncoding.EncodeToString(h.Sum(nil))}
+	}
+	badDigest := false
+	for attempt := m.Bucket.S3.startAttempts(); attempt.Next(); {
 		_, err := r.Seek(0, 0)
 		if err != nil {
 			return Part{}, err
@@ -165,13 +403,24 @@ func (m *Multi) PutPartHash(n int, r io.ReadSeeker, partSize int64, md5b64 strin
 				md5b64:    md5b64,
 				sha256hex: sha256hex,
 			},
+			ctx: ctx,
 		}
+		m.Bucket.S3.applyPayloadHash(req, partSize)
 		err = m.Bucket.S3.prepare(req)
 		if err != nil {
 			return Part{}, err
 		}
 		hresp, err := m.Bucket.S3.run(req)
-		if shouldRetry(err) && attempt.HasNext() {
+		if err != nil && ctx.Err() != nil {
+			return Part{}, ctx.Err()
+		}
+		// A BadDigest may be caused by the body being corrupted in
+		// transit, so the part is sent once more if PUT requests may
+		// be retried at all, but a second one in a row means the hash
+		// or the content is wrong.
+		retryDigest := hasCode(err, "BadDigest") && !badDigest && m.Bucket.S3.retriesMethod(req.method)
+		badDigest = hasCode(err, "BadDigest")
+		if (m.Bucket.S3.shouldRetry(req.method, err) || retryDigest) && attempt.HasNext() {
 			continue
 		}
 		if err != nil {
@@ -182,15 +431,73 @@ func (m *Multi) PutPartHash(n int, r io.ReadSeeker, partSize int64, md5b64 strin
 		if etag == "" {
 			return Part{}, errors.New("part upload succeeded with no ETag")
 		}
-		return Part{n, etag, partSize}, nil
+		part := Part{
+			N:                 n,
+			ETag:              etag,
+			Size:              partSize,
+			ChecksumCRC32C:    hresp.Header.Get("x-amz-checksum-crc32c"),
+			ChecksumCRC64NVME: hresp.Header.Get("x-amz-checksum-crc64nvme"),
+		}
+		if sent, ok := headers["x-amz-checksum-crc32c"]; ok && part.ChecksumCRC32C == "" {
+			part.ChecksumCRC32C = sent[0]
+		}
+		if sent, ok := headers["x-amz-checksum-crc64nvme"]; ok && part.ChecksumCRC64NVME == "" {
+			part.ChecksumCRC64NVME = sent[0]
+		}
+		return part, nil
 	}
 	panic("unreachable")
 }
 
+// PartCopyOptions holds the optional settings of PutPartCopy.
+type PartCopyOptions struct {
+	// IfMatch, if set, makes the part copy fail unless the ETag of the
+	// source object is IfMatch. Copying every part of an object with
+	// the same IfMatch ensures they all come from the same version.
+	IfMatch string
+}
+
+// PutPartCopy sends part n of the multipart upload by copying the bytes
+// from first to last, inclusive, of the object at source in b
+// server-side, without transferring them.
+//
+// See https://docs.aws.amazon.com/AmazonS3/latest/API/API_UploadPartCopy.html for details.
+func (m *Multi) PutPartCopy(n int, b *Bucket, source string, first, last int64, options PartCopyOptions) (Part, error) {
+	headers := map[string][]string{
+		"x-amz-copy-source":       {b.copySource(source)},
+		"x-amz-copy-source-range": {fmt.Sprintf("bytes=%d-%d", first, last)},
+	}
+	if options.IfMatch != "" {
+		headers["x-amz-copy-source-if-match"] = []string{options.IfMatch}
+	}
+	params := map[string][]string{
+		"uploadId":   {m.UploadId},
+		"partNumber": {strconv.FormatInt(int64(n), 10)},
+	}
+	req := &request{
+		method:  "PUT",
+		bucket:  m.Bucket.Name,
+		path:    m.Key,
+		headers: headers,
+		params:  params,
+	}
+	var result CopyObjectResult
+	_, err := m.Bucket.S3.copyQuery(req, &result)
+	if err != nil {
+		return Part{}, err
+	}
+	return Part{N: n, ETag: result.ETag, Size: last - first + 1}, nil
+}
+
 type Part struct {
 	N    int `xml:"PartNumber"`
 	ETag string
 	Size int64
+	// ChecksumCRC32C and ChecksumCRC64NVME are the base64 encoded
+	// checksums of the part, if any. When set, Complete sends them
+	// along so S3 can verify the part before assembling the object.
+	ChecksumCRC32C    string
+	ChecksumCRC64NVME string
 }
 
 type partSlice []Part
@@ -213,50 +520,203 @@ var listPartsMax = 1000
 //
 // See http://goo.gl/ePioY for details.
 func (m *Multi) ListParts() ([]Part, error) {
+	var parts partSlice
+	err := m.ListPartsEachContext(context.Background(), false, func(part Part) error {
+		parts = append(parts, part)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Sort(parts)
+	return parts, nil
+}
+
+// ListPartsEach calls fn for each previously uploaded part in m, ordered
+// by part number. Unlike ListParts, it only holds one page of the listing
+// at a time, which bounds memory for uploads with many parts. If fn
+// returns an error, the listing stops and the error is returned.
+func (m *Multi) ListPartsEach(fn func(part Part) error) error {
+	return m.ListPartsEachContext(context.Background(), true, fn)
+}
+
+// ListPartsEachContext is like ListPartsEach, but the listing fails
+// with the error of ctx once ctx is done, as when its deadline passes.
+// The parts of each page are sorted by part number only if sorted is
+// set. S3 lists them in order, so sorting is only needed with stores
+// that may not.
+func (m *Multi) ListPartsEachContext(ctx context.Context, sorted bool, fn func(part Part) error) error {
+	marker := 0
+	for {
+		page, err := m.listPartsPage(ctx, marker, listPartsMax)
+		if err != nil {
+			return err
+		}
+		if sorted {
+			sort.Sort(partSlice(page.Parts))
+		}
+		for _, part := range page.Parts {
+			if err := fn(part); err != nil {
+				return err
+			}
+		}
+		if !page.IsTruncated {
+			return nil
+		}
+		marker = page.NextPartNumberMarker
+	}
+}
+
+// PartsPage is a page of the parts of a multipart upload, as returned by
+// ListPartsPage.
+type PartsPage struct {
+	Parts       []Part
+	IsTruncated bool
+	// NextPartNumberMarker is the marker to pass to ListPartsPage to
+	// get the next page when IsTruncated is set.
+	NextPartNumberMarker int
+}
+
+// ListPartsPage returns up to maxParts of the parts uploaded in m whose
+// number is greater than partNumberMarker, ordered by part number. A
+// listing is started with a zero partNumberMarker, and continued with
+// the NextPartNumberMarker of the last page as long as it is truncated.
+// As the marker is a plain number, it can be persisted to resume the
+// listing of an upload with many parts later. If maxParts isn't
+// positive, S3 returns up to 1000 parts.
+func (m *Multi) ListPartsPage(partNumberMarker int, maxParts int) (*PartsPage, error) {
+	if maxParts <= 0 {
+		maxParts = listPartsMax
+	}
+	return m.listPartsPage(context.Background(), partNumberMarker, maxParts)
+}
+
+func (m *Multi) listPartsPage(ctx context.Context, marker int, max int) (*PartsPage, error) {
 	params := map[string][]string{
 		"uploadId":  {m.UploadId},
-		"max-parts": {strconv.FormatInt(int64(listPartsMax), 10)},
+		"max-parts": {strconv.Itoa(max)},
 	}
-	var parts partSlice
-	for attempt := attempts.Start(); attempt.Next(); {
+	if marker > 0 {
+		params["part-number-marker"] = []string{strconv.Itoa(marker)}
+	}
+	for attempt := m.Bucket.S3.startAttempts(); attempt.Next(); {
 		req := &request{
 			method: "GET",
 			bucket: m.Bucket.Name,
 			path:   m.Key,
 			params: params,
+			ctx:    ctx,
 		}
 		var resp listPartsResp
 		err := m.Bucket.S3.query(req, &resp)
-		if shouldRetry(err) && attempt.HasNext() {
+		if err != nil && ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if m.Bucket.S3.shouldRetry(req.method, err) && attempt.HasNext() {
 			continue
 		}
 		if err != nil {
 			return nil, err
 		}
-		parts = append(parts, resp.Part...)
-		if !resp.IsTruncated {
-			sort.Sort(parts)
-			return parts, nil
+		page := &PartsPage{Parts: resp.Part, IsTruncated: resp.IsTruncated}
+		if resp.IsTruncated {
+			page.NextPartNumberMarker, err = strconv.Atoi(resp.NextPartNumberMarker)
+			if err != nil {
+				return nil, fmt.Errorf("bad part number marker: %q", resp.NextPartNumberMarker)
+			}
 		}
-		params["part-number-marker"] = []string{resp.NextPartNumberMarker}
-		attempt = attempts.Start() // Last request worked.
+		return page, nil
 	}
 	panic("unreachable")
 }
 
+// Limits of multipart uploads.
+const (
+	// MaxParts is the largest number of parts of a multipart upload.
+	MaxParts = 10000
+	// MinPartSize is the smallest size of all but the last part of a
+	// multipart upload.
+	MinPartSize = 5 << 20
+)
+
+// minPartSize is the MinPartSize enforced by PlanMultipart. Tests lower
+// it to upload small parts.
+var minPartSize int64 = MinPartSize
+
+// PlanMultipart returns the number of parts of partSize bytes, but the
+// last, in which totalSize bytes are uploaded. It fails if that takes
+// more than MaxParts parts, or if partSize is smaller than MinPartSize
+// while more than one part is needed, so that a bad part size is found
+// before any data is sent rather than when S3 rejects the upload. An
+// empty upload takes a single part.
+func PlanMultipart(totalSize, partSize int64) (numParts int, err error) {
+	if totalSize < 0 {
+		return 0, fmt.Errorf("s3: bad upload size: %d", totalSize)
+	}
+	if partSize < 1 {
+		return 0, fmt.Errorf("s3: bad part size: %d", partSize)
+	}
+	n := (totalSize + partSize - 1) / partSize
+	if n <= 1 {
+		return 1, nil
+	}
+	if partSize < minPartSize {
+		return 0, fmt.Errorf("s3: part size %d is below the minimum of %d bytes", partSize, minPartSize)
+	}
+	if n > MaxParts {
+		return 0, fmt.Errorf("s3: uploading %d bytes in parts of %d bytes takes %d parts, more than the maximum of %d", totalSize, partSize, n, MaxParts)
+	}
+	return int(n), nil
+}
+
 type ReaderAtSeeker interface {
 	io.ReaderAt
 	io.ReadSeeker
 }
 
+// PutAllReaderAt sends the size bytes of r as the parts of m, each of
+// partSize bytes but the last, and returns them ordered by part number.
+// Each part is read through its own io.SectionReader of r, so the
+// content is neither copied nor shared between parts, and it is read
+// twice: once to hash it and once to send it. This suits sources such
+// as files or memory-mapped data. The parts are planned with
+// PlanMultipart before any of them is sent.
+func (m *Multi) PutAllReaderAt(r io.ReaderAt, size, partSize int64) ([]Part, error) {
+	_, err := PlanMultipart(size, partSize)
+	if err != nil {
+		return nil, err
+	}
+	var parts []Part
+	// An empty r is sent as a single empty part.
+	for n, offset := 1, int64(0); n == 1 || offset < size; n, offset = n+1, offset+partSize {
+		length := partSize
+		if size-offset < length {
+			length = size - offset
+		}
+		section := io.NewSectionReader(r, offset, length)
+		md5b64, sha256hex, err := hashReader(section)
+		if err != nil {
+			return nil, err
+		}
+		part, err := m.PutPartHash(n, section, length, md5b64, sha256hex)
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, part)
+	}
+	return parts, nil
+}
+
 type completeUpload struct {
 	XMLName xml.Name      `xml:"CompleteMultipartUpload"`
 	Parts   completeParts `xml:"Part"`
 }
 
 type completePart struct {
-	PartNumber int
-	ETag       string
+	PartNumber        int
+	ETag              string
+	ChecksumCRC32C    string `xml:",omitempty"`
+	ChecksumCRC64NVME string `xml:",omitempty"`
 }
 
 type completeParts []completePart
@@ -268,24 +728,161 @@ func (p completeParts) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
 // Complete assembles the given previously uploaded parts into the
 // final object. This operation may take several minutes.
 //
+// If any of the parts carries a ChecksumCRC32C, the per-part checksums
+// are sent along with a composite checksum type, and S3 rejects the
+// assembly if they don't match the uploaded data. For uploads initiated
+// with ChecksumFullObject, the checksum of the whole object is sent
+// instead, which requires all the parts to carry their checksum.
+//
 // See http://goo.gl/2Z7Tw for details.
 func (m *Multi) Complete(parts []Part) error {
+	_, err := m.CompleteWithResult(parts)
+	return err
+}
+
+// CompleteResult holds the results of a CompleteWithResult operation.
+type CompleteResult struct {
+	Location    string
+	Bucket      string
+	Key         string
+	ETag        string
+	WriteResult `xml:"-"`
+}
+
+// CompleteOptions holds optional settings for CompleteWithOptions.
+type CompleteOptions struct {
+	// VerifyParts checks the parts with VerifyParts before completing
+	// the upload, so that missing or changed parts are reported in a
+	// *PartsError rather than rejected by S3 with InvalidPart.
+	VerifyParts bool
+}
+
+// CompleteWithOptions is like CompleteWithResult with the given options.
+func (m *Multi) CompleteWithOptions(parts []Part, options CompleteOptions) (*CompleteResult, error) {
+	if options.VerifyParts {
+		if err := m.VerifyParts(parts); err != nil {
+			return nil, err
+		}
+	}
+	return m.CompleteWithResult(parts)
+}
+
+// ErrMissingPart is matched by errors.Is against a *PartsError that
+// reports parts that weren't uploaded.
+var ErrMissingPart = errors.New("s3: multipart upload part is missing")
+
+// PartsError is returned by VerifyParts when some of the parts are not
+// those uploaded. It matches ErrMissingPart if parts are missing and
+// ErrETagMismatch if parts have a different ETag.
+type PartsError struct {
+	// Missing holds the numbers of the parts that weren't uploaded.
+	Missing []int
+	// Mismatched holds the numbers of the parts uploaded with a
+	// different ETag.
+	Mismatched []int
+}
+
+func (e *PartsError) Error() string {
+	var problems []string
+	if len(e.Missing) > 0 {
+		problems = append(problems, "missing parts "+joinPartNumbers(e.Missing))
+	}
+	if len(e.Mismatched) > 0 {
+		problems = append(problems, "ETag mismatch for parts "+joinPartNumbers(e.Mismatched))
+	}
+	return "s3: invalid multipart upload parts: " + strings.Join(problems, "; ")
+}
+
+// Unwrap returns ErrMissingPart and ErrETagMismatch as they apply to e.
+func (e *PartsError) Unwrap() []error {
+	var errs []error
+	if len(e.Missing) > 0 {
+		errs = append(errs, ErrMissingPart)
+	}
+	if len(e.Mismatched) > 0 {
+		errs = append(errs, ErrETagMismatch)
+	}
+	return errs
+}
+
+func joinPartNumbers(ns []int) string {
+	s := make([]string, len(ns))
+	for i, n := range ns {
+		s[i] = strconv.Itoa(n)
+	}
+	return strings.Join(s, ", ")
+}
+
+// VerifyParts checks with ListParts that each of parts was uploaded to m
+// with the same ETag, and returns a *PartsError listing the parts that
+// weren't, in order, if any.
+func (m *Multi) VerifyParts(parts []Part) error {
+	uploaded := make(map[int]string)
+	err := m.ListPartsEach(func(part Part) error {
+		uploaded[part.N] = part.ETag
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	sorted := append(partSlice(nil), parts...)
+	sort.Sort(sorted)
+	e := &PartsError{}
+	for _, p := range sorted {
+		etag, ok := uploaded[p.N]
+		switch {
+		case !ok:
+			e.Missing = append(e.Missing, p.N)
+		case strings.Trim(etag, `"`) != strings.Trim(p.ETag, `"`):
+			e.Mismatched = append(e.Mismatched, p.N)
+		}
+	}
+	if e.Missing != nil || e.Mismatched != nil {
+		return e
+	}
+	return nil
+}
+
+// CompleteWithResult is like Complete but also returns the details
+// reported by S3.
+func (m *Multi) CompleteWithResult(parts []Part) (*CompleteResult, error) {
 	params := map[string][]string{
 		"uploadId": {m.UploadId},
 	}
 	c := completeUpload{}
+	checksums := false
 	for _, p := range parts {
-		c.Parts = append(c.Parts, completePart{p.N, p.ETag})
+		c.Parts = append(c.Parts, completePart{p.N, p.ETag, p.ChecksumCRC32C, p.ChecksumCRC64NVME})
+		if p.ChecksumCRC32C != "" || p.ChecksumCRC64NVME != "" {
+			checksums = true
+		}
 	}
 	sort.Sort(c.Parts)
 	data, err := xml.Marshal(&c)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	headers := map[string][]string{
 		"Content-Length": {strconv.FormatInt(int64(len(data)), 10)},
 	}
-	for attempt := attempts.Start(); attempt.Next(); {
+	if m.ChecksumType == ChecksumFullObject && m.ChecksumAlgorithm == ChecksumCRC64NVME {
+		checksum, err := fullObjectCRC64NVME(parts)
+		if err != nil {
+			return nil, err
+		}
+		headers["x-amz-checksum-type"] = []string{string(ChecksumFullObject)}
+		headers["x-amz-checksum-crc64nvme"] = []string{checksum}
+	} else if m.ChecksumType == ChecksumFullObject {
+		checksum, err := fullObjectCRC32C(parts)
+		if err != nil {
+			return nil, err
+		}
+		headers["x-amz-checksum-type"] = []string{string(ChecksumFullObject)}
+		headers["x-amz-checksum-crc32c"] = []string{checksum}
+	} else if checksums {
+		headers["x-amz-checksum-type"] = []string{string(ChecksumComposite)}
+	}
+	for attempt := m.Bucket.S3.startAttempts(); attempt.Next(); {
 		req := &request{
 			method:  "POST",
 			bucket:  m.Bucket.Name,
@@ -294,15 +891,55 @@ func (m *Multi) Complete(parts []Part) error {
 			params:  params,
 			payload: getPayload(data),
 		}
-		err := m.Bucket.S3.query(req, nil)
-		if shouldRetry(err) && attempt.HasNext() {
+		result := &CompleteResult{}
+		header, err := m.Bucket.S3.queryHeader(req, result)
+		if m.Bucket.S3.shouldRetry(req.method, err) && attempt.HasNext() {
 			continue
 		}
-		return err
+		if err != nil {
+			return nil, err
+		}
+		result.WriteResult = writeResultFromHeaders(header)
+		return result, nil
 	}
 	panic("unreachable")
 }
 
+// fullObjectCRC32C returns the base64 encoded CRC32C checksum of the
+// object made of parts, derived from the checksums of the parts.
+func fullObjectCRC32C(parts []Part) (string, error) {
+	sorted := append(partSlice(nil), parts...)
+	sort.Sort(sorted)
+	var crc uint32
+	for _, p := range sorted {
+		sum, err := base64.StdEncoding.DecodeString(p.ChecksumCRC32C)
+		if err != nil || len(sum) != 4 {
+			return "", fmt.Errorf("part %d has no valid CRC32C checksum: %q", p.N, p.ChecksumCRC32C)
+		}
+		crc = crc32Combine(crc32.Castagnoli, crc, binary.BigEndian.Uint32(sum), p.Size)
+	}
+	var sum [4]byte
+	binary.BigEndian.PutUint32(sum[:], crc)
+	return base64.StdEncoding.EncodeToString(sum[:]), nil
+}
+
+// fullObjectCRC64NVME is like fullObjectCRC32C for CRC64NVME checksums.
+func fullObjectCRC64NVME(parts []Part) (string, error) {
+	sorted := append(partSlice(nil), parts...)
+	sort.Sort(sorted)
+	var crc uint64
+	for _, p := range sorted {
+		sum, err := base64.StdEncoding.DecodeString(p.ChecksumCRC64NVME)
+		if err != nil || len(sum) != 8 {
+			return "", fmt.Errorf("part %d has no valid CRC64NVME checksum: %q", p.N, p.ChecksumCRC64NVME)
+		}
+		crc = crc64Combine(crc64NVMEPoly, crc, binary.BigEndian.Uint64(sum), p.Size)
+	}
+	var sum [8]byte
+	binary.BigEndian.PutUint64(sum[:], crc)
+	return base64.StdEncoding.EncodeToString(sum[:]), nil
+}
+
 // Abort deletes an unifinished multipart upload and any previously
 // uploaded parts for it.
 //
@@ -322,7 +959,7 @@ func (m *Multi) Abort() error {
 	params := map[string][]string{
 		"uploadId": {m.UploadId},
 	}
-	for attempt := attempts.Start(); attempt.Next(); {
+	for attempt := m.Bucket.S3.startAttempts(); attempt.Next(); {
 		req := &request{
 			method: "DELETE",
 			bucket: m.Bucket.Name,
@@ -330,10 +967,36 @@ func (m *Multi) Abort() error {
 			params: params,
 		}
 		err := m.Bucket.S3.query(req, nil)
-		if shouldRetry(err) && attempt.HasNext() {
+		if m.Bucket.S3.shouldRetry(req.method, err) && attempt.HasNext() {
 			continue
 		}
 		return err
 	}
 	panic("unreachable")
 }
+
+// AbortAllMulti aborts all unfinished multipart uploads for exactly key
+// in b, which is useful for cleaning up after uploads that stalled when
+// their UploadId is unknown. There may be several such uploads for the
+// same key. It returns the number of uploads aborted; uploads that are
+// completed or aborted meanwhile are not counted.
+func (b *Bucket) AbortAllMulti(key string) (aborted int, err error) {
+	multis, _, err := b.ListMulti(key, "")
+	if err != nil {
+		return 0, err
+	}
+	for _, m := range multis {
+		if m.Key != key {
+			continue
+		}
+		err := m.Abort()
+		if hasCode(err, "NoSuchUpload") {
+			continue
+		}
+		if err != nil {
+			return aborted, err
+		}
+		aborted++
+	}
+	return aborted, nil
+}
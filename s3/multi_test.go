@@ -2,9 +2,18 @@ package s3_test
 
 import (
 	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/base64"
 	"encoding/xml"
+	"errors"
+	"fmt"
+	"hash/crc32"
 	"io"
 	"io/ioutil"
+	"strings"
+	"sync"
+	"time"
 
 	. "gopkg.in/check.v1"
 
@@ -29,6 +38,35 @@ func (s *S) TestInitMulti(c *C) {
 	c.Assert(multi.UploadId, Matches, "JNbR_[A-Za-z0-9.]+QQ--")
 }
 
+func (s *S) TestInitMultiAbortDate(c *C) {
+	testServer.Response(200, map[string]string{
+		"x-amz-abort-date":    "Wed, 28 Oct 2015 00:00:00 GMT",
+		"x-amz-abort-rule-id": "abort-incomplete-7-days",
+	}, InitMultiResultDump)
+
+	b := s.s3.Bucket("sample")
+
+	multi, err := b.InitMulti("multi", "text/plain", s3.Private)
+	c.Assert(err, IsNil)
+	testServer.WaitRequest()
+
+	c.Assert(multi.AbortDate.Equal(time.Date(2015, 10, 28, 0, 0, 0, 0, time.UTC)), Equals, true)
+	c.Assert(multi.AbortRuleID, Equals, "abort-incomplete-7-days")
+}
+
+func (s *S) TestInitMultiNoAbortDate(c *C) {
+	testServer.Response(200, nil, InitMultiResultDump)
+
+	b := s.s3.Bucket("sample")
+
+	multi, err := b.InitMulti("multi", "text/plain", s3.Private)
+	c.Assert(err, IsNil)
+	testServer.WaitRequest()
+
+	c.Assert(multi.AbortDate.IsZero(), Equals, true)
+	c.Assert(multi.AbortRuleID, Equals, "")
+}
+
 func (s *S) TestMultiNoPreviousUpload(c *C) {
 	// Don't retry the NoSuchUpload error.
 	s3.RetryAttempts(false)
@@ -111,6 +149,86 @@ func (s *S) TestListParts(c *C) {
 	c.Assert(req.Form["part-number-marker"], DeepEquals, []string{"2"})
 }
 
+func (s *S) TestListPartsPage(c *C) {
+	testServer.Response(200, nil, InitMultiResultDump)
+	testServer.Response(200, nil, ListPartsResultDump1)
+	testServer.Response(200, nil, ListPartsResultDump2)
+
+	b := s.s3.Bucket("sample")
+
+	multi, err := b.InitMulti("multi", "text/plain", s3.Private)
+	c.Assert(err, IsNil)
+
+	page, err := multi.ListPartsPage(0, 2)
+	c.Assert(err, IsNil)
+	c.Assert(page.Parts, HasLen, 2)
+	c.Assert(page.Parts[0].N, Equals, 1)
+	c.Assert(page.Parts[1].N, Equals, 2)
+	c.Assert(page.IsTruncated, Equals, true)
+	c.Assert(page.NextPartNumberMarker, Equals, 2)
+
+	// The listing resumes from the persisted marker with another value
+	// for the same upload.
+	marker := page.NextPartNumberMarker
+	resumed := &s3.Multi{Bucket: b, Key: multi.Key, UploadId: multi.UploadId}
+	page, err = resumed.ListPartsPage(marker, 2)
+	c.Assert(err, IsNil)
+	c.Assert(page.Parts, HasLen, 1)
+	c.Assert(page.Parts[0].N, Equals, 3)
+	c.Assert(page.IsTruncated, Equals, false)
+	c.Assert(page.NextPartNumberMarker, Equals, 0)
+
+	testServer.WaitRequest()
+	req := testServer.WaitRequest()
+	c.Assert(req.Form["max-parts"], DeepEquals, []string{"2"})
+	c.Assert(req.Form["part-number-marker"], IsNil)
+	req = testServer.WaitRequest()
+	c.Assert(req.Form.Get("uploadId"), Equals, multi.UploadId)
+	c.Assert(req.Form["max-parts"], DeepEquals, []string{"2"})
+	c.Assert(req.Form["part-number-marker"], DeepEquals, []string{"2"})
+}
+
+func (s *S) TestListPartsEach(c *C) {
+	testServer.Response(200, nil, InitMultiResultDump)
+	testServer.Response(200, nil, ListPartsResultDump1)
+	testServer.Response(200, nil, ListPartsResultDump2)
+	testServer.Response(200, nil, ListPartsResultDump1)
+
+	b := s.s3.Bucket("sample")
+
+	multi, err := b.InitMulti("multi", "text/plain", s3.Private)
+	c.Assert(err, IsNil)
+	testServer.WaitRequest()
+
+	var ns []int
+	err = multi.ListPartsEach(func(part s3.Part) error {
+		ns = append(ns, part.N)
+		return nil
+	})
+	c.Assert(err, IsNil)
+	c.Assert(ns, DeepEquals, []int{1, 2, 3})
+	testServer.WaitRequests(2)
+
+	// The listing stops at the first error returned by the callback.
+	stop := errors.New("stop")
+	ns = nil
+	err = multi.ListPartsEach(func(part s3.Part) error {
+		ns = append(ns, part.N)
+		return stop
+	})
+	c.Assert(err, Equals, stop)
+	c.Assert(ns, DeepEquals, []int{1})
+	testServer.WaitRequest()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = multi.ListPartsEachContext(ctx, false, func(part s3.Part) error {
+		c.Fatalf("unexpected part %d", part.N)
+		return nil
+	})
+	c.Assert(err, Equals, context.Canceled)
+}
+
 func (s *S) TestPutPart(c *C) {
 	headers := map[string]string{
 		"ETag": `"26f90efd10d614f100252ff56d88dad8"`,
@@ -140,6 +258,68 @@ func (s *S) TestPutPart(c *C) {
 	c.Assert(req.Header["Content-Md5"], DeepEquals, []string{"JvkO/RDWFPEAJS/1bYja2A=="})
 }
 
+func (s *S) TestPutPartBadDigestRetried(c *C) {
+	headers := map[string]string{
+		"ETag": `"26f90efd10d614f100252ff56d88dad8"`,
+	}
+	testServer.Response(200, nil, InitMultiResultDump)
+	testServer.Response(400, nil, BadDigestErrorDump)
+	testServer.Response(200, headers, "")
+
+	b := s.s3.Bucket("sample")
+
+	multi, err := b.InitMulti("multi", "text/plain", s3.Private)
+	c.Assert(err, IsNil)
+
+	payload := []byte("<part 1>")
+	part, err := multi.PutPartHash(1, bytes.NewReader(payload), int64(len(payload)), s3.MD5B64(payload), s3.SHA256Hex(payload))
+	c.Assert(err, IsNil)
+	c.Assert(part.ETag, Equals, headers["ETag"])
+
+	testServer.WaitRequest()
+	for i := 0; i < 2; i++ {
+		req := testServer.WaitRequest()
+		c.Assert(req.Method, Equals, "PUT")
+		c.Assert(req.Header["Content-Md5"], DeepEquals, []string{"JvkO/RDWFPEAJS/1bYja2A=="})
+		c.Assert(readAll(req.Body), Equals, "<part 1>")
+	}
+}
+
+func (s *S) TestPutPartBadDigestTwice(c *C) {
+	testServer.Response(200, nil, InitMultiResultDump)
+	testServer.Responses(2, 400, nil, BadDigestErrorDump)
+
+	b := s.s3.Bucket("sample")
+
+	multi, err := b.InitMulti("multi", "text/plain", s3.Private)
+	c.Assert(err, IsNil)
+
+	payload := []byte("<part 1>")
+	_, err = multi.PutPartHash(1, bytes.NewReader(payload), int64(len(payload)), s3.MD5B64(payload), s3.SHA256Hex(payload))
+	c.Assert(err, ErrorMatches, "The Content-MD5 you specified did not match what we received.")
+
+	testServer.WaitRequests(3)
+}
+
+func (s *S) TestPutPartBadDigestRetryPolicy(c *C) {
+	testServer.Response(200, nil, InitMultiResultDump)
+	testServer.Response(400, nil, BadDigestErrorDump)
+
+	client := s3.New(s.s3.Auth, s.s3.Region)
+	client.RetryPolicy = s3.RetryMethods("GET", "HEAD")
+	b := client.Bucket("sample")
+
+	multi, err := b.InitMulti("multi", "text/plain", s3.Private)
+	c.Assert(err, IsNil)
+
+	// The policy doesn't retry PUT requests, so neither is the part.
+	payload := []byte("<part 1>")
+	_, err = multi.PutPartHash(1, bytes.NewReader(payload), int64(len(payload)), s3.MD5B64(payload), s3.SHA256Hex(payload))
+	c.Assert(err, ErrorMatches, "The Content-MD5 you specified did not match what we received.")
+
+	testServer.WaitRequests(2)
+}
+
 func readAll(r io.Reader) string {
 	data, err := ioutil.ReadAll(r)
 	if err != nil {
@@ -148,6 +328,47 @@ func readAll(r io.Reader) string {
 	return string(data)
 }
 
+func (s *S) TestMultiCompleteVerifyParts(c *C) {
+	testServer.Response(200, nil, InitMultiResultDump)
+	testServer.Response(200, nil, ListPartsResultDump1)
+	testServer.Response(200, nil, ListPartsResultDump2)
+
+	b := s.s3.Bucket("sample")
+
+	multi, err := b.InitMulti("multi", "text/plain", s3.Private)
+	c.Assert(err, IsNil)
+
+	parts := []s3.Part{
+		{N: 4, ETag: `"ETag4"`},
+		{N: 1, ETag: `"ffc88b4ca90a355f8ddba6b2c3b2af5c"`},
+		{N: 3, ETag: `"ETag3"`},
+		{N: 6, ETag: `"ETag6"`},
+		{N: 2, ETag: "d067a0fa9dc61a6e7195ca99696b5a89"},
+	}
+	_, err = multi.CompleteWithOptions(parts, s3.CompleteOptions{VerifyParts: true})
+	c.Assert(err, ErrorMatches, `s3: invalid multipart upload parts: missing parts 4, 6; ETag mismatch for parts 3`)
+	perr, ok := err.(*s3.PartsError)
+	c.Assert(ok, Equals, true)
+	c.Assert(perr.Missing, DeepEquals, []int{4, 6})
+	c.Assert(perr.Mismatched, DeepEquals, []int{3})
+	c.Assert(errors.Is(err, s3.ErrMissingPart), Equals, true)
+	c.Assert(errors.Is(err, s3.ErrETagMismatch), Equals, true)
+
+	// Nothing is completed.
+	testServer.WaitRequest()
+	reqs := testServer.WaitRequests(2)
+	c.Assert(reqs[0].Method, Equals, "GET")
+	c.Assert(reqs[1].Method, Equals, "GET")
+
+	testServer.Response(200, nil, ListPartsResultDump1)
+	testServer.Response(200, nil, ListPartsResultDump2)
+	testServer.Response(200, nil, CompleteMultiResultDump)
+	_, err = multi.CompleteWithOptions(parts[1:2], s3.CompleteOptions{VerifyParts: true})
+	c.Assert(err, IsNil)
+	reqs = testServer.WaitRequests(3)
+	c.Assert(reqs[2].Method, Equals, "POST")
+}
+
 func (s *S) TestMultiComplete(c *C) {
 	testServer.Response(200, nil, InitMultiResultDump)
 	// Note the 200 response. Completing will hold the connection on some
@@ -160,7 +381,7 @@ func (s *S) TestMultiComplete(c *C) {
 	multi, err := b.InitMulti("multi", "text/plain", s3.Private)
 	c.Assert(err, IsNil)
 
-	err = multi.Complete([]s3.Part{{2, `"ETag2"`, 32}, {1, `"ETag1"`, 64}})
+	err = multi.Complete([]s3.Part{{N: 2, ETag: `"ETag2"`, Size: 32}, {N: 1, ETag: `"ETag1"`, Size: 64}})
 	c.Assert(err, IsNil)
 
 	testServer.WaitRequest()
@@ -189,6 +410,211 @@ func (s *S) TestMultiComplete(c *C) {
 	c.Assert(payload.Part[1].ETag, Equals, `"ETag2"`)
 }
 
+func (s *S) TestMultiCompleteChecksums(c *C) {
+	testServer.Response(200, nil, InitMultiResultDump)
+	testServer.Response(200, nil, "")
+
+	b := s.s3.Bucket("sample")
+
+	multi, err := b.InitMulti("multi", "text/plain", s3.Private)
+	c.Assert(err, IsNil)
+
+	err = multi.Complete([]s3.Part{
+		{N: 2, ETag: `"ETag2"`, Size: 32, ChecksumCRC32C: "yZRlqg=="},
+		{N: 1, ETag: `"ETag1"`, Size: 64, ChecksumCRC32C: "3S1Zxw=="},
+	})
+	c.Assert(err, IsNil)
+
+	testServer.WaitRequest()
+	req := testServer.WaitRequest()
+	c.Assert(req.Method, Equals, "POST")
+	c.Assert(req.Header["X-Amz-Checksum-Type"], DeepEquals, []string{"COMPOSITE"})
+
+	var payload struct {
+		XMLName xml.Name
+		Part    []struct {
+			PartNumber     int
+			ETag           string
+			ChecksumCRC32C string
+		}
+	}
+
+	err = xml.NewDecoder(req.Body).Decode(&payload)
+	c.Assert(err, IsNil)
+
+	c.Assert(len(payload.Part), Equals, 2)
+	c.Assert(payload.Part[0].PartNumber, Equals, 1)
+	c.Assert(payload.Part[0].ChecksumCRC32C, Equals, "3S1Zxw==")
+	c.Assert(payload.Part[1].PartNumber, Equals, 2)
+	c.Assert(payload.Part[1].ChecksumCRC32C, Equals, "yZRlqg==")
+}
+
+func crc32c(data string) string {
+	sum := crc32.Checksum([]byte(data), crc32.MakeTable(crc32.Castagnoli))
+	return base64.StdEncoding.EncodeToString([]byte{byte(sum >> 24), byte(sum >> 16), byte(sum >> 8), byte(sum)})
+}
+
+func (s *S) TestPutPartChecksumReaderOffset(c *C) {
+	testServer.Response(200, nil, InitMultiResultDump)
+	testServer.Response(200, map[string]string{"ETag": `"26f0c9d6"`}, "")
+
+	b := s.s3.Bucket("sample")
+	multi, err := b.InitMultiWithOptions("multi", "text/plain", s3.Private, s3.MultiOptions{ChecksumType: s3.ChecksumComposite})
+	c.Assert(err, IsNil)
+	testServer.WaitRequest()
+
+	// The reader isn't at the start, but the part sent is all of it.
+	r := strings.NewReader("<part 1>")
+	_, err = r.Seek(3, 0)
+	c.Assert(err, IsNil)
+	part, err := multi.PutPartHash(1, r, 8, "", "")
+	c.Assert(err, IsNil)
+	c.Assert(part.ChecksumCRC32C, Equals, crc32c("<part 1>"))
+	req := testServer.WaitRequest()
+	c.Assert(req.Header.Get("x-amz-checksum-crc32c"), Equals, crc32c("<part 1>"))
+	c.Assert(readAll(req.Body), Equals, "<part 1>")
+}
+
+func (s *S) TestInitMultiChecksumType(c *C) {
+	for _, checksumType := range []s3.ChecksumType{s3.ChecksumComposite, s3.ChecksumFullObject} {
+		testServer.Response(200, nil, InitMultiResultDump)
+		testServer.Response(200, map[string]string{"ETag": `"26f0c9d6"`}, "")
+
+		b := s.s3.Bucket("sample")
+		multi, err := b.InitMultiWithOptions("multi", "text/plain", s3.Private, s3.MultiOptions{ChecksumType: checksumType})
+		c.Assert(err, IsNil)
+		c.Assert(multi.ChecksumType, Equals, checksumType)
+
+		req := testServer.WaitRequest()
+		c.Assert(req.Header.Get("x-amz-checksum-algorithm"), Equals, "CRC32C")
+		c.Assert(req.Header.Get("x-amz-checksum-type"), Equals, string(checksumType))
+
+		part, err := multi.PutPartHash(1, strings.NewReader("<part 1>"), 8, "", "")
+		c.Assert(err, IsNil)
+		c.Assert(part.ChecksumCRC32C, Equals, crc32c("<part 1>"))
+		req = testServer.WaitRequest()
+		c.Assert(req.Header.Get("x-amz-checksum-crc32c"), Equals, crc32c("<part 1>"))
+	}
+
+	_, err := s.s3.Bucket("sample").InitMultiWithOptions("multi", "text/plain", s3.Private, s3.MultiOptions{ChecksumType: "CRC64"})
+	c.Assert(err, ErrorMatches, `bad checksum type: "CRC64"`)
+}
+
+func (s *S) TestMultiCompleteFullObjectChecksum(c *C) {
+	testServer.Response(200, nil, InitMultiResultDump)
+	testServer.Response(200, nil, "")
+
+	b := s.s3.Bucket("sample")
+	multi, err := b.InitMultiWithOptions("multi", "text/plain", s3.Private, s3.MultiOptions{ChecksumType: s3.ChecksumFullObject})
+	c.Assert(err, IsNil)
+
+	err = multi.Complete([]s3.Part{
+		{N: 2, ETag: `"ETag2"`, Size: 5, ChecksumCRC32C: crc32c("world")},
+		{N: 1, ETag: `"ETag1"`, Size: 6, ChecksumCRC32C: crc32c("hello ")},
+	})
+	c.Assert(err, IsNil)
+
+	testServer.WaitRequest()
+	req := testServer.WaitRequest()
+	c.Assert(req.Header.Get("x-amz-checksum-type"), Equals, "FULL_OBJECT")
+	c.Assert(req.Header.Get("x-amz-checksum-crc32c"), Equals, crc32c("hello world"))
+	body := readAll(req.Body)
+	c.Assert(strings.Contains(body, "<ChecksumCRC32C>"+crc32c("hello ")+"</ChecksumCRC32C>"), Equals, true)
+
+	err = multi.Complete([]s3.Part{{N: 1, ETag: `"ETag1"`, Size: 6}})
+	c.Assert(err, ErrorMatches, `part 1 has no valid CRC32C checksum: ""`)
+}
+
+func (s *S) TestMultiCRC64NVMEChecksum(c *C) {
+	testServer.Response(200, nil, InitMultiResultDump)
+	testServer.Response(200, map[string]string{"ETag": `"ETag1"`}, "")
+	testServer.Response(200, nil, "")
+
+	b := s.s3.Bucket("sample")
+	multi, err := b.InitMultiWithOptions("multi", "text/plain", s3.Private, s3.MultiOptions{ChecksumAlgorithm: s3.ChecksumCRC64NVME})
+	c.Assert(err, IsNil)
+	c.Assert(multi.ChecksumType, Equals, s3.ChecksumFullObject)
+	req := testServer.WaitRequest()
+	c.Assert(req.Header.Get("x-amz-checksum-algorithm"), Equals, "CRC64NVME")
+	c.Assert(req.Header.Get("x-amz-checksum-type"), Equals, "FULL_OBJECT")
+
+	part, err := multi.PutPartHash(1, strings.NewReader("hello "), 6, "", "")
+	c.Assert(err, IsNil)
+	c.Assert(part.ChecksumCRC64NVME, Equals, s3.CRC64NVMEB64([]byte("hello ")))
+	c.Assert(part.ChecksumCRC32C, Equals, "")
+	req = testServer.WaitRequest()
+	c.Assert(req.Header.Get("x-amz-checksum-crc64nvme"), Equals, s3.CRC64NVMEB64([]byte("hello ")))
+
+	err = multi.Complete([]s3.Part{
+		{N: 2, ETag: `"ETag2"`, Size: 5, ChecksumCRC64NVME: s3.CRC64NVMEB64([]byte("world"))},
+		part,
+	})
+	c.Assert(err, IsNil)
+	req = testServer.WaitRequest()
+	c.Assert(req.Header.Get("x-amz-checksum-type"), Equals, "FULL_OBJECT")
+	c.Assert(req.Header.Get("x-amz-checksum-crc64nvme"), Equals, s3.CRC64NVMEB64([]byte("hello world")))
+	body := readAll(req.Body)
+	c.Assert(strings.Contains(body, "<ChecksumCRC64NVME>"+part.ChecksumCRC64NVME+"</ChecksumCRC64NVME>"), Equals, true)
+
+	err = multi.Complete([]s3.Part{{N: 1, ETag: `"ETag1"`, Size: 6}})
+	c.Assert(err, ErrorMatches, `part 1 has no valid CRC64NVME checksum: ""`)
+
+	_, err = b.InitMultiWithOptions("multi", "text/plain", s3.Private, s3.MultiOptions{
+		ChecksumType:      s3.ChecksumComposite,
+		ChecksumAlgorithm: s3.ChecksumCRC64NVME,
+	})
+	c.Assert(err, ErrorMatches, `bad checksum type for CRC64NVME: "COMPOSITE"`)
+}
+
+func (s *S) TestMultiCompleteWithResult(c *C) {
+	testServer.Response(200, nil, InitMultiResultDump)
+	testServer.Response(200, writeResponseHeaders, CompleteMultiResultDump)
+
+	b := s.s3.Bucket("sample")
+
+	multi, err := b.InitMulti("multi", "text/plain", s3.Private)
+	c.Assert(err, IsNil)
+
+	result, err := multi.CompleteWithResult([]s3.Part{{N: 1, ETag: `"ETag1"`, Size: 64}})
+	c.Assert(err, IsNil)
+	testServer.WaitRequests(2)
+
+	c.Assert(result.Location, Equals, "http://sample.s3.amazonaws.com/multi")
+	c.Assert(result.Bucket, Equals, "sample")
+	c.Assert(result.Key, Equals, "multi")
+	c.Assert(result.ETag, Equals, `"3858f62230ac3c915f300c664312c11f-9"`)
+	checkWriteResult(c, &result.WriteResult)
+}
+
+func (s *S) TestRetryPolicy(c *C) {
+	testServer.Response(200, nil, InitMultiResultDump)
+	testServer.Response(500, nil, InternalErrorDump)
+	testServer.Response(500, nil, InternalErrorDump)
+	testServer.Response(200, nil, "content")
+
+	client := s3.New(s.s3.Auth, s.s3.Region)
+	client.RetryPolicy = s3.RetryMethods("GET", "HEAD", "PUT")
+	b := client.Bucket("sample")
+
+	multi, err := b.InitMulti("multi", "text/plain", s3.Private)
+	c.Assert(err, IsNil)
+	testServer.WaitRequest()
+
+	// The POST completing the upload is not retried.
+	err = multi.Complete([]s3.Part{{N: 1, ETag: `"ETag1"`, Size: 64}})
+	c.Assert(err, ErrorMatches, "Not relevant")
+	req := testServer.WaitRequest()
+	c.Assert(req.Method, Equals, "POST")
+
+	// The GET is.
+	data, err := b.Get("name")
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "content")
+	reqs := testServer.WaitRequests(2)
+	c.Assert(reqs[0].Method, Equals, "GET")
+	c.Assert(reqs[1].Method, Equals, "GET")
+}
+
 func (s *S) TestMultiAbort(c *C) {
 	testServer.Response(200, nil, InitMultiResultDump)
 	testServer.Response(200, nil, "")
@@ -230,3 +656,226 @@ func (s *S) TestListMulti(c *C) {
 	c.Assert(req.Form["delimiter"], DeepEquals, []string{"/"})
 	c.Assert(req.Form["max-uploads"], DeepEquals, []string{"1000"})
 }
+
+func (s *S) TestListMultiInitiator(c *C) {
+	testServer.Response(200, nil, ListMultiInitiatorResultDump)
+	testServer.Response(200, nil, ListMultiInitiatorResultDump)
+
+	b := s.s3.Bucket("sample")
+
+	multis, _, err := b.ListMulti("", "/")
+	c.Assert(err, IsNil)
+	c.Assert(multis, HasLen, 2)
+	c.Assert(multis[0].Initiator, Equals, s3.Owner{ID: "bb5c0f63b0b25f2d0", DisplayName: "gustavoniemeyer"})
+	c.Assert(multis[0].Owner, Equals, s3.Owner{ID: "bb5c0f63b0b25f2d0", DisplayName: "gustavoniemeyer"})
+	c.Assert(multis[0].StorageClass, Equals, s3.Standard)
+	c.Assert(multis[1].Initiator, Equals, s3.Owner{ID: "8a6925ce4adf588a4", DisplayName: "joe"})
+	c.Assert(multis[1].Owner, Equals, s3.Owner{ID: "bb5c0f63b0b25f2d0", DisplayName: "gustavoniemeyer"})
+	c.Assert(multis[1].StorageClass, Equals, s3.StandardIA)
+	testServer.WaitRequest()
+
+	multis, prefixes, err := b.ListMultiWithOptions("", "/", s3.ListMultiOptions{InitiatorID: "8a6925ce4adf588a4"})
+	c.Assert(err, IsNil)
+	c.Assert(prefixes, DeepEquals, []string{"a/", "b/"})
+	c.Assert(multis, HasLen, 1)
+	c.Assert(multis[0].Key, Equals, "multi2")
+	c.Assert(multis[0].Bucket, Equals, b)
+	testServer.WaitRequest()
+}
+
+func (s *LocalBucketSuite) TestAbortAllMulti(c *C) {
+	b := s.b
+	for _, key := range []string{"multi", "multi", "multi2"} {
+		_, err := b.InitMulti(key, "text/plain", s3.Private)
+		c.Assert(err, IsNil)
+	}
+
+	aborted, err := b.AbortAllMulti("multi")
+	c.Assert(err, IsNil)
+	c.Assert(aborted, Equals, 2)
+
+	multis, _, err := b.ListMulti("", "")
+	c.Assert(err, IsNil)
+	c.Assert(multis, HasLen, 1)
+	c.Assert(multis[0].Key, Equals, "multi2")
+
+	aborted, err = b.AbortAllMulti("multi")
+	c.Assert(err, IsNil)
+	c.Assert(aborted, Equals, 0)
+}
+
+func (s *LocalBucketSuite) TestInitMultiObjectOptions(c *C) {
+	b := s.b
+	multi, err := b.InitMultiWithOptions("multi", "text/plain", s3.Private, s3.MultiOptions{
+		Meta:                 map[string][]string{"Origin": {"backup"}},
+		StorageClass:         s3.StandardIA,
+		ServerSideEncryption: "aws:kms",
+		SSEKMSKeyID:          "key-id",
+	})
+	c.Assert(err, IsNil)
+	parts, err := multi.PutAllReaderAt(strings.NewReader("content"), 7, 7)
+	c.Assert(err, IsNil)
+	c.Assert(multi.Complete(parts), IsNil)
+
+	key, err := b.Info("multi")
+	c.Assert(err, IsNil)
+	c.Assert(key.StorageClass, Equals, "STANDARD_IA")
+	c.Assert(key.ServerSideEncryption, Equals, "aws:kms")
+	c.Assert(key.SSEKMSKeyID, Equals, "key-id")
+	c.Assert(key.Meta["origin"], DeepEquals, []string{"backup"})
+	c.Assert(key.ContentType, Equals, "text/plain")
+}
+
+func (s *S) TestInitMultiGrants(c *C) {
+	testServer.Response(200, nil, InitMultiResultDump)
+
+	b := s.s3.Bucket("sample")
+	_, err := b.InitMultiWithOptions("multi", "text/plain", s3.Private, s3.MultiOptions{
+		Tags: map[string]string{"env": "prod"},
+		Grants: s3.Grants{
+			Read:        `uri="` + s3.AllUsersURI + `"`,
+			FullControl: `id="8a6925ce4adf588a4"`,
+		},
+	})
+	c.Assert(err, IsNil)
+
+	req := testServer.WaitRequest()
+	c.Assert(req.Header["X-Amz-Acl"], IsNil)
+	c.Assert(req.Header["X-Amz-Grant-Read"], DeepEquals, []string{`uri="http://acs.amazonaws.com/groups/global/AllUsers"`})
+	c.Assert(req.Header["X-Amz-Grant-Full-Control"], DeepEquals, []string{`id="8a6925ce4adf588a4"`})
+	c.Assert(req.Header["X-Amz-Grant-Read-Acp"], IsNil)
+	c.Assert(req.Header["X-Amz-Tagging"], DeepEquals, []string{"env=prod"})
+	c.Assert(req.Header["X-Amz-Storage-Class"], IsNil)
+}
+
+func (s *LocalBucketSuite) TestMultiConcurrentParts(c *C) {
+	b := s.b
+	multi, err := b.InitMulti("multi", "text/plain", s3.Private)
+	c.Assert(err, IsNil)
+
+	const n = 50
+	parts := make([]s3.Part, n)
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			data := []byte(fmt.Sprintf("part %02d;", i+1))
+			parts[i], errs[i] = multi.PutPartHash(i+1, bytes.NewReader(data), int64(len(data)), s3.MD5B64(data), s3.SHA256Hex(data))
+		}(i)
+	}
+	wg.Wait()
+	var expected bytes.Buffer
+	for i := 0; i < n; i++ {
+		c.Assert(errs[i], IsNil)
+		c.Assert(parts[i].N, Equals, i+1)
+		fmt.Fprintf(&expected, "part %02d;", i+1)
+	}
+
+	listed, err := multi.ListParts()
+	c.Assert(err, IsNil)
+	c.Assert(listed, HasLen, n)
+
+	c.Assert(multi.Complete(parts), IsNil)
+	data, err := b.Get("multi")
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, expected.String())
+}
+
+func (s *LocalBucketSuite) TestListMultiUsage(c *C) {
+	b := s.b
+	for key, sizes := range map[string][]int{
+		"multi1": {3},
+		"multi2": {5, 7, 2},
+	} {
+		multi, err := b.InitMulti(key, "text/plain", s3.Private)
+		c.Assert(err, IsNil)
+		for i, size := range sizes {
+			data := bytes.Repeat([]byte("x"), size)
+			_, err := multi.PutPartHash(i+1, bytes.NewReader(data), int64(size), s3.MD5B64(data), s3.SHA256Hex(data))
+			c.Assert(err, IsNil)
+		}
+	}
+
+	usage, prefixes, err := b.ListMultiUsage("", "", 2)
+	c.Assert(err, IsNil)
+	c.Assert(prefixes, HasLen, 0)
+	c.Assert(usage, HasLen, 2)
+	c.Assert(usage[0].Multi.Key, Equals, "multi1")
+	c.Assert(usage[0].Parts, Equals, 1)
+	c.Assert(usage[0].Size, Equals, int64(3))
+	c.Assert(usage[1].Multi.Key, Equals, "multi2")
+	c.Assert(usage[1].Parts, Equals, 3)
+	c.Assert(usage[1].Size, Equals, int64(14))
+
+	_, _, err = b.ListMultiUsage("", "", 0)
+	c.Assert(err, ErrorMatches, "bad concurrency: 0")
+}
+
+func (s *LocalBucketSuite) TestPutAllReaderAt(c *C) {
+	b := s.b
+	multi, err := b.InitMulti("multi", "text/plain", s3.Private)
+	c.Assert(err, IsNil)
+
+	// Parts are planned before any is sent.
+	content := "0123456789"
+	_, err = multi.PutAllReaderAt(bytes.NewReader([]byte(content)), int64(len(content)), 4)
+	c.Assert(err, ErrorMatches, "s3: part size 4 is below the minimum of 5242880 bytes")
+	parts, err := multi.ListParts()
+	c.Assert(err, IsNil)
+	c.Assert(parts, HasLen, 0)
+
+	s3.SetMinPartSize(1)
+	defer s3.SetMinPartSize(s3.MinPartSize)
+	parts, err = multi.PutAllReaderAt(bytes.NewReader([]byte(content)), int64(len(content)), 4)
+	c.Assert(err, IsNil)
+	c.Assert(parts, HasLen, 3)
+	for i, data := range []string{"0123", "4567", "89"} {
+		c.Assert(parts[i].N, Equals, i+1)
+		c.Assert(parts[i].Size, Equals, int64(len(data)))
+		c.Assert(parts[i].ETag, Equals, fmt.Sprintf(`"%x"`, md5.Sum([]byte(data))))
+	}
+
+	c.Assert(multi.Complete(parts), IsNil)
+	data, err := b.Get("multi")
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, content)
+
+	_, err = multi.PutAllReaderAt(bytes.NewReader([]byte(content)), int64(len(content)), 0)
+	c.Assert(err, ErrorMatches, "s3: bad part size: 0")
+}
+
+var planMultipartTests = []struct {
+	size, partSize int64
+	parts          int
+	err            string
+}{
+	{size: 0, partSize: 1, parts: 1},
+	{size: 1, partSize: 1, parts: 1},
+	{size: 100 << 20, partSize: 200 << 20, parts: 1},
+	// A single part may be smaller than the minimum.
+	{size: 1 << 20, partSize: 1 << 20, parts: 1},
+	{size: 5<<20 + 1, partSize: 5 << 20, parts: 2},
+	{size: 10 << 20, partSize: 5 << 20, parts: 2},
+	{size: 10000 * 5 << 20, partSize: 5 << 20, parts: 10000},
+	{size: 10000*5<<20 + 1, partSize: 5 << 20, err: `s3: uploading 52428800001 bytes in parts of 5242880 bytes takes 10001 parts, more than the maximum of 10000`},
+	{size: 2 << 20, partSize: 1 << 20, err: `s3: part size 1048576 is below the minimum of 5242880 bytes`},
+	{size: 5<<20 + 1, partSize: 5<<20 - 1, err: `s3: part size 5242879 is below the minimum of 5242880 bytes`},
+	{size: 10, partSize: 0, err: `s3: bad part size: 0`},
+	{size: -1, partSize: 5 << 20, err: `s3: bad upload size: -1`},
+}
+
+func (s *S) TestPlanMultipart(c *C) {
+	for i, t := range planMultipartTests {
+		c.Logf("test %d: %d bytes in parts of %d", i, t.size, t.partSize)
+		parts, err := s3.PlanMultipart(t.size, t.partSize)
+		if t.err == "" {
+			c.Check(err, IsNil)
+			c.Check(parts, Equals, t.parts)
+		} else {
+			c.Check(err, ErrorMatches, t.err)
+			c.Check(parts, Equals, 0)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package s3
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// RetentionMode is the mode of an object lock retention.
+type RetentionMode string
+
+const (
+	// Governance retention may be lifted by users with the
+	// s3:BypassGovernanceRetention permission.
+	Governance = RetentionMode("GOVERNANCE")
+	// Compliance retention may not be lifted by anyone until it ends.
+	Compliance = RetentionMode("COMPLIANCE")
+)
+
+// DefaultRetention is the retention applied to new objects in a bucket
+// with object lock enabled. Exactly one of Days and Years must be set.
+type DefaultRetention struct {
+	Mode  RetentionMode
+	Days  int
+	Years int
+}
+
+// ObjectLockConfig is the object lock configuration of a bucket.
+type ObjectLockConfig struct {
+	// ObjectLockEnabled is whether object lock is enabled for the
+	// bucket. It may only be enabled, not disabled once it is.
+	ObjectLockEnabled bool
+	// DefaultRetention, if set, is applied to new objects placed in
+	// the bucket without a retention of their own.
+	DefaultRetention *DefaultRetention
+}
+
+// Validate checks that c describes a configuration S3 accepts, so that
+// mistakes are reported before sending it.
+func (c ObjectLockConfig) Validate() error {
+	r := c.DefaultRetention
+	if r == nil {
+		return nil
+	}
+	if !c.ObjectLockEnabled {
+		return errors.New("s3: object lock default retention requires object lock to be enabled")
+	}
+	if r.Mode != Governance && r.Mode != Compliance {
+		return fmt.Errorf("s3: bad object lock retention mode: %q", r.Mode)
+	}
+	if r.Days < 0 || r.Years < 0 || (r.Days > 0) == (r.Years > 0) {
+		return fmt.Errorf("s3: object lock retention needs either days or years, got %d days and %d years", r.Days, r.Years)
+	}
+	return nil
+}
+
+type objectLockConfiguration struct {
+	XMLName           xml.Name        `xml:"ObjectLockConfiguration"`
+	ObjectLockEnabled string          `xml:",omitempty"`
+	Rule              *objectLockRule `xml:",omitempty"`
+}
+
+type objectLockRule struct {
+	DefaultRetention objectLockRetention
+}
+
+type objectLockRetention struct {
+	Mode  RetentionMode
+	Days  int `xml:",omitempty"`
+	Years int `xml:",omitempty"`
+}
+
+// PutObjectLockConfiguration replaces the object lock configuration of
+// b with config, after checking that it is valid (see
+// ObjectLockConfig.Validate).
+//
+// See https://docs.aws.amazon.com/AmazonS3/latest/API/API_PutObjectLockConfiguration.html
+// for details.
+func (b *Bucket) PutObjectLockConfiguration(config ObjectLockConfig) error {
+	if err := config.Validate(); err != nil {
+		return err
+	}
+	var c objectLockConfiguration
+	if config.ObjectLockEnabled {
+		c.ObjectLockEnabled = "Enabled"
+	}
+	if r := config.DefaultRetention; r != nil {
+		c.Rule = &objectLockRule{objectLockRetention{r.Mode, r.Days, r.Years}}
+	}
+	data, err := xml.Marshal(&c)
+	if err != nil {
+		return err
+	}
+	headers := map[string][]string{
+		"Content-Length": {strconv.Itoa(len(data))},
+		"Content-MD5":    {MD5B64(data)},
+	}
+	req := &request{
+		method:  "PUT",
+		bucket:  b.Name,
+		path:    "/",
+		params:  map[string][]string{"object-lock": {}},
+		headers: headers,
+		payload: getPayload(data),
+	}
+	for attempt := b.S3.startAttempts(); attempt.Next(); {
+		err = b.S3.query(req, nil)
+		if b.S3.shouldRetry(req.method, err) && attempt.HasNext() {
+			continue
+		}
+		return err
+	}
+	panic("unreachable")
+}
+
+// GetObjectLockConfiguration returns the object lock configuration of b.
+//
+// See https://docs.aws.amazon.com/AmazonS3/latest/API/API_GetObjectLockConfiguration.html
+// for details.
+func (b *Bucket) GetObjectLockConfiguration() (*ObjectLockConfig, error) {
+	req := &request{
+		bucket: b.Name,
+		path:   "/",
+		params: map[string][]string{"object-lock": {}},
+	}
+	for attempt := b.S3.startAttempts(); attempt.Next(); {
+		var resp objectLockConfiguration
+		err := b.S3.query(req, &resp)
+		if b.S3.shouldRetry(req.method, err) && attempt.HasNext() {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		config := &ObjectLockConfig{ObjectLockEnabled: resp.ObjectLockEnabled == "Enabled"}
+		if r := resp.Rule; r != nil {
+			config.DefaultRetention = &DefaultRetention{
+				Mode:  r.DefaultRetention.Mode,
+				Days:  r.DefaultRetention.Days,
+				Years: r.DefaultRetention.Years,
+			}
+		}
+		return config, nil
+	}
+	panic("unreachable")
+}
@@ -0,0 +1,58 @@
+package s3_test
+
+import (
+	"io/ioutil"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/koofr/goamz/s3"
+)
+
+func (s *S) TestPutObjectLockConfiguration(c *C) {
+	b := s.s3.Bucket("bucket")
+	err := b.PutObjectLockConfiguration(s3.ObjectLockConfig{
+		DefaultRetention: &s3.DefaultRetention{Mode: s3.Governance, Days: 30},
+	})
+	c.Assert(err, ErrorMatches, "s3: object lock default retention requires object lock to be enabled")
+	err = b.PutObjectLockConfiguration(s3.ObjectLockConfig{
+		ObjectLockEnabled: true,
+		DefaultRetention:  &s3.DefaultRetention{Mode: s3.Governance, Days: 30, Years: 1},
+	})
+	c.Assert(err, ErrorMatches, "s3: object lock retention needs either days or years, got 30 days and 1 years")
+
+	testServer.Response(200, nil, "")
+	err = b.PutObjectLockConfiguration(s3.ObjectLockConfig{
+		ObjectLockEnabled: true,
+		DefaultRetention:  &s3.DefaultRetention{Mode: s3.Governance, Days: 30},
+	})
+	c.Assert(err, IsNil)
+
+	req := testServer.WaitRequest()
+	c.Assert(req.Method, Equals, "PUT")
+	c.Assert(req.URL.Path, Equals, "/bucket/")
+	c.Assert(req.Form["object-lock"], DeepEquals, []string{""})
+	data, err := ioutil.ReadAll(req.Body)
+	c.Assert(err, IsNil)
+	c.Assert(req.Header["Content-Md5"], DeepEquals, []string{s3.MD5B64(data)})
+	c.Assert(string(data), Equals, "<ObjectLockConfiguration>"+
+		"<ObjectLockEnabled>Enabled</ObjectLockEnabled>"+
+		"<Rule><DefaultRetention><Mode>GOVERNANCE</Mode><Days>30</Days></DefaultRetention></Rule>"+
+		"</ObjectLockConfiguration>")
+}
+
+func (s *S) TestGetObjectLockConfiguration(c *C) {
+	testServer.Response(200, nil, GetObjectLockConfigurationDump)
+
+	b := s.s3.Bucket("bucket")
+	config, err := b.GetObjectLockConfiguration()
+	c.Assert(err, IsNil)
+	c.Assert(config, DeepEquals, &s3.ObjectLockConfig{
+		ObjectLockEnabled: true,
+		DefaultRetention:  &s3.DefaultRetention{Mode: s3.Compliance, Years: 7},
+	})
+
+	req := testServer.WaitRequest()
+	c.Assert(req.Method, Equals, "GET")
+	c.Assert(req.URL.Path, Equals, "/bucket/")
+	c.Assert(req.Form["object-lock"], DeepEquals, []string{""})
+}
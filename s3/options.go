@@ -0,0 +1,61 @@
+package s3
+
+import (
+	"net/http"
+
+	"github.com/koofr/goamz/aws"
+)
+
+// A RequestOption changes how the requests of a Bucket returned by
+// Bucket.With are sent.
+type RequestOption func(s3 *S3)
+
+// With returns a copy of b whose requests are sent with options applied,
+// leaving b unchanged. It allows setting guards or overrides for some
+// calls only, without reconfiguring the client:
+//
+//	data, err := b.With(s3.WithExpectedBucketOwner(id), s3.WithRequestPayer()).Get(path)
+//
+// Options are given to the bucket rather than to each operation, so
+// that every operation, present or future, accepts them without an
+// extra parameter or a variant taking options.
+func (b *Bucket) With(options ...RequestOption) *Bucket {
+	s3 := *b.S3
+	for _, option := range options {
+		option(&s3)
+	}
+	return &Bucket{&s3, b.Name}
+}
+
+// WithHeader sends the header name with value in every request, in
+// place of any value set by the operation itself.
+func WithHeader(name, value string) RequestOption {
+	return func(s3 *S3) {
+		// Copy so the headers of the client copied aren't changed.
+		headers := make(http.Header, len(s3.headers)+1)
+		for k, v := range s3.headers {
+			headers[k] = v
+		}
+		headers[name] = []string{value}
+		s3.headers = headers
+	}
+}
+
+// WithExpectedBucketOwner makes requests fail with AccessDenied unless
+// the bucket is owned by the account accountID.
+func WithExpectedBucketOwner(accountID string) RequestOption {
+	return WithHeader("x-amz-expected-bucket-owner", accountID)
+}
+
+// WithRequestPayer acknowledges that the requester pays for requests to
+// requester-pays buckets, which S3 rejects otherwise.
+func WithRequestPayer() RequestOption {
+	return WithHeader("x-amz-request-payer", "requester")
+}
+
+// WithAttemptStrategy retries failed requests according to strategy.
+func WithAttemptStrategy(strategy aws.AttemptStrategy) RequestOption {
+	return func(s3 *S3) {
+		s3.Attempts = &strategy
+	}
+}
@@ -0,0 +1,52 @@
+package s3_test
+
+import (
+	. "gopkg.in/check.v1"
+
+	"github.com/koofr/goamz/aws"
+	"github.com/koofr/goamz/s3"
+)
+
+func (s *S) TestWithOptions(c *C) {
+	testServer.Response(500, nil, InternalErrorDump)
+	testServer.Response(200, nil, "content")
+
+	b := s.s3.Bucket("bucket")
+	guarded := b.With(
+		s3.WithExpectedBucketOwner("111122223333"),
+		s3.WithRequestPayer(),
+		s3.WithAttemptStrategy(aws.AttemptStrategy{}),
+	)
+	c.Assert(guarded.Name, Equals, "bucket")
+
+	// The options apply to the requests through guarded: they carry
+	// the headers and aren't retried.
+	_, err := guarded.Get("name")
+	c.Assert(err, ErrorMatches, "Not relevant")
+	req := testServer.WaitRequest()
+	c.Assert(req.Header["X-Amz-Expected-Bucket-Owner"], DeepEquals, []string{"111122223333"})
+	c.Assert(req.Header["X-Amz-Request-Payer"], DeepEquals, []string{"requester"})
+
+	// Not to those through b.
+	data, err := b.Get("name")
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "content")
+	req = testServer.WaitRequest()
+	c.Assert(req.Header["X-Amz-Expected-Bucket-Owner"], IsNil)
+	c.Assert(req.Header["X-Amz-Request-Payer"], IsNil)
+	c.Assert(b.Attempts, IsNil)
+
+	// Options add up, leaving the bucket they are applied to unchanged.
+	testServer.Response(200, nil, "content")
+	_, err = guarded.With(s3.WithHeader("x-amz-expected-bucket-owner", "444455556666")).Get("name")
+	c.Assert(err, IsNil)
+	req = testServer.WaitRequest()
+	c.Assert(req.Header["X-Amz-Expected-Bucket-Owner"], DeepEquals, []string{"444455556666"})
+	c.Assert(req.Header["X-Amz-Request-Payer"], DeepEquals, []string{"requester"})
+
+	testServer.Response(200, nil, "content")
+	_, err = guarded.Get("name")
+	c.Assert(err, IsNil)
+	req = testServer.WaitRequest()
+	c.Assert(req.Header["X-Amz-Expected-Bucket-Owner"], DeepEquals, []string{"111122223333"})
+}
@@ -0,0 +1,122 @@
+package s3
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"strconv"
+)
+
+// PayloadHashStrategy selects how the content of uploads is covered by
+// Signature Version 4 signatures. It trades the cost of hashing the
+// content before sending it against the guarantees S3 gives about it.
+type PayloadHashStrategy int
+
+const (
+	// PayloadHashSHA256 signs the SHA256 hash of the content, which
+	// callers compute before uploading it. It is the default.
+	PayloadHashSHA256 PayloadHashStrategy = iota
+
+	// PayloadHashUnsigned leaves the content out of the signature
+	// ("UNSIGNED-PAYLOAD"), so the SHA256 hash given by callers is
+	// ignored. Integrity then relies on the transport (HTTPS) and on
+	// the Content-MD5 header, if sent.
+	PayloadHashUnsigned
+
+	// PayloadHashStreaming sends the content in the aws-chunked
+	// encoding, followed by a CRC32C checksum computed while sending
+	// it ("STREAMING-UNSIGNED-PAYLOAD-TRAILER"). S3 verifies the
+	// checksum, so integrity is checked without hashing the content
+	// up front.
+	PayloadHashStreaming
+)
+
+const (
+	streamingUnsignedPayloadTrailer = "STREAMING-UNSIGNED-PAYLOAD-TRAILER"
+	streamingChecksumTrailer        = "x-amz-checksum-crc32c"
+)
+
+// awsChunkSize is the size of the chunks content is split into by
+// PayloadHashStreaming.
+var awsChunkSize int64 = 64 * 1024
+
+var crc32cTable = crc32.MakeTable(crc32.Castagnoli)
+
+// applyPayloadHash sets up req, an upload of length bytes, according to
+// the payload hash strategy of s3. It has no effect unless requests are
+// signed with Signature Version 4.
+func (s3 *S3) applyPayloadHash(req *request, length int64) {
+	if !s3.Region.S3V4Signature {
+		return
+	}
+	switch s3.PayloadHash {
+	case PayloadHashUnsigned:
+		req.payload.sha256hex = UnsignedPayload
+	case PayloadHashStreaming:
+		req.payload.sha256hex = streamingUnsignedPayloadTrailer
+		req.payload.payload = newAWSChunkedReader(req.payload.payload)
+		req.headers["Content-Encoding"] = []string{"aws-chunked"}
+		req.headers["Content-Length"] = []string{strconv.FormatInt(awsChunkedLength(length), 10)}
+		req.headers["x-amz-decoded-content-length"] = []string{strconv.FormatInt(length, 10)}
+		req.headers["x-amz-trailer"] = []string{streamingChecksumTrailer}
+	}
+}
+
+// awsChunkedLength returns the length of length bytes of content in the
+// aws-chunked encoding, including the checksum trailer.
+func awsChunkedLength(length int64) int64 {
+	chunkLength := func(size int64) int64 {
+		return int64(len(strconv.FormatInt(size, 16))) + 2 + size + 2
+	}
+	n := length / awsChunkSize * chunkLength(awsChunkSize)
+	if rest := length % awsChunkSize; rest > 0 {
+		n += chunkLength(rest)
+	}
+	// The final empty chunk, then the trailer with the base64 encoded
+	// four bytes of the checksum.
+	return n + chunkLength(0) - 2 + int64(len(streamingChecksumTrailer)) + 1 + 8 + 2 + 2
+}
+
+// awsChunkedReader encodes the content read from r in the aws-chunked
+// encoding with a CRC32C checksum trailer.
+type awsChunkedReader struct {
+	r    io.Reader
+	crc  hash.Hash32
+	buf  []byte
+	out  bytes.Buffer
+	done bool
+}
+
+func newAWSChunkedReader(r io.Reader) *awsChunkedReader {
+	return &awsChunkedReader{
+		r:   r,
+		crc: crc32.New(crc32cTable),
+		buf: make([]byte, awsChunkSize),
+	}
+}
+
+func (c *awsChunkedReader) Read(p []byte) (int, error) {
+	for c.out.Len() == 0 {
+		if c.done {
+			return 0, io.EOF
+		}
+		n, err := io.ReadFull(c.r, c.buf)
+		if n > 0 {
+			c.crc.Write(c.buf[:n])
+			fmt.Fprintf(&c.out, "%x\r\n", n)
+			c.out.Write(c.buf[:n])
+			c.out.WriteString("\r\n")
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			fmt.Fprintf(&c.out, "0\r\n%s:%s\r\n\r\n", streamingChecksumTrailer,
+				base64.StdEncoding.EncodeToString(c.crc.Sum(nil)))
+			c.done = true
+		} else if err != nil {
+			return 0, err
+		}
+	}
+	return c.out.Read(p)
+}
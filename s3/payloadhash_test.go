@@ -0,0 +1,95 @@
+package s3_test
+
+import (
+	"encoding/base64"
+	"hash/crc32"
+	"io/ioutil"
+	"strings"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/koofr/goamz/s3"
+)
+
+func (s *S) TestPayloadHashSHA256(c *C) {
+	testServer.Response(200, nil, "")
+
+	client, _ := s.v4Client()
+	b := client.Bucket("bucket")
+	err := b.Put("name", []byte("content"), "text/plain", s3.Private)
+	c.Assert(err, IsNil)
+
+	req := testServer.WaitRequest()
+	c.Assert(req.Header.Get("x-amz-content-sha256"), Equals, s3.SHA256Hex([]byte("content")))
+	c.Assert(req.Header.Get("Content-Encoding"), Equals, "")
+	c.Assert(readAll(req.Body), Equals, "content")
+}
+
+func (s *S) TestPayloadHashUnsigned(c *C) {
+	testServer.Response(200, nil, "")
+
+	client, _ := s.v4Client()
+	client.PayloadHash = s3.PayloadHashUnsigned
+	err := client.Bucket("bucket").PutReader("name", strings.NewReader("content"), 7, "text/plain", s3.Private, "", "")
+	c.Assert(err, IsNil)
+
+	req := testServer.WaitRequest()
+	c.Assert(req.Header.Get("x-amz-content-sha256"), Equals, "UNSIGNED-PAYLOAD")
+	c.Assert(req.Header.Get("Authorization"), Matches, "AWS4-HMAC-SHA256 .*x-amz-content-sha256.*")
+	c.Assert(readAll(req.Body), Equals, "content")
+}
+
+func (s *S) TestPayloadHashStreaming(c *C) {
+	s3.SetAWSChunkSize(4)
+	defer s3.SetAWSChunkSize(64 * 1024)
+	testServer.Response(200, nil, "")
+
+	client, _ := s.v4Client()
+	client.PayloadHash = s3.PayloadHashStreaming
+	err := client.Bucket("bucket").PutReader("name", strings.NewReader("content"), 7, "text/plain", s3.Private, "", "")
+	c.Assert(err, IsNil)
+
+	req := testServer.WaitRequest()
+	c.Assert(req.Header.Get("x-amz-content-sha256"), Equals, "STREAMING-UNSIGNED-PAYLOAD-TRAILER")
+	c.Assert(req.Header.Get("Content-Encoding"), Equals, "aws-chunked")
+	c.Assert(req.Header.Get("x-amz-decoded-content-length"), Equals, "7")
+	c.Assert(req.Header.Get("x-amz-trailer"), Equals, "x-amz-checksum-crc32c")
+
+	sum := crc32.Checksum([]byte("content"), crc32.MakeTable(crc32.Castagnoli))
+	checksum := base64.StdEncoding.EncodeToString([]byte{byte(sum >> 24), byte(sum >> 16), byte(sum >> 8), byte(sum)})
+	body, err := ioutil.ReadAll(req.Body)
+	c.Assert(err, IsNil)
+	c.Assert(string(body), Equals, "4\r\ncont\r\n3\r\nent\r\n0\r\nx-amz-checksum-crc32c:"+checksum+"\r\n\r\n")
+	c.Assert(req.ContentLength, Equals, int64(len(body)))
+}
+
+func (s *S) TestPayloadHashStreamingPart(c *C) {
+	testServer.Response(200, nil, InitMultiResultDump)
+	testServer.Response(200, map[string]string{"ETag": `"26f0c9d6"`}, "")
+
+	client, _ := s.v4Client()
+	client.PayloadHash = s3.PayloadHashStreaming
+	multi, err := client.Bucket("sample").InitMulti("multi", "text/plain", s3.Private)
+	c.Assert(err, IsNil)
+	_, err = multi.PutPartHash(1, strings.NewReader("<part 1>"), 8, "", "")
+	c.Assert(err, IsNil)
+
+	testServer.WaitRequest()
+	req := testServer.WaitRequest()
+	c.Assert(req.Header.Get("x-amz-content-sha256"), Equals, "STREAMING-UNSIGNED-PAYLOAD-TRAILER")
+	c.Assert(req.Header.Get("x-amz-decoded-content-length"), Equals, "8")
+	c.Assert(strings.HasPrefix(readAll(req.Body), "8\r\n<part 1>\r\n0\r\n"), Equals, true)
+}
+
+func (s *S) TestPayloadHashV2Ignored(c *C) {
+	testServer.Response(200, nil, "")
+
+	client := s3.New(s.s3.Auth, s.s3.Region)
+	client.PayloadHash = s3.PayloadHashStreaming
+	err := client.Bucket("bucket").Put("name", []byte("content"), "text/plain", s3.Private)
+	c.Assert(err, IsNil)
+
+	req := testServer.WaitRequest()
+	c.Assert(req.Header.Get("Content-Encoding"), Equals, "")
+	c.Assert(readAll(req.Body), Equals, "content")
+}
@@ -0,0 +1,93 @@
+package s3
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// PostOptions holds the settings of a browser-based upload presigned with
+// PresignPost.
+type PostOptions struct {
+	// MinSize and MaxSize bound the size in bytes of the uploaded
+	// file (content-length-range condition). MaxSize is required, so
+	// that browsers can't upload files of any size.
+	MinSize, MaxSize int64
+	// ContentType, if set, is the content type the upload must have.
+	ContentType string
+	// ACL, if set, is the canned ACL of the uploaded object.
+	ACL ACL
+}
+
+// PostForm holds what a browser needs to upload a file with a POST
+// request: the form is posted to URL with Fields as hidden fields, and
+// the file as the last field, named "file".
+type PostForm struct {
+	URL    string
+	Fields map[string]string
+	// Policy is the JSON policy document, which Fields holds base64
+	// encoded and signed.
+	Policy string
+}
+
+// postPolicy is the policy document of a POST upload.
+type postPolicy struct {
+	Expiration string        `json:"expiration"`
+	Conditions []interface{} `json:"conditions"`
+}
+
+// PresignPost returns the form for uploading an object at key in b from
+// a browser with a POST request, signed with Signature Version 4. The
+// form is accepted until expiration, which must be at most seven days
+// away, and only for files whose size is within the bounds set by
+// options.
+//
+// See https://docs.aws.amazon.com/AmazonS3/latest/API/sigv4-HTTPPOSTConstructPolicy.html
+// for details.
+func (b *Bucket) PresignPost(key string, expiration time.Time, options PostOptions) (*PostForm, error) {
+	t := b.S3.now().UTC()
+	if err := checkPresignExpiry(expiration.Sub(t)); err != nil {
+		return nil, err
+	}
+	if options.MaxSize <= 0 || options.MinSize < 0 || options.MinSize > options.MaxSize {
+		return nil, fmt.Errorf("bad POST upload size range: %d-%d", options.MinSize, options.MaxSize)
+	}
+	signer := b.S3.signer(b.Name)
+	fields := map[string]string{
+		"key":              key,
+		"x-amz-algorithm":  "AWS4-HMAC-SHA256",
+		"x-amz-credential": b.S3.AccessKey + "/" + signer.credentialScope(t, signer.region.Name),
+		"x-amz-date":       t.Format(ISO8601BasicFormat),
+	}
+	if options.ContentType != "" {
+		fields["Content-Type"] = options.ContentType
+	}
+	if options.ACL != "" {
+		fields["acl"] = string(options.ACL)
+	}
+	policy := postPolicy{
+		Expiration: expiration.UTC().Format("2006-01-02T15:04:05.000Z"),
+		Conditions: []interface{}{
+			map[string]string{"bucket": b.Name},
+			[]interface{}{"content-length-range", options.MinSize, options.MaxSize},
+		},
+	}
+	for _, name := range []string{"key", "acl", "Content-Type", "x-amz-algorithm", "x-amz-credential", "x-amz-date"} {
+		if value, ok := fields[name]; ok {
+			policy.Conditions = append(policy.Conditions, map[string]string{name: value})
+		}
+	}
+	data, err := json.Marshal(&policy)
+	if err != nil {
+		return nil, err
+	}
+	encoded := base64.StdEncoding.EncodeToString(data)
+	fields["policy"] = encoded
+	fields["x-amz-signature"] = fmt.Sprintf("%x", HMAC(signer.derivedKey(t), []byte(encoded)))
+	return &PostForm{
+		URL:    b.URL("/"),
+		Fields: fields,
+		Policy: string(data),
+	}, nil
+}
@@ -0,0 +1,61 @@
+package s3_test
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/koofr/goamz/aws"
+	"github.com/koofr/goamz/s3"
+)
+
+func (s *S) TestPresignPost(c *C) {
+	now := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	client := s3.New(testAuth, aws.EUWest)
+	s3.SetClock(client, func() time.Time { return now })
+	b := client.Bucket("uploads")
+
+	form, err := b.PresignPost("user/photo.jpg", now.Add(2*time.Hour), s3.PostOptions{
+		MaxSize:     1 << 20,
+		ContentType: "image/jpeg",
+		ACL:         s3.PublicRead,
+	})
+	c.Assert(err, IsNil)
+	c.Assert(form.URL, Equals, "https://s3-eu-west-1.amazonaws.com/uploads/")
+	c.Assert(form.Policy, Equals, `{"expiration":"2025-03-01T14:00:00.000Z","conditions":[`+
+		`{"bucket":"uploads"},["content-length-range",0,1048576],`+
+		`{"key":"user/photo.jpg"},{"acl":"public-read"},{"Content-Type":"image/jpeg"},`+
+		`{"x-amz-algorithm":"AWS4-HMAC-SHA256"},`+
+		`{"x-amz-credential":"0PN5J17HBGZHT7JJ3X82/20250301/eu-west-1/s3/aws4_request"},`+
+		`{"x-amz-date":"20250301T120000Z"}]}`)
+
+	fields := form.Fields
+	c.Assert(fields["key"], Equals, "user/photo.jpg")
+	c.Assert(fields["acl"], Equals, "public-read")
+	c.Assert(fields["Content-Type"], Equals, "image/jpeg")
+	c.Assert(fields["x-amz-algorithm"], Equals, "AWS4-HMAC-SHA256")
+	c.Assert(fields["x-amz-credential"], Equals, "0PN5J17HBGZHT7JJ3X82/20250301/eu-west-1/s3/aws4_request")
+	c.Assert(fields["x-amz-date"], Equals, "20250301T120000Z")
+	policy, err := base64.StdEncoding.DecodeString(fields["policy"])
+	c.Assert(err, IsNil)
+	c.Assert(string(policy), Equals, form.Policy)
+	var decoded map[string]interface{}
+	c.Assert(json.Unmarshal(policy, &decoded), IsNil)
+
+	// The signature is the one S3 computes from the posted fields.
+	key := s3.HMAC([]byte("AWS4"+testAuth.SecretKey), []byte("20250301"))
+	key = s3.HMAC(key, []byte("eu-west-1"))
+	key = s3.HMAC(key, []byte("s3"))
+	key = s3.HMAC(key, []byte("aws4_request"))
+	c.Assert(fields["x-amz-signature"], Equals, fmt.Sprintf("%x", s3.HMAC(key, []byte(fields["policy"]))))
+
+	_, err = b.PresignPost("key", now.Add(8*24*time.Hour), s3.PostOptions{MaxSize: 1})
+	c.Assert(err, ErrorMatches, "bad presigned URL expiry: .*")
+	_, err = b.PresignPost("key", now.Add(-time.Hour), s3.PostOptions{MaxSize: 1})
+	c.Assert(err, ErrorMatches, "bad presigned URL expiry: .*")
+	_, err = b.PresignPost("key", now.Add(time.Hour), s3.PostOptions{})
+	c.Assert(err, ErrorMatches, "bad POST upload size range: 0-0")
+}
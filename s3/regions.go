@@ -0,0 +1,150 @@
+package s3
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// Limits of the bucket region cache. Here just for testing.
+var (
+	regionCacheSize = 1000
+	regionCacheTTL  = time.Hour
+)
+
+// regionCache is a bounded LRU cache mapping bucket names to the
+// names of the regions they live in. Entries expire after ttl, as told
+// by now. A nil *regionCache caches nothing.
+type regionCache struct {
+	mu      sync.Mutex
+	size    int
+	ttl     time.Duration
+	now     func() time.Time
+	order   *list.List // of *regionEntry, most recently used first
+	entries map[string]*list.Element
+}
+
+type regionEntry struct {
+	bucket  string
+	region  string
+	expires time.Time
+}
+
+func newRegionCache(size int, ttl time.Duration, now func() time.Time) *regionCache {
+	return &regionCache{
+		size:    size,
+		ttl:     ttl,
+		now:     now,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+// get returns the cached region of bucket, if any.
+func (c *regionCache) get(bucket string) (region string, ok bool) {
+	if c == nil {
+		return "", false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[bucket]
+	if !ok {
+		return "", false
+	}
+	entry := e.Value.(*regionEntry)
+	if c.now().After(entry.expires) {
+		c.order.Remove(e)
+		delete(c.entries, bucket)
+		return "", false
+	}
+	c.order.MoveToFront(e)
+	return entry.region, true
+}
+
+// add caches region as the region of bucket, evicting the least
+// recently used entry if the cache is full.
+func (c *regionCache) add(bucket, region string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	expires := c.now().Add(c.ttl)
+	if e, ok := c.entries[bucket]; ok {
+		entry := e.Value.(*regionEntry)
+		entry.region = region
+		entry.expires = expires
+		c.order.MoveToFront(e)
+		return
+	}
+	c.entries[bucket] = c.order.PushFront(&regionEntry{bucket, region, expires})
+	for c.order.Len() > c.size {
+		e := c.order.Back()
+		c.order.Remove(e)
+		delete(c.entries, e.Value.(*regionEntry).bucket)
+	}
+}
+
+// clear removes all entries from the cache.
+func (c *regionCache) clear() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	c.order.Init()
+	c.entries = make(map[string]*list.Element)
+	c.mu.Unlock()
+}
+
+// SetBucketRegion records region as the region of the named bucket,
+// so that V4 signed requests to it are signed for that region.
+// Regions are also recorded by Location and discovered from the
+// x-amz-bucket-region header of S3 responses. Recorded regions are
+// kept for a limited time in a cache of bounded size.
+func (s3 *S3) SetBucketRegion(bucket, region string) {
+	s3.regions.add(bucket, region)
+}
+
+// ClearBucketRegions forgets all recorded bucket regions.
+func (s3 *S3) ClearBucketRegions() {
+	s3.regions.clear()
+}
+
+var locationEndpoints = map[string]string{
+	"":   "us-east-1",
+	"EU": "eu-west-1",
+}
+
+// Location returns the name of the region the bucket lives in.
+// The result is cached, so repeated calls for the same bucket don't
+// issue further requests.
+//
+// See https://docs.aws.amazon.com/AmazonS3/latest/API/API_GetBucketLocation.html for details.
+func (b *Bucket) Location() (string, error) {
+	if region, ok := b.S3.regions.get(b.Name); ok {
+		return region, nil
+	}
+	req := &request{
+		bucket: b.Name,
+		params: map[string][]string{"location": {""}},
+	}
+	var resp struct {
+		LocationConstraint string `xml:",chardata"`
+	}
+	var err error
+	for attempt := b.S3.startAttempts(); attempt.Next(); {
+		err = b.S3.query(req, &resp)
+		if !b.S3.shouldRetry(req.method, err) {
+			break
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+	region := resp.LocationConstraint
+	if r, ok := locationEndpoints[region]; ok {
+		region = r
+	}
+	b.S3.regions.add(b.Name, region)
+	return region, nil
+}
@@ -0,0 +1,142 @@
+package s3_test
+
+import (
+	"strings"
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/koofr/goamz/aws"
+	"github.com/koofr/goamz/s3"
+)
+
+func (s *S) v4Client() (*s3.S3, aws.Region) {
+	region := aws.Region{
+		Name:          "faux-region-1",
+		S3Endpoint:    testServer.URL,
+		S3V4Signature: true,
+	}
+	return s3.New(s.s3.Auth, region), region
+}
+
+func (s *S) TestLocationCachesRegion(c *C) {
+	testServer.Response(200, nil, GetLocationResultDump)
+	testServer.Response(200, nil, "content")
+
+	client, _ := s.v4Client()
+	b := client.Bucket("bucket")
+
+	location, err := b.Location()
+	c.Assert(err, IsNil)
+	c.Assert(location, Equals, "eu-central-1")
+
+	req := testServer.WaitRequest()
+	c.Assert(req.Method, Equals, "GET")
+	c.Assert(req.URL.Path, Equals, "/bucket/")
+	c.Assert(req.Form["location"], DeepEquals, []string{""})
+
+	location, err = b.Location()
+	c.Assert(err, IsNil)
+	c.Assert(location, Equals, "eu-central-1")
+
+	_, err = b.Get("name")
+	c.Assert(err, IsNil)
+
+	// The next request is the Get, signed for the cached region.
+	req = testServer.WaitRequest()
+	c.Assert(req.URL.Path, Equals, "/bucket/name")
+	c.Assert(req.Header.Get("Authorization"), Matches, ".*/eu-central-1/s3/aws4_request.*")
+	checkV4Signature(c, req, s.s3.Auth, aws.Region{Name: "eu-central-1"})
+}
+
+func (s *S) TestBucketRegionFromResponse(c *C) {
+	testServer.Response(200, map[string]string{"x-amz-bucket-region": "ap-south-1"}, "content")
+	testServer.Response(200, nil, "content")
+
+	client, region := s.v4Client()
+	b := client.Bucket("bucket")
+
+	_, err := b.Get("name")
+	c.Assert(err, IsNil)
+	req := testServer.WaitRequest()
+	checkV4Signature(c, req, s.s3.Auth, region)
+
+	_, err = b.Get("name")
+	c.Assert(err, IsNil)
+	req = testServer.WaitRequest()
+	c.Assert(req.Header.Get("Authorization"), Matches, ".*/ap-south-1/s3/aws4_request.*")
+
+	location, err := b.Location()
+	c.Assert(err, IsNil)
+	c.Assert(location, Equals, "ap-south-1")
+}
+
+func (s *S) TestSetAndClearBucketRegions(c *C) {
+	testServer.Response(200, nil, "content")
+	testServer.Response(200, nil, "content")
+
+	client, _ := s.v4Client()
+	b := client.Bucket("bucket")
+
+	client.SetBucketRegion("bucket", "us-west-2")
+	_, err := b.Get("name")
+	c.Assert(err, IsNil)
+	req := testServer.WaitRequest()
+	c.Assert(req.Header.Get("Authorization"), Matches, ".*/us-west-2/s3/aws4_request.*")
+
+	client.ClearBucketRegions()
+	_, err = b.Get("name")
+	c.Assert(err, IsNil)
+	req = testServer.WaitRequest()
+	c.Assert(req.Header.Get("Authorization"), Matches, ".*/faux-region-1/s3/aws4_request.*")
+}
+
+func (s *S) TestBucketRegionCacheLimits(c *C) {
+	defer s3.SetRegionCacheLimits(s3.RegionCacheLimits())
+	s3.SetRegionCacheLimits(2, time.Minute)
+
+	testServer.Responses(3, 200, nil, GetLocationResultDump)
+
+	client, _ := s.v4Client()
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	s3.SetClock(client, func() time.Time { return now })
+	client.SetBucketRegion("a", "us-west-1")
+	client.SetBucketRegion("b", "us-west-2")
+	client.SetBucketRegion("c", "eu-west-1")
+
+	// "a" was evicted.
+	location, err := client.Bucket("a").Location()
+	c.Assert(err, IsNil)
+	c.Assert(location, Equals, "eu-central-1")
+	testServer.WaitRequest()
+
+	location, err = client.Bucket("c").Location()
+	c.Assert(err, IsNil)
+	c.Assert(location, Equals, "eu-west-1")
+
+	// Entries expire.
+	now = now.Add(time.Minute + time.Second)
+	location, err = client.Bucket("c").Location()
+	c.Assert(err, IsNil)
+	c.Assert(location, Equals, "eu-central-1")
+	testServer.WaitRequest()
+}
+
+func (s *S) TestCustomRegion(c *C) {
+	testServer.Response(200, nil, "content")
+
+	region := aws.CustomRegion("storage-west-2", testServer.URL)
+	c.Assert(region.Name, Equals, "storage-west-2")
+	c.Assert(region.S3Endpoint, Equals, testServer.URL)
+	c.Assert(region.S3V4Signature, Equals, true)
+
+	b := s3.New(s.s3.Auth, region).Bucket("bucket")
+	_, err := b.Get("name")
+	c.Assert(err, IsNil)
+
+	req := testServer.WaitRequest()
+	c.Assert(req.Host, Equals, strings.TrimPrefix(testServer.URL, "http://"))
+	c.Assert(req.URL.Path, Equals, "/bucket/name")
+	c.Assert(req.Header.Get("Authorization"), Matches, ".*/storage-west-2/s3/aws4_request.*")
+	checkV4Signature(c, req, s.s3.Auth, region)
+}
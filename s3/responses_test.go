@@ -7,6 +7,13 @@ var GetObjectErrorDump = `
 <HostId>L4ee/zrm1irFXY5F45fKXIRdOf9ktsKY/8TDVawuMK2jWRb1RF84i1uBzkdNqS5D</HostId></Error>
 `
 
+var TemporaryRedirectDump = `
+<?xml version="1.0" encoding="UTF-8"?>
+<Error><Code>TemporaryRedirect</Code><Message>Please re-send this request to the specified temporary endpoint. Continue to use the original request endpoint for future requests.</Message>
+<Endpoint>bucket.s3-eu-west-1.amazonaws.com</Endpoint><Bucket>bucket</Bucket>
+<RequestId>7D1D2B0E11B6E9A3</RequestId><HostId>rVqL2/1sQ8nF+DqUqJsNvBmT5y1c8r2r0Dk9jYh8x0E=</HostId></Error>
+`
+
 var GetListResultDump1 = `
 <?xml version="1.0" encoding="UTF-8"?>
 <ListBucketResult xmlns="http://s3.amazonaws.com/doc/2006-03-01">
@@ -38,6 +45,40 @@ var GetListResultDump1 = `
 </ListBucketResult>
 `
 
+var GetListUsageDump1 = `
+<?xml version="1.0" encoding="UTF-8"?>
+<ListBucketResult xmlns="http://s3.amazonaws.com/doc/2006-03-01/">
+  <Name>bucket</Name>
+  <Prefix>logs/</Prefix>
+  <IsTruncated>true</IsTruncated>
+  <Contents>
+    <Key>logs/a</Key>
+    <Size>100</Size>
+    <StorageClass>STANDARD</StorageClass>
+  </Contents>
+  <Contents>
+    <Key>logs/b</Key>
+    <Size>2000</Size>
+    <StorageClass>GLACIER</StorageClass>
+  </Contents>
+</ListBucketResult>
+`
+
+var GetListUsageDump2 = `
+<?xml version="1.0" encoding="UTF-8"?>
+<ListBucketResult xmlns="http://s3.amazonaws.com/doc/2006-03-01/">
+  <Name>bucket</Name>
+  <Prefix>logs/</Prefix>
+  <Marker>logs/b</Marker>
+  <IsTruncated>false</IsTruncated>
+  <Contents>
+    <Key>logs/c</Key>
+    <Size>30</Size>
+    <StorageClass>STANDARD</StorageClass>
+  </Contents>
+</ListBucketResult>
+`
+
 var GetListResultDump2 = `
 <ListBucketResult xmlns="http://s3.amazonaws.com/doc/2006-03-01/">
   <Name>example-bucket</Name>
@@ -175,6 +216,54 @@ var ListMultiResultDump = `
 </ListMultipartUploadsResult>
 `
 
+var ListMultiInitiatorResultDump = `
+<?xml version="1.0"?>
+<ListMultipartUploadsResult xmlns="http://s3.amazonaws.com/doc/2006-03-01/">
+  <Bucket>goamz-test-bucket-us-east-1-akiajk3wyewhctyqbf7a</Bucket>
+  <KeyMarker/>
+  <UploadIdMarker/>
+  <NextKeyMarker>multi1</NextKeyMarker>
+  <NextUploadIdMarker>iUVug89pPvSswrikD72p8uO62EzhNtpDxRmwC5WSiWDdK9SfzmDqe3xpP1kMWimyimSnz4uzFc3waVM5ufrKYQ--</NextUploadIdMarker>
+  <Delimiter>/</Delimiter>
+  <MaxUploads>1000</MaxUploads>
+  <IsTruncated>false</IsTruncated>
+  <Upload>
+    <Key>multi1</Key>
+    <UploadId>iUVug89pPvSswrikD</UploadId>
+    <Initiator>
+      <ID>bb5c0f63b0b25f2d0</ID>
+      <DisplayName>gustavoniemeyer</DisplayName>
+    </Initiator>
+    <Owner>
+      <ID>bb5c0f63b0b25f2d0</ID>
+      <DisplayName>gustavoniemeyer</DisplayName>
+    </Owner>
+    <StorageClass>STANDARD</StorageClass>
+    <Initiated>2013-01-30T18:15:47.000Z</Initiated>
+  </Upload>
+  <Upload>
+    <Key>multi2</Key>
+    <UploadId>DkirwsSvPp98guVUi</UploadId>
+    <Initiator>
+      <ID>8a6925ce4adf588a4</ID>
+      <DisplayName>joe</DisplayName>
+    </Initiator>
+    <Owner>
+      <ID>bb5c0f63b0b25f2d0</ID>
+      <DisplayName>gustavoniemeyer</DisplayName>
+    </Owner>
+    <StorageClass>STANDARD_IA</StorageClass>
+    <Initiated>2013-01-30T18:15:47.000Z</Initiated>
+  </Upload>
+  <CommonPrefixes>
+    <Prefix>a/</Prefix>
+  </CommonPrefixes>
+  <CommonPrefixes>
+    <Prefix>b/</Prefix>
+  </CommonPrefixes>
+</ListMultipartUploadsResult>
+`
+
 var NoSuchUploadErrorDump = `
 <?xml version="1.0" encoding="UTF-8"?>
 <Error>
@@ -196,3 +285,327 @@ var InternalErrorDump = `
   <HostId>kjhwqk</HostId>
 </Error>
 `
+
+var BadDigestErrorDump = `
+<?xml version="1.0" encoding="UTF-8"?>
+<Error>
+  <Code>BadDigest</Code>
+  <Message>The Content-MD5 you specified did not match what we received.</Message>
+  <RequestId>3F1B667FAD71C3D8</RequestId>
+  <HostId>kjhwqk</HostId>
+</Error>
+`
+
+var PreconditionFailedDump = `
+<?xml version="1.0" encoding="UTF-8"?>
+<Error>
+  <Code>PreconditionFailed</Code>
+  <Message>At least one of the pre-conditions you specified did not hold</Message>
+  <Condition>If-None-Match</Condition>
+  <RequestId>3F1B667FAD71C3D8</RequestId>
+  <HostId>kjhwqk</HostId>
+</Error>
+`
+
+var NoSuchKeyErrorDump = `
+<?xml version="1.0" encoding="UTF-8"?>
+<Error>
+  <Code>NoSuchKey</Code>
+  <Message>The specified key does not exist.</Message>
+  <Key>.goamz-probe</Key>
+  <RequestId>3F1B667FAD71C3D8</RequestId>
+  <HostId>kjhwqk</HostId>
+</Error>
+`
+
+var AccessDeniedErrorDump = `
+<?xml version="1.0" encoding="UTF-8"?>
+<Error>
+  <Code>AccessDenied</Code>
+  <Message>Access Denied</Message>
+  <RequestId>3F1B667FAD71C3D8</RequestId>
+  <HostId>kjhwqk</HostId>
+</Error>
+`
+
+var GetObjectAttributesDump = `
+<?xml version="1.0" encoding="UTF-8"?>
+<GetObjectAttributesResponse xmlns="http://s3.amazonaws.com/doc/2006-03-01/">
+  <ETag>d41d8cd98f00b204e9800998ecf8427e-2</ETag>
+  <ObjectParts>
+    <PartsCount>2</PartsCount>
+    <PartNumberMarker>0</PartNumberMarker>
+    <NextPartNumberMarker>2</NextPartNumberMarker>
+    <MaxParts>1000</MaxParts>
+    <IsTruncated>false</IsTruncated>
+    <Part>
+      <PartNumber>1</PartNumber>
+      <Size>5242880</Size>
+      <ChecksumCRC32C>3S1Zxw==</ChecksumCRC32C>
+    </Part>
+    <Part>
+      <PartNumber>2</PartNumber>
+      <Size>1024</Size>
+      <ChecksumCRC32C>yZRlqg==</ChecksumCRC32C>
+    </Part>
+  </ObjectParts>
+</GetObjectAttributesResponse>
+`
+
+var CopyObjectResultDump = `
+<?xml version="1.0" encoding="UTF-8"?>
+<CopyObjectResult xmlns="http://s3.amazonaws.com/doc/2006-03-01/">
+  <LastModified>2009-10-28T22:32:00.000Z</LastModified>
+  <ETag>&quot;9b2cf535f27731c974343645a3985328&quot;</ETag>
+</CopyObjectResult>
+`
+
+var CompleteMultiResultDump = `
+<?xml version="1.0" encoding="UTF-8"?>
+<CompleteMultipartUploadResult xmlns="http://s3.amazonaws.com/doc/2006-03-01/">
+  <Location>http://sample.s3.amazonaws.com/multi</Location>
+  <Bucket>sample</Bucket>
+  <Key>multi</Key>
+  <ETag>&quot;3858f62230ac3c915f300c664312c11f-9&quot;</ETag>
+</CompleteMultipartUploadResult>
+`
+
+var ListPrefixesResultDump1 = `
+<?xml version="1.0" encoding="UTF-8"?>
+<ListBucketResult xmlns="http://s3.amazonaws.com/doc/2006-03-01/">
+  <Name>example-bucket</Name>
+  <Prefix>photos/</Prefix>
+  <Marker></Marker>
+  <NextMarker>photos/2006/</NextMarker>
+  <MaxKeys>2</MaxKeys>
+  <Delimiter>/</Delimiter>
+  <IsTruncated>true</IsTruncated>
+  <Contents>
+    <Key>photos/index.html</Key>
+    <LastModified>2006-01-01T12:00:00.000Z</LastModified>
+    <ETag>&quot;828ef3fdfa96f00ad9f27c383fc9ac7f&quot;</ETag>
+    <Size>5</Size>
+    <StorageClass>STANDARD</StorageClass>
+  </Contents>
+  <CommonPrefixes>
+    <Prefix>photos/2006/</Prefix>
+  </CommonPrefixes>
+</ListBucketResult>
+`
+
+var ListInterleavedResultDump1 = `
+<?xml version="1.0" encoding="UTF-8"?>
+<ListBucketResult xmlns="http://s3.amazonaws.com/doc/2006-03-01/">
+  <Name>example-bucket</Name>
+  <Prefix></Prefix>
+  <Marker></Marker>
+  <NextMarker>d/</NextMarker>
+  <MaxKeys>4</MaxKeys>
+  <Delimiter>/</Delimiter>
+  <IsTruncated>true</IsTruncated>
+  <Contents>
+    <Key>a.txt</Key>
+    <LastModified>2006-01-01T12:00:00.000Z</LastModified>
+    <ETag>&quot;828ef3fdfa96f00ad9f27c383fc9ac7f&quot;</ETag>
+    <Size>5</Size>
+    <StorageClass>STANDARD</StorageClass>
+  </Contents>
+  <Contents>
+    <Key>c.txt</Key>
+    <LastModified>2006-01-01T12:00:00.000Z</LastModified>
+    <ETag>&quot;828ef3fdfa96f00ad9f27c383fc9ac7f&quot;</ETag>
+    <Size>5</Size>
+    <StorageClass>STANDARD</StorageClass>
+  </Contents>
+  <CommonPrefixes>
+    <Prefix>b/</Prefix>
+  </CommonPrefixes>
+  <CommonPrefixes>
+    <Prefix>d/</Prefix>
+  </CommonPrefixes>
+</ListBucketResult>
+`
+
+var ListInterleavedResultDump2 = `
+<?xml version="1.0" encoding="UTF-8"?>
+<ListBucketResult xmlns="http://s3.amazonaws.com/doc/2006-03-01/">
+  <Name>example-bucket</Name>
+  <Prefix></Prefix>
+  <Marker>d/</Marker>
+  <MaxKeys>4</MaxKeys>
+  <Delimiter>/</Delimiter>
+  <IsTruncated>false</IsTruncated>
+  <Contents>
+    <Key>e.txt</Key>
+    <LastModified>2006-01-01T12:00:00.000Z</LastModified>
+    <ETag>&quot;828ef3fdfa96f00ad9f27c383fc9ac7f&quot;</ETag>
+    <Size>5</Size>
+    <StorageClass>STANDARD</StorageClass>
+  </Contents>
+  <CommonPrefixes>
+    <Prefix>f/</Prefix>
+  </CommonPrefixes>
+</ListBucketResult>
+`
+
+var ListEncodedResultDump = `
+<?xml version="1.0" encoding="UTF-8"?>
+<ListBucketResult xmlns="http://s3.amazonaws.com/doc/2006-03-01/">
+  <Name>example-bucket</Name>
+  <Prefix>notes%2F</Prefix>
+  <Marker></Marker>
+  <MaxKeys>1000</MaxKeys>
+  <Delimiter>%2F</Delimiter>
+  <EncodingType>url</EncodingType>
+  <IsTruncated>false</IsTruncated>
+  <Contents>
+    <Key>notes%2Fline%0Abreak+and%01control.txt</Key>
+    <LastModified>2006-01-01T12:00:00.000Z</LastModified>
+    <ETag>&quot;828ef3fdfa96f00ad9f27c383fc9ac7f&quot;</ETag>
+    <Size>5</Size>
+    <StorageClass>STANDARD</StorageClass>
+  </Contents>
+  <CommonPrefixes>
+    <Prefix>notes%2F%E2%9C%93%2F</Prefix>
+  </CommonPrefixes>
+</ListBucketResult>
+`
+
+var ListPrefixesResultDump2 = `
+<?xml version="1.0" encoding="UTF-8"?>
+<ListBucketResult xmlns="http://s3.amazonaws.com/doc/2006-03-01/">
+  <Name>example-bucket</Name>
+  <Prefix>photos/</Prefix>
+  <Marker>photos/2006/</Marker>
+  <MaxKeys>2</MaxKeys>
+  <Delimiter>/</Delimiter>
+  <IsTruncated>false</IsTruncated>
+  <CommonPrefixes>
+    <Prefix>photos/2007/</Prefix>
+  </CommonPrefixes>
+  <CommonPrefixes>
+    <Prefix>photos/2008/</Prefix>
+  </CommonPrefixes>
+</ListBucketResult>
+`
+
+var GetLocationResultDump = `
+<?xml version="1.0" encoding="UTF-8"?>
+<LocationConstraint xmlns="http://s3.amazonaws.com/doc/2006-03-01/">eu-central-1</LocationConstraint>
+`
+
+var GetACLResultDump = `
+<?xml version="1.0" encoding="UTF-8"?>
+<AccessControlPolicy xmlns="http://s3.amazonaws.com/doc/2006-03-01/">
+  <Owner>
+    <ID>75aa57f09aa0c8caeab4f8c24e99d10f8e7faeebf76c078efc7c6caea54ba06a</ID>
+    <DisplayName>CustomersName@amazon.com</DisplayName>
+  </Owner>
+  <AccessControlList>
+    <Grant>
+      <Grantee xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xsi:type="CanonicalUser">
+        <ID>75aa57f09aa0c8caeab4f8c24e99d10f8e7faeebf76c078efc7c6caea54ba06a</ID>
+        <DisplayName>CustomersName@amazon.com</DisplayName>
+      </Grantee>
+      <Permission>FULL_CONTROL</Permission>
+    </Grant>
+    <Grant>
+      <Grantee xmlns:xsi="http://www.w3.org/2001/XMLSchema-instance" xsi:type="Group">
+        <URI>http://acs.amazonaws.com/groups/global/AllUsers</URI>
+      </Grantee>
+      <Permission>READ</Permission>
+    </Grant>
+  </AccessControlList>
+</AccessControlPolicy>
+`
+
+var DiffListResultDump = `
+<?xml version="1.0" encoding="UTF-8"?>
+<ListBucketResult xmlns="http://s3.amazonaws.com/doc/2006-03-01/">
+  <Name>bucket</Name>
+  <Prefix>backup/</Prefix>
+  <IsTruncated>false</IsTruncated>
+  <Contents>
+    <Key>backup/changed-content</Key>
+    <ETag>&quot;828ef3fdfa96f00ad9f27c383fc9ac7f&quot;</ETag>
+    <Size>5</Size>
+  </Contents>
+  <Contents>
+    <Key>backup/changed-size</Key>
+    <ETag>&quot;828ef3fdfa96f00ad9f27c383fc9ac7f&quot;</ETag>
+    <Size>5</Size>
+  </Contents>
+  <Contents>
+    <Key>backup/deleted</Key>
+    <ETag>&quot;828ef3fdfa96f00ad9f27c383fc9ac7f&quot;</ETag>
+    <Size>5</Size>
+  </Contents>
+  <Contents>
+    <Key>backup/multipart</Key>
+    <ETag>&quot;3858f62230ac3c915f300c664312c11f-2&quot;</ETag>
+    <Size>10485760</Size>
+  </Contents>
+  <Contents>
+    <Key>backup/multipart-unknown</Key>
+    <ETag>&quot;3858f62230ac3c915f300c664312c11f-2&quot;</ETag>
+    <Size>10485760</Size>
+  </Contents>
+  <Contents>
+    <Key>backup/unchanged</Key>
+    <ETag>&quot;828ef3fdfa96f00ad9f27c383fc9ac7f&quot;</ETag>
+    <Size>5</Size>
+  </Contents>
+</ListBucketResult>
+`
+
+var GetObjectLockConfigurationDump = `
+<?xml version="1.0" encoding="UTF-8"?>
+<ObjectLockConfiguration xmlns="http://s3.amazonaws.com/doc/2006-03-01/">
+  <ObjectLockEnabled>Enabled</ObjectLockEnabled>
+  <Rule>
+    <DefaultRetention>
+      <Mode>COMPLIANCE</Mode>
+      <Years>7</Years>
+    </DefaultRetention>
+  </Rule>
+</ObjectLockConfiguration>
+`
+
+var ListModifiedDump1 = `
+<?xml version="1.0" encoding="UTF-8"?>
+<ListBucketResult xmlns="http://s3.amazonaws.com/doc/2006-03-01/">
+  <Name>bucket</Name>
+  <Prefix>backup/</Prefix>
+  <IsTruncated>true</IsTruncated>
+  <Contents>
+    <Key>backup/a</Key>
+    <LastModified>2025-02-28T23:59:59.000Z</LastModified>
+    <Size>10</Size>
+  </Contents>
+  <Contents>
+    <Key>backup/b</Key>
+    <LastModified>2025-03-01T00:00:00.000Z</LastModified>
+    <Size>20</Size>
+  </Contents>
+</ListBucketResult>
+`
+
+var ListModifiedDump2 = `
+<?xml version="1.0" encoding="UTF-8"?>
+<ListBucketResult xmlns="http://s3.amazonaws.com/doc/2006-03-01/">
+  <Name>bucket</Name>
+  <Prefix>backup/</Prefix>
+  <Marker>backup/b</Marker>
+  <IsTruncated>false</IsTruncated>
+  <Contents>
+    <Key>backup/c</Key>
+    <LastModified>2025-03-01T00:00:00.001Z</LastModified>
+    <Size>30</Size>
+  </Contents>
+  <Contents>
+    <Key>backup/d</Key>
+    <LastModified>2025-03-02T10:00:00.000Z</LastModified>
+    <Size>40</Size>
+  </Contents>
+</ListBucketResult>
+`
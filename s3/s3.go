@@ -12,15 +12,24 @@ package s3
 
 import (
 	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/xml"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"log"
+	"math"
+	"mime"
 	"net"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
+	"path"
 	"sort"
 	"strconv"
 	"strings"
@@ -35,6 +44,115 @@ const debug = false
 type S3 struct {
 	aws.Auth
 	aws.Region
+
+	// RequestModifier, if set, is called with every request after it
+	// has been built and before it is signed. Headers added by it are
+	// covered by the signature.
+	RequestModifier func(req *http.Request)
+
+	// UseAccelerate sends bucket requests to the S3 Transfer Acceleration
+	// endpoint (${bucket}.s3-accelerate.amazonaws.com). Requests are still
+	// signed for the configured region. Transfer acceleration requires
+	// virtual-hosted addressing, so buckets with dots in their names,
+	// which can only be addressed path-style, are rejected.
+	UseAccelerate bool
+
+	// SigningHost, if set, is sent as the Host header of requests and
+	// signed in place of the endpoint host. It allows reaching S3 through
+	// a proxy at the endpoint address while signing for the host S3 sees.
+	SigningHost string
+
+	// QuerySpaceAsPlus signs spaces in query parameters as "+" instead
+	// of "%20", for S3-compatible stores that expect it (see
+	// V4Signer.SpaceAsPlus).
+	QuerySpaceAsPlus bool
+
+	// SigningService, if set, is the service name V4 signatures are
+	// computed for in place of "s3", such as "s3-outposts" for S3 on
+	// Outposts. It is part of the credential scope of requests.
+	SigningService string
+
+	// AppendSupported enables AppendObject. AWS S3 general purpose
+	// buckets don't support appending to objects, but some S3-compatible
+	// stores do.
+	AppendSupported bool
+
+	// RangedPutSupported enables PutRange. AWS S3 doesn't support
+	// writing a byte range of an object, but some S3-compatible stores
+	// do.
+	RangedPutSupported bool
+
+	// OnRequestCharged, if set, is called with the response to every
+	// request for which S3 reports that the requester was charged, such
+	// as requests to requester-pays buckets. It allows metering charged
+	// requests, including failed ones.
+	OnRequestCharged func(resp *http.Response)
+
+	// NoRedirects disables following redirects sent by S3. Redirect
+	// responses are returned as a *RedirectError instead.
+	NoRedirects bool
+
+	// PayloadHash selects how the content of object and part uploads
+	// is covered by Signature Version 4 signatures. It defaults to
+	// PayloadHashSHA256, and has no effect on requests signed with
+	// Signature Version 2.
+	PayloadHash PayloadHashStrategy
+
+	// MaxResponseSize, if positive, is the maximum size in bytes of the
+	// XML response bodies decoded by operations such as List. Larger
+	// responses fail with ErrResponseTooLarge instead of being decoded
+	// into memory, which protects against misbehaving or hostile
+	// S3-compatible servers.
+	MaxResponseSize int64
+
+	// DisableSSL sends requests over plain HTTP even when the endpoint
+	// uses HTTPS, as when testing against a local S3-compatible store.
+	// URLs returned by URL, SignedURL and PresignURLs use HTTP as well.
+	// The scheme isn't signed, so signatures are unaffected.
+	DisableSSL bool
+
+	// RetryPolicy, if set, decides which failed requests are retried
+	// in place of the default rules. It allows retrying requests
+	// depending on their method, as with RetryMethods, or on the errors
+	// they failed with, such as specific HTTP status codes.
+	RetryPolicy RetryPolicy
+
+	// Attempts, if set, is the strategy for retrying failed requests
+	// in place of the package default (see RetryAttempts). Use
+	// Bucket.WithAttempts to change it for some requests only.
+	Attempts *aws.AttemptStrategy
+
+	// HTTP2 keeps connections open to be reused by later requests, and
+	// negotiates HTTP/2 with HTTPS endpoints that support it, such as
+	// those fronted by a load balancer or CDN, so that requests are
+	// multiplexed over them. By default, each request uses a new
+	// connection.
+	HTTP2 bool
+
+	// OnTrace, if set, is called after every request is sent with
+	// diagnostics about its connection and timing, which help finding
+	// where latency goes.
+	OnTrace func(trace *RequestTrace)
+
+	// DryRun, if set, puts the client in dry run mode: requests are
+	// built and signed as usual, but they are recorded in DryRun in
+	// place of being sent, and succeed with an empty response. Results
+	// that depend on the response, such as listings, are thus empty.
+	DryRun *DryRunLog
+
+	regions *regionCache
+
+	// headers are sent with every request, as set by the options of
+	// Bucket.With.
+	headers http.Header
+
+	// clock returns the current time; time.Now if nil. Tests set it
+	// to get deterministic dates and signatures.
+	clock func() time.Time
+	// sleep waits between attempts; time.Sleep if nil. Tests set it
+	// along with clock to follow retries on a fake clock.
+	sleep func(time.Duration)
+
 	private byte // Reserve the right of using private data.
 }
 
@@ -70,9 +188,42 @@ func RetryAttempts(retry bool) {
 	}
 }
 
+// retryDNSNotFound is set by RetryDNSNotFound.
+var retryDNSNotFound = false
+
+// RetryDNSNotFound sets whether S3 requests failing because the endpoint
+// host name doesn't exist (NXDOMAIN) may be retried. By default they fail
+// fast, as such failures usually come from a misconfigured endpoint.
+// Other DNS failures, such as timeouts, are always retried. It should
+// not be called while operations are in progress.
+func RetryDNSNotFound(retry bool) {
+	retryDNSNotFound = retry
+}
+
 // New creates a new S3.
 func New(auth aws.Auth, region aws.Region) *S3 {
-	return &S3{auth, region, 0}
+	s3 := &S3{
+		Auth:   auth,
+		Region: region,
+	}
+	s3.regions = newRegionCache(regionCacheSize, regionCacheTTL, s3.now)
+	return s3
+}
+
+// NewFromEnv creates a new S3 with the credentials and region found in
+// the environment or in the shared files used by the AWS CLI and SDKs
+// (see aws.DefaultAuth and aws.DefaultRegion). An error is returned if
+// either of them can't be found.
+func NewFromEnv() (*S3, error) {
+	auth, err := aws.DefaultAuth()
+	if err != nil {
+		return nil, err
+	}
+	region, err := aws.DefaultRegion()
+	if err != nil {
+		return nil, err
+	}
+	return New(auth, region), nil
 }
 
 // Bucket returns a Bucket with the given name.
@@ -83,6 +234,33 @@ func (s3 *S3) Bucket(name string) *Bucket {
 	return &Bucket{s3, name}
 }
 
+// WithAttempts returns a copy of b whose failed requests are retried
+// according to strategy, leaving b unchanged. A zero strategy makes
+// requests fail fast, as suits health checks, while requests such as
+// uploads keep retrying through b.
+func (b *Bucket) WithAttempts(strategy aws.AttemptStrategy) *Bucket {
+	return b.With(WithAttemptStrategy(strategy))
+}
+
+// startAttempts begins the attempts at a request of s3, following its
+// attempt strategy on its clock.
+func (s3 *S3) startAttempts() *aws.Attempt {
+	sleep := time.Sleep
+	if s3.sleep != nil {
+		sleep = s3.sleep
+	}
+	return s3.attemptStrategy().StartClock(s3.now, sleep)
+}
+
+// attemptStrategy returns the strategy for retrying the failed
+// requests of s3.
+func (s3 *S3) attemptStrategy() aws.AttemptStrategy {
+	if s3.Attempts != nil {
+		return *s3.Attempts
+	}
+	return attempts
+}
+
 var createBucketConfiguration = `<CreateBucketConfiguration xmlns="http://s3.amazonaws.com/doc/2006-03-01/">
   <LocationConstraint>%s</LocationConstraint>
 </CreateBucketConfiguration>`
@@ -137,22 +315,66 @@ func (b *Bucket) DelBucket() (err error) {
 		bucket: b.Name,
 		path:   "/",
 	}
-	for attempt := attempts.Start(); attempt.Next(); {
+	for attempt := b.S3.startAttempts(); attempt.Next(); {
+		err = b.S3.query(req, nil)
+		if !b.S3.shouldRetry(req.method, err) {
+			break
+		}
+	}
+	return err
+}
+
+// HeadBucket checks that the bucket exists and may be accessed. As HEAD
+// responses have no body, the error returned for a missing bucket or a
+// denied access is an *Error with the code set from the status, so it
+// matches ErrNoSuchBucket or ErrAccessDenied. Its Header holds the
+// X-Amz-Bucket-Region header if S3 sent it, as it does when the bucket
+// is in another region than the one the request was sent to.
+//
+// See https://docs.aws.amazon.com/AmazonS3/latest/API/API_HeadBucket.html for details.
+func (b *Bucket) HeadBucket() (err error) {
+	req := &request{
+		method: "HEAD",
+		bucket: b.Name,
+		path:   "/",
+	}
+	for attempt := b.S3.startAttempts(); attempt.Next(); {
 		err = b.S3.query(req, nil)
-		if !shouldRetry(err) {
+		if !b.S3.shouldRetry(req.method, err) {
 			break
 		}
 	}
+	if e, ok := err.(*Error); ok && e.Code == "" {
+		switch e.StatusCode {
+		case http.StatusNotFound:
+			e.Code = "NoSuchBucket"
+		case http.StatusForbidden:
+			e.Code = "AccessDenied"
+		}
+	}
 	return err
 }
 
 // Info retrieves an object info from an S3 bucket.
 // Failing S3 requests will not be retried
 func (b *Bucket) Info(path string) (key *Key, err error) {
+	return b.InfoWithOptions(path, GetOptions{})
+}
+
+// InfoWithOptions is like Info but also sends the request headers of
+// options, such as the SSE-C key without which S3 refuses to describe
+// objects encrypted with one.
+func (b *Bucket) InfoWithOptions(path string, options GetOptions) (key *Key, err error) {
+	headers := map[string][]string{}
+	err = options.addHeaders(headers)
+	if err != nil {
+		return nil, err
+	}
 	req := &request{
-		method: "HEAD",
-		bucket: b.Name,
-		path:   path,
+		method:  "HEAD",
+		bucket:  b.Name,
+		path:    path,
+		headers: headers,
 	}
 	err = b.S3.prepare(req)
 	if err != nil {
@@ -166,6 +388,29 @@ func (b *Bucket) Info(path string) (key *Key, err error) {
 	return key, nil
 }
 
+// MatchesMD5 reports whether the object at path exists and its ETag
+// matches md5hex, the hex-encoded MD5 sum of some content. It is useful
+// to skip uploading content that is already stored.
+//
+// Objects uploaded via multipart upload have an ETag that is not the MD5
+// sum of their content (it ends in "-N"), so MatchesMD5 returns false
+// for them and callers must compare them by other means. False is also
+// returned if the object does not exist.
+func (b *Bucket) MatchesMD5(path string, md5hex string) (bool, error) {
+	key, err := b.Info(path)
+	if hasStatus(err, http.StatusNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	etag := strings.Trim(key.ETag, `"`)
+	if strings.Contains(etag, "-") {
+		return false, nil
+	}
+	return strings.EqualFold(etag, md5hex), nil
+}
+
 // Get retrieves an object from an S3 bucket.
 //
 // See http://goo.gl/isCO7 for details.
@@ -183,33 +428,263 @@ func (b *Bucket) Get(path string) (data []byte, err error) {
 // It is the caller's responsibility to call Close on rc when
 // finished reading.
 func (b *Bucket) GetReader(path string) (rc io.ReadCloser, err error) {
+	return b.GetReaderWithOptions(path, GetOptions{})
+}
+
+// GetReaderWithOptions is like GetReader but also applies the given
+// download options.
+func (b *Bucket) GetReaderWithOptions(path string, options GetOptions) (rc io.ReadCloser, err error) {
+	headers := map[string][]string{}
+	err = options.addHeaders(headers)
+	if err != nil {
+		return nil, err
+	}
+	hresp, err := b.GetReaderResponse(path, headers)
+	if err != nil {
+		return nil, err
+	}
+	if options.RequireEncryption && !encrypted(hresp.Header) {
+		hresp.Body.Close()
+		return nil, ErrNotEncrypted
+	}
+	rc = hresp.Body
+	if options.VerifyLength && hresp.ContentLength >= 0 {
+		rc = &lengthReader{ReadCloser: rc, remaining: hresp.ContentLength}
+	}
+	if options.AcceptEncoding != "" {
+		codings := contentCodings(hresp.Header.Get("Content-Encoding"))
+		n := len(codings)
+		// A lone gzip coding may be the stored one, but a gzip coding
+		// on top of another one was applied in transit.
+		if n > 0 && codings[n-1] == "gzip" && (n > 1 || !options.KeepStoredEncoding) &&
+			acceptsEncoding(options.AcceptEncoding, "gzip") {
+			zr, err := gzip.NewReader(rc)
+			if err != nil {
+				rc.Close()
+				return nil, err
+			}
+			rc = &gzipReader{Reader: zr, body: rc}
+		}
+	}
+	return rc, nil
+}
+
+// contentCodings returns the codings listed in a Content-Encoding
+// header, in the order they were applied, ignoring identity.
+func contentCodings(header string) []string {
+	var codings []string
+	for _, coding := range strings.Split(header, ",") {
+		coding = strings.ToLower(strings.TrimSpace(coding))
+		if coding != "" && coding != "identity" {
+			codings = append(codings, coding)
+		}
+	}
+	return codings
+}
+
+// acceptsEncoding reports whether the Accept-Encoding header accept
+// allows coding, either by name or by "*", with a quality above zero.
+func acceptsEncoding(accept, coding string) bool {
+	accepted := false
+	for _, token := range strings.Split(accept, ",") {
+		params := strings.Split(token, ";")
+		name := strings.ToLower(strings.TrimSpace(params[0]))
+		if name != coding && name != "*" {
+			continue
+		}
+		q := 1.0
+		for _, param := range params[1:] {
+			k, v, _ := strings.Cut(param, "=")
+			if strings.EqualFold(strings.TrimSpace(k), "q") {
+				q, _ = strconv.ParseFloat(strings.TrimSpace(v), 64)
+			}
+		}
+		if name == coding {
+			// An explicit entry wins over "*".
+			return q > 0
+		}
+		accepted = q > 0
+	}
+	return accepted
+}
+
+// gzipReader reads the decoded content of a gzip encoded body.
+type gzipReader struct {
+	*gzip.Reader
+	body io.ReadCloser
+}
+
+func (r *gzipReader) Close() error {
+	r.Reader.Close()
+	return r.body.Close()
+}
+
+// lengthReader checks that the body it reads isn't shorter than the
+// length declared in the response headers. net/http stops reading at
+// that length, so it can't be longer.
+type lengthReader struct {
+	io.ReadCloser
+	remaining int64
+}
+
+func (r *lengthReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.remaining -= int64(n)
+	if err == io.ErrUnexpectedEOF || err == io.EOF && r.remaining > 0 {
+		return n, ErrShortBody
+	}
+	return n, err
+}
+
+// GetReaderResponse retrieves an object from an S3 bucket, sending the
+// given additional request headers, and returns the HTTP response as is,
+// giving access to its status, headers and trailers. Non-successful
+// responses are returned as errors, like by GetReader.
+// It is the caller's responsibility to call Close on the response
+// body when finished reading.
+func (b *Bucket) GetReaderResponse(path string, headers map[string][]string) (*http.Response, error) {
 	req := &request{
-		bucket: b.Name,
-		path:   path,
+		bucket:  b.Name,
+		path:    path,
+		headers: headers,
 	}
-	err = b.S3.prepare(req)
+	err := b.S3.prepare(req)
 	if err != nil {
 		return nil, err
 	}
-	for attempt := attempts.Start(); attempt.Next(); {
+	for attempt := b.S3.startAttempts(); attempt.Next(); {
 		hresp, err := b.S3.run(req)
-		if shouldRetry(err) && attempt.HasNext() {
+		if b.S3.shouldRetry(req.method, err) && attempt.HasNext() {
 			continue
 		}
 		if err != nil {
 			return nil, err
 		}
-		return hresp.Body, nil
+		return hresp, nil
 	}
 	panic("unreachable")
 }
 
+// GetIfChanged retrieves an object from an S3 bucket unless its ETag
+// still matches etag, a value previously obtained for the same object.
+// If the object is unchanged, changed is false, rc is nil and newETag
+// equals etag. Otherwise rc holds the current content of the object and
+// newETag its ETag. An empty etag always retrieves the object.
+// It is the caller's responsibility to call Close on rc when
+// finished reading.
+func (b *Bucket) GetIfChanged(path, etag string) (rc io.ReadCloser, newETag string, changed bool, err error) {
+	headers := map[string][]string{}
+	if etag != "" {
+		headers["If-None-Match"] = []string{etag}
+	}
+	req := &request{
+		bucket:  b.Name,
+		path:    path,
+		headers: headers,
+	}
+	err = b.S3.prepare(req)
+	if err != nil {
+		return nil, "", false, err
+	}
+	for attempt := b.S3.startAttempts(); attempt.Next(); {
+		hresp, err := b.S3.run(req)
+		if b.S3.shouldRetry(req.method, err) && attempt.HasNext() {
+			continue
+		}
+		if hasStatus(err, http.StatusNotModified) {
+			return nil, etag, false, nil
+		}
+		if err != nil {
+			return nil, "", false, err
+		}
+		return hresp.Body, hresp.Header.Get("ETag"), true, nil
+	}
+	panic("unreachable")
+}
+
+// GetReaderIfRange retrieves the bytes of the object at path in r if the
+// object still has the ETag etag, and the whole object otherwise, in a
+// single request ("If-Range" header). partial reports which one rc
+// holds, and newETag is the current ETag of the object. A negative
+// r.End retrieves the bytes from r.Start to the end of the object.
+// It is the caller's responsibility to call Close on rc when
+// finished reading.
+func (b *Bucket) GetReaderIfRange(path, etag string, r ObjectRange) (rc io.ReadCloser, newETag string, partial bool, err error) {
+	rh := fmt.Sprintf("bytes=%d-%d", r.Start, r.End)
+	if r.End < 0 {
+		rh = fmt.Sprintf("bytes=%d-", r.Start)
+	}
+	headers := map[string][]string{
+		"If-Range": {etag},
+		"Range":    {rh},
+	}
+	hresp, err := b.GetReaderResponse(path, headers)
+	if err != nil {
+		return nil, "", false, err
+	}
+	return hresp.Body, hresp.Header.Get("ETag"), hresp.StatusCode == http.StatusPartialContent, nil
+}
+
+// ResumeDownload writes the content of the object at path to w, each
+// byte at its offset in the object. It returns the ETag of the object
+// and the offset up to which w holds its content, which is the size of
+// the object unless an error is returned.
+//
+// An interrupted download is resumed by passing the ETag and the offset
+// returned by the failed call as etag and from: only the bytes after
+// from are retrieved, provided the object still has that ETag. If the
+// object changed meanwhile, it is downloaded again from the beginning
+// and its new ETag is returned; w may then hold stale content beyond
+// the returned offset. With an empty etag, the download starts from the
+// beginning whatever from is.
+func (b *Bucket) ResumeDownload(path string, w io.WriterAt, etag string, from int64) (newETag string, offset int64, err error) {
+	if etag == "" {
+		from = 0
+	}
+	headers := map[string][]string{}
+	if etag != "" {
+		headers["If-Match"] = []string{etag}
+	}
+	if from > 0 {
+		headers["Range"] = []string{fmt.Sprintf("bytes=%d-", from)}
+	}
+	hresp, err := b.GetReaderResponse(path, headers)
+	if hasStatus(err, http.StatusPreconditionFailed) {
+		return b.ResumeDownload(path, w, "", 0)
+	}
+	if hasStatus(err, http.StatusRequestedRangeNotSatisfiable) {
+		// The object still has the given ETag, as If-Match is
+		// checked first, and ends at from: it is complete.
+		return etag, from, nil
+	}
+	if err != nil {
+		return "", 0, err
+	}
+	defer hresp.Body.Close()
+	if hresp.StatusCode != http.StatusPartialContent {
+		from = 0
+	}
+	n, err := io.Copy(io.NewOffsetWriter(w, from), hresp.Body)
+	return hresp.Header.Get("ETag"), from + n, err
+}
+
 // GetReader retrieves an object info and range from an S3 bucket.
 // ObjectRange parameter can be nil.
 // It is the caller's responsibility to call Close on rc when
 // finished reading.
 func (b *Bucket) GetInfoRangeReader(path string, r *ObjectRange) (key *Key, rc io.ReadCloser, err error) {
+	return b.GetInfoRangeReaderWithOptions(path, r, GetOptions{})
+}
+
+// GetInfoRangeReaderWithOptions is like GetInfoRangeReader but also
+// sends the request headers of options, such as the SSE-C key the
+// object was encrypted with. The content is returned as received.
+func (b *Bucket) GetInfoRangeReaderWithOptions(path string, r *ObjectRange, options GetOptions) (key *Key, rc io.ReadCloser, err error) {
 	headers := map[string][]string{}
+	err = options.addHeaders(headers)
+	if err != nil {
+		return nil, nil, err
+	}
 	if r != nil {
 		rh := fmt.Sprintf("bytes=%d-%d", r.Start, r.End)
 		headers["Range"] = []string{rh}
@@ -223,9 +698,9 @@ func (b *Bucket) GetInfoRangeReader(path string, r *ObjectRange) (key *Key, rc i
 	if err != nil {
 		return nil, nil, err
 	}
-	for attempt := attempts.Start(); attempt.Next(); {
+	for attempt := b.S3.startAttempts(); attempt.Next(); {
 		hresp, err := b.S3.run(req)
-		if shouldRetry(err) && attempt.HasNext() {
+		if b.S3.shouldRetry(req.method, err) && attempt.HasNext() {
 			continue
 		}
 		if err != nil {
@@ -237,36 +712,980 @@ func (b *Bucket) GetInfoRangeReader(path string, r *ObjectRange) (key *Key, rc i
 	panic("unreachable")
 }
 
+// Attributes that may be requested with GetObjectAttributes.
+const (
+	AttrETag         = "ETag"
+	AttrChecksum     = "Checksum"
+	AttrObjectParts  = "ObjectParts"
+	AttrStorageClass = "StorageClass"
+	AttrObjectSize   = "ObjectSize"
+)
+
+// ObjectAttributes holds the results of a GetObjectAttributes operation.
+// Only the attributes that were requested are set.
+type ObjectAttributes struct {
+	// ETag is the entity tag of the object. Unlike the ETag of a Key,
+	// it is not surrounded with double-quotes.
+	ETag         string
+	Checksum     Checksum
+	ObjectParts  ObjectParts
+	StorageClass string
+	ObjectSize   int64
+}
+
+// Checksum holds the checksums S3 computed for an object or part.
+type Checksum struct {
+	ChecksumCRC32     string
+	ChecksumCRC32C    string
+	ChecksumCRC64NVME string
+	ChecksumSHA1      string
+	ChecksumSHA256    string
+}
+
+// ObjectParts holds the parts information of an object uploaded via
+// multipart upload.
+type ObjectParts struct {
+	PartsCount           int
+	PartNumberMarker     int
+	NextPartNumberMarker int
+	MaxParts             int
+	IsTruncated          bool
+	Parts                []ObjectPart `xml:"Part"`
+}
+
+// ObjectPart describes a single part of an object.
+type ObjectPart struct {
+	PartNumber int
+	Size       int64
+	Checksum
+}
+
+// GetObjectAttributes retrieves the requested attributes of an object
+// in a single request. The attrs parameter lists the attributes to
+// return (see AttrETag and friends).
+//
+// See https://docs.aws.amazon.com/AmazonS3/latest/API/API_GetObjectAttributes.html for details.
+func (b *Bucket) GetObjectAttributes(path string, attrs []string) (result *ObjectAttributes, err error) {
+	headers := map[string][]string{
+		"x-amz-object-attributes": {strings.Join(attrs, ",")},
+	}
+	params := map[string][]string{
+		"attributes": {""},
+	}
+	req := &request{
+		bucket:  b.Name,
+		path:    path,
+		headers: headers,
+		params:  params,
+	}
+	result = &ObjectAttributes{}
+	for attempt := b.S3.startAttempts(); attempt.Next(); {
+		err = b.S3.query(req, result)
+		if !b.S3.shouldRetry(req.method, err) {
+			break
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
 // Put inserts an object into the S3 bucket.
 //
 // See http://goo.gl/FEBPD for details.
 func (b *Bucket) Put(path string, data []byte, contType string, perm ACL) error {
-	body := bytes.NewBuffer(data)
+	body := bytes.NewReader(data)
 	md5b64 := MD5B64(data)
 	sha256hex := SHA256Hex(data)
 	return b.PutReader(path, body, int64(len(data)), contType, perm, md5b64, sha256hex)
 }
 
-// PutReader inserts an object into the S3 bucket by consuming data
-// from r until EOF.
-func (b *Bucket) PutReader(path string, r io.Reader, length int64, contType string, perm ACL, md5b64 string, sha256hex string) error {
+// ErrResponseTooLarge is returned by operations whose XML response body
+// exceeds S3.MaxResponseSize.
+var ErrResponseTooLarge = errors.New("s3: response body exceeds the maximum response size")
+
+// ErrObjectExists is returned by uploads made with Options.IfNoneMatch
+// when an object already exists at the destination path.
+var ErrObjectExists = errors.New("s3: object already exists")
+
+// Options holds optional settings for object uploads.
+type Options struct {
+	// IfNoneMatch sends "If-None-Match: *" so the upload only succeeds
+	// if no object exists at the destination path. If one does,
+	// ErrObjectExists is returned.
+	IfNoneMatch bool
+
+	// SSECustomerKey, if set, is the 32 bytes long key the object is
+	// encrypted with by S3 (SSE-C). The same key must be provided to
+	// read the object back.
+	SSECustomerKey []byte
+
+	// Meta holds user-defined metadata to store with the object, sent
+	// as x-amz-meta-* headers. S3 stores names in lower case.
+	Meta map[string][]string
+
+	// Tags holds the tags to store with the object, sent URL encoded
+	// in the x-amz-tagging header (see ValidateTags).
+	Tags map[string]string
+
+	// ChecksumCRC64NVME, if set, is the base64 encoded CRC-64/NVME
+	// checksum of the content (see CRC64NVMEB64), which S3 verifies
+	// and stores with the object.
+	ChecksumCRC64NVME string
+
+	// IdempotencyKey, if set, makes the upload safe to retry after a
+	// failure that may hide a success, such as a lost response. The
+	// object is only created if none exists at the destination path,
+	// as with IfNoneMatch, and the key is stored in its metadata
+	// (x-amz-meta-goamz-idempotency-key). If an object exists, the
+	// upload succeeds if that object holds the same key, that is, if
+	// it was written by an earlier attempt of the same upload, and
+	// fails with ErrObjectExists otherwise. The key should be unique
+	// to each upload.
+	IdempotencyKey string
+
+	// StorageClass, if set, is the storage class of the object, such
+	// as StandardIA.
+	StorageClass StorageClass
+
+	// ServerSideEncryption, if set, is the algorithm S3 encrypts the
+	// object with at rest: "AES256", or "aws:kms" with the KMS key
+	// SSEKMSKeyID, or the default KMS key if it is empty.
+	ServerSideEncryption string
+	SSEKMSKeyID          string
+
+	// Grants, if set, are sent in place of the canned ACL.
+	Grants Grants
+}
+
+// Grants holds the grantees given each permission on an object, as
+// comma separated lists in the format of the x-amz-grant-* headers,
+// such as `id="79a59df9...", uri="http://acs.amazonaws.com/groups/global/AllUsers"`.
+// S3 doesn't accept canned ACLs with them, so they replace the ACL of
+// the upload.
+type Grants struct {
+	Read        string
+	ReadACP     string
+	WriteACP    string
+	FullControl string
+}
+
+// addObjectHeaders adds the headers for the storage class, server-side
+// encryption and grants of a new object to headers.
+func addObjectHeaders(headers map[string][]string, storageClass StorageClass, sse, kmsKeyID string, grants Grants) {
+	if storageClass != "" {
+		headers["x-amz-storage-class"] = []string{string(storageClass)}
+	}
+	if kmsKeyID != "" && sse == "" {
+		sse = "aws:kms"
+	}
+	if sse != "" {
+		headers["x-amz-server-side-encryption"] = []string{sse}
+	}
+	if kmsKeyID != "" {
+		headers["x-amz-server-side-encryption-aws-kms-key-id"] = []string{kmsKeyID}
+	}
+	if grants == (Grants{}) {
+		return
+	}
+	delete(headers, "x-amz-acl")
+	for name, value := range map[string]string{
+		"x-amz-grant-read":         grants.Read,
+		"x-amz-grant-read-acp":     grants.ReadACP,
+		"x-amz-grant-write-acp":    grants.WriteACP,
+		"x-amz-grant-full-control": grants.FullControl,
+	} {
+		if value != "" {
+			headers[name] = []string{value}
+		}
+	}
+}
+
+// idempotencyMetaName is the name of the user-defined metadata holding
+// Options.IdempotencyKey.
+const idempotencyMetaName = "goamz-idempotency-key"
+
+func (o Options) addHeaders(headers map[string][]string) error {
+	if o.IfNoneMatch || o.IdempotencyKey != "" {
+		headers["If-None-Match"] = []string{"*"}
+	}
+	if o.IdempotencyKey != "" {
+		headers["x-amz-meta-"+idempotencyMetaName] = []string{o.IdempotencyKey}
+	}
+	if o.ChecksumCRC64NVME != "" {
+		headers["x-amz-checksum-crc64nvme"] = []string{o.ChecksumCRC64NVME}
+	}
+	for name, values := range o.Meta {
+		headers["x-amz-meta-"+strings.ToLower(name)] = values
+	}
+	if len(o.Tags) > 0 {
+		if err := ValidateTags(o.Tags); err != nil {
+			return err
+		}
+		headers["x-amz-tagging"] = []string{encodeTags(o.Tags)}
+	}
+	addObjectHeaders(headers, o.StorageClass, o.ServerSideEncryption, o.SSEKMSKeyID, o.Grants)
+	return addSSECustomerHeaders(headers, "x-amz-server-side-encryption-customer-", o.SSECustomerKey)
+}
+
+// addSSECustomerHeaders adds the headers for the SSE-C key to headers,
+// using the given header name prefix. Nothing is added if key is nil.
+func addSSECustomerHeaders(headers map[string][]string, prefix string, key []byte) error {
+	if key == nil {
+		return nil
+	}
+	if len(key) != 32 {
+		return fmt.Errorf("bad SSE-C key length: %d bytes (must be 32)", len(key))
+	}
+	sum := md5.Sum(key)
+	headers[prefix+"algorithm"] = []string{"AES256"}
+	headers[prefix+"key"] = []string{base64.StdEncoding.EncodeToString(key)}
+	headers[prefix+"key-MD5"] = []string{base64.StdEncoding.EncodeToString(sum[:])}
+	return nil
+}
+
+// GetOptions holds optional settings for object downloads.
+type GetOptions struct {
+	// SSECustomerKey is the key the object was encrypted with by S3
+	// (SSE-C), if any.
+	SSECustomerKey []byte
+	// RequireEncryption makes the download fail with ErrNotEncrypted
+	// if S3 doesn't report the object as encrypted at rest.
+	RequireEncryption bool
+	// ChecksumMode asks S3 to send the checksums stored with the
+	// object, such as x-amz-checksum-crc64nvme, in the response headers.
+	ChecksumMode bool
+	// VerifyLength makes reading the content fail with ErrShortBody if
+	// it turns out shorter than declared by the Content-Length header,
+	// as when a proxy truncates it. Longer bodies are cut short at the
+	// Content-Length by the HTTP client.
+	VerifyLength bool
+	// AcceptEncoding, if set, is sent as the Accept-Encoding header in
+	// place of the one added by the HTTP transport, which asks for gzip
+	// and decodes gzip encoded bodies itself. If AcceptEncoding accepts
+	// gzip, a body sent with a gzip Content-Encoding, as by a compressing
+	// proxy or backend, is decoded.
+	AcceptEncoding string
+	// KeepStoredEncoding, with AcceptEncoding set, leaves alone a lone
+	// gzip Content-Encoding, taking it to be the one the object was
+	// stored with, as when it was uploaded compressed. Only a gzip
+	// coding applied on top of it in transit is decoded.
+	KeepStoredEncoding bool
+}
+
+// ErrNotEncrypted is returned by downloads with
+// GetOptions.RequireEncryption set for objects that are not encrypted
+// at rest.
+var ErrNotEncrypted = errors.New("s3: object is not encrypted")
+
+// ErrShortBody is returned when reading the content of downloads with
+// GetOptions.VerifyLength set that end before their Content-Length.
+var ErrShortBody = errors.New("s3: response body shorter than Content-Length")
+
+func (o GetOptions) addHeaders(headers map[string][]string) error {
+	if o.AcceptEncoding != "" {
+		headers["Accept-Encoding"] = []string{o.AcceptEncoding}
+	}
+	if o.ChecksumMode {
+		headers["x-amz-checksum-mode"] = []string{"ENABLED"}
+	}
+	return addSSECustomerHeaders(headers, "x-amz-server-side-encryption-customer-", o.SSECustomerKey)
+}
+
+// PutReader inserts an object into the S3 bucket by consuming data
+// from r until EOF. If r is an io.Seeker, an upload rejected with
+// BadDigest is sent once more before the error is returned, unless the
+// RetryPolicy of the client doesn't retry PUT requests.
+func (b *Bucket) PutReader(path string, r io.Reader, length int64, contType string, perm ACL, md5b64 string, sha256hex string) error {
+	_, err := b.PutReaderWithOptions(path, r, length, contType, perm, md5b64, sha256hex, Options{})
+	return err
+}
+
+// WriteResult holds details reported by S3 in the response to an
+// operation that writes an object.
+type WriteResult struct {
+	// Header holds all the headers of the response.
+	Header               http.Header
+	ETag                 string
+	VersionId            string
+	ServerSideEncryption string // e.g. "AES256" or "aws:kms"
+	Expiration           string // raw x-amz-expiration header
+	RequestCharged       bool   // true if the requester was charged
+}
+
+func writeResultFromHeaders(h http.Header) WriteResult {
+	return WriteResult{
+		Header:               h,
+		ETag:                 h.Get("ETag"),
+		VersionId:            h.Get("x-amz-version-id"),
+		ServerSideEncryption: h.Get("x-amz-server-side-encryption"),
+		Expiration:           h.Get("x-amz-expiration"),
+		RequestCharged:       requestCharged(h),
+	}
+}
+
+// PutReaderWithOptions is like PutReader but also applies the given
+// upload options and returns the details reported by S3.
+func (b *Bucket) PutReaderWithOptions(path string, r io.Reader, length int64, contType string, perm ACL, md5b64 string, sha256hex string, options Options) (*WriteResult, error) {
+	headers := map[string][]string{
+		"Content-Length": {strconv.FormatInt(length, 10)},
+		"Content-Type":   {contType},
+		"x-amz-acl":      {string(perm)},
+	}
+	err := options.addHeaders(headers)
+	if err != nil {
+		return nil, err
+	}
+	seeker, seekable := r.(io.Seeker)
+	var start int64
+	if seekable {
+		start, err = seeker.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return nil, err
+		}
+	}
+	var header http.Header
+	for badDigest := false; ; badDigest = true {
+		req := &request{
+			method:  "PUT",
+			bucket:  b.Name,
+			path:    path,
+			headers: headers,
+			payload: payload{
+				payload:   r,
+				md5b64:    md5b64,
+				sha256hex: sha256hex,
+			},
+		}
+		b.S3.applyPayloadHash(req, length)
+		header, err = b.S3.queryHeader(req, nil)
+		// As with PutPartHash, a BadDigest may be caused by the body
+		// being corrupted in transit, so it is read and sent once more.
+		if !hasCode(err, "BadDigest") || badDigest || !seekable || !b.S3.retriesMethod(req.method) {
+			break
+		}
+		_, err = seeker.Seek(start, io.SeekStart)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if options.IdempotencyKey != "" && hasStatus(err, http.StatusPreconditionFailed) {
+		return b.idempotentResult(path, options.IdempotencyKey)
+	}
+	if options.IfNoneMatch && hasStatus(err, http.StatusPreconditionFailed) {
+		return nil, ErrObjectExists
+	}
+	if err != nil {
+		return nil, err
+	}
+	result := writeResultFromHeaders(header)
+	return &result, nil
+}
+
+// idempotentResult returns the details of the object at path if it was
+// uploaded with idempotencyKey, and ErrObjectExists otherwise.
+func (b *Bucket) idempotentResult(path, idempotencyKey string) (*WriteResult, error) {
+	req := &request{
+		method: "HEAD",
+		bucket: b.Name,
+		path:   path,
+	}
+	err := b.S3.prepare(req)
+	if err != nil {
+		return nil, err
+	}
+	hresp, err := b.S3.run(req)
+	if err != nil {
+		return nil, err
+	}
+	hresp.Body.Close()
+	if hresp.Header.Get("x-amz-meta-"+idempotencyMetaName) != idempotencyKey {
+		return nil, ErrObjectExists
+	}
+	result := writeResultFromHeaders(hresp.Header)
+	return &result, nil
+}
+
+// PutStream inserts an object into the S3 bucket, reading exactly length
+// bytes from r, which need not be seekable. As the content can't be read
+// twice, it is left out of the signature ("UNSIGNED-PAYLOAD") instead of
+// being hashed up front, or sent with a trailing checksum if the client
+// uses PayloadHashStreaming, and the upload is not retried. An error is
+// returned if r holds fewer or more than length bytes.
+func (b *Bucket) PutStream(path string, r io.Reader, length int64, contType string, perm ACL, options Options) (*WriteResult, error) {
+	body := &exactReader{r: r, length: length, remaining: length}
+	result, err := b.PutReaderWithOptions(path, body, length, contType, perm, "", UnsignedPayload, options)
+	if body.err != nil {
+		return nil, body.err
+	}
+	return result, err
+}
+
+// exactReader reads from r, failing if it holds fewer or more than
+// length bytes.
+type exactReader struct {
+	r         io.Reader
+	length    int64
+	remaining int64
+	err       error
+}
+
+func (e *exactReader) Read(p []byte) (int, error) {
+	if e.err != nil {
+		return 0, e.err
+	}
+	if e.remaining == 0 {
+		return 0, io.EOF
+	}
+	if int64(len(p)) > e.remaining {
+		p = p[:e.remaining]
+	}
+	n, err := e.r.Read(p)
+	e.remaining -= int64(n)
+	switch {
+	case err == io.EOF && e.remaining > 0:
+		e.err = fmt.Errorf("s3: short read: got %d bytes, expected %d", e.length-e.remaining, e.length)
+		return n, e.err
+	case err != nil && err != io.EOF:
+		return n, err
+	case e.remaining == 0:
+		// Make sure r holds nothing more before handing out the last
+		// bytes, so that a complete body is never sent.
+		var extra [1]byte
+		if m, _ := io.ReadFull(e.r, extra[:]); m > 0 {
+			e.err = fmt.Errorf("s3: long read: got more than %d bytes", e.length)
+			return 0, e.err
+		}
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// PutEmpty inserts a zero-length object into the S3 bucket, such as the
+// "folder/" placeholders created by many S3 browsers. If contType is empty,
+// binary/octet-stream is used.
+func (b *Bucket) PutEmpty(path, contType string, perm ACL) error {
+	if contType == "" {
+		contType = "binary/octet-stream"
+	}
+	return b.PutReader(path, bytes.NewReader(nil), 0, contType, perm, MD5B64(nil), EmptyStringSHA256Hex)
+}
+
+// ErrAppendNotSupported is returned by AppendObject unless the
+// AppendSupported field of the S3 client is set.
+var ErrAppendNotSupported = errors.New("s3: append is not supported by this S3 client")
+
+// appendSpoolThreshold is the number of bytes AppendObject and PutRange
+// hold in memory before spooling the written data to a temporary file.
+var appendSpoolThreshold int64 = 5 << 20
+
+// AppendObject appends the data read from r until EOF to the existing
+// object at path, whose current size must be equal to position, and
+// returns the new size of the object. It requires a store that supports
+// appends via the x-amz-write-offset-bytes header and returns
+// ErrAppendNotSupported unless AppendSupported is set.
+//
+// Appends are not idempotent, so failing requests are not retried.
+func (b *Bucket) AppendObject(path string, position int64, r io.Reader) (newSize int64, err error) {
+	if !b.S3.AppendSupported {
+		return 0, ErrAppendNotSupported
+	}
+	s, err := Spool(r, appendSpoolThreshold)
+	if err != nil {
+		return 0, err
+	}
+	defer s.Close()
+	headers := map[string][]string{
+		"Content-Length":           {strconv.FormatInt(s.Size(), 10)},
+		"x-amz-write-offset-bytes": {strconv.FormatInt(position, 10)},
+	}
+	req := &request{
+		method:  "PUT",
+		bucket:  b.Name,
+		path:    path,
+		headers: headers,
+		payload: payload{
+			payload:   s,
+			md5b64:    s.MD5B64(),
+			sha256hex: s.SHA256Hex(),
+		},
+	}
+	header, err := b.S3.queryHeader(req, nil)
+	if err != nil {
+		return 0, err
+	}
+	if size, err := strconv.ParseInt(header.Get("x-amz-object-size"), 10, 64); err == nil {
+		return size, nil
+	}
+	return position + s.Size(), nil
+}
+
+// ErrRangedPutNotSupported is returned by PutRange unless the
+// RangedPutSupported field of the S3 client is set.
+var ErrRangedPutNotSupported = errors.New("s3: ranged put is not supported by this S3 client")
+
+// PutRange writes the data read from r until EOF to the object at path,
+// starting at offset, leaving the rest of the object as is. It requires a
+// store that supports writing ranges via the Content-Range header of PUT
+// requests and returns ErrRangedPutNotSupported unless RangedPutSupported
+// is set. If the store reports the size of the object after the write
+// (x-amz-object-size), PutRange checks that it covers the range written.
+//
+// Ranged writes are idempotent, so failing requests are retried.
+func (b *Bucket) PutRange(path string, offset int64, r io.Reader) error {
+	if !b.S3.RangedPutSupported {
+		return ErrRangedPutNotSupported
+	}
+	if offset < 0 {
+		return fmt.Errorf("bad offset: %d", offset)
+	}
+	s, err := Spool(r, appendSpoolThreshold)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	if s.Size() == 0 {
+		return nil
+	}
+	end := offset + s.Size()
+	headers := map[string][]string{
+		"Content-Length": {strconv.FormatInt(s.Size(), 10)},
+		"Content-Range":  {fmt.Sprintf("bytes %d-%d/*", offset, end-1)},
+	}
+	for attempt := b.S3.startAttempts(); attempt.Next(); {
+		if _, err := s.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		req := &request{
+			method:  "PUT",
+			bucket:  b.Name,
+			path:    path,
+			headers: headers,
+			payload: payload{
+				payload:   s,
+				md5b64:    s.MD5B64(),
+				sha256hex: s.SHA256Hex(),
+			},
+		}
+		header, err := b.S3.queryHeader(req, nil)
+		if b.S3.shouldRetry(req.method, err) && attempt.HasNext() {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if size, err := strconv.ParseInt(header.Get("x-amz-object-size"), 10, 64); err == nil && size < end {
+			return fmt.Errorf("s3: ranged put to %q not verified: object size %d, expected at least %d", path, size, end)
+		}
+		return nil
+	}
+	panic("unreachable")
+}
+
+// Tagging directives for CopyOptions.
+const (
+	TaggingCopy    = "COPY"
+	TaggingReplace = "REPLACE"
+)
+
+// Metadata directives for CopyOptions.
+const (
+	MetadataCopy    = "COPY"
+	MetadataReplace = "REPLACE"
+)
+
+// CopyOptions holds optional settings for Copy.
+type CopyOptions struct {
+	// TaggingDirective specifies whether the tags of the source object
+	// are copied (TaggingCopy, the default) or replaced by Tags
+	// (TaggingReplace).
+	TaggingDirective string
+	Tags             map[string]string
+
+	// SourceSSECustomerKey is the key the source object was encrypted
+	// with by S3 (SSE-C), if any.
+	SourceSSECustomerKey []byte
+	// SSECustomerKey, if set, is the key the copy is encrypted with
+	// by S3 (SSE-C).
+	SSECustomerKey []byte
+
+	// IfMatch, if set, makes the copy fail unless the ETag of the
+	// source object is IfMatch.
+	IfMatch string
+
+	// MetadataDirective specifies whether the content type and
+	// user-defined metadata of the source object are copied
+	// (MetadataCopy, the default) or replaced by ContentType and Meta
+	// (MetadataReplace).
+	MetadataDirective string
+	ContentType       string
+	Meta              map[string][]string
+	// DetectContentType, with MetadataReplace, sets the content type
+	// of the copy from the extension of its key, as given by
+	// mime.TypeByExtension, unless ContentType is set. It allows fixing
+	// objects stored with the wrong content type.
+	DetectContentType bool
+
+	// StorageClass, ServerSideEncryption and SSEKMSKeyID are applied to
+	// the copy, as with the Options of an upload. S3 doesn't copy them
+	// from the source object.
+	StorageClass         StorageClass
+	ServerSideEncryption string
+	SSEKMSKeyID          string
+}
+
+func (o CopyOptions) addHeaders(headers map[string][]string) error {
+	if o.TaggingDirective != "" {
+		headers["x-amz-tagging-directive"] = []string{o.TaggingDirective}
+	}
+	if o.TaggingDirective == TaggingReplace && len(o.Tags) > 0 {
+		if err := ValidateTags(o.Tags); err != nil {
+			return err
+		}
+		headers["x-amz-tagging"] = []string{encodeTags(o.Tags)}
+	}
+	if o.IfMatch != "" {
+		headers["x-amz-copy-source-if-match"] = []string{o.IfMatch}
+	}
+	if o.MetadataDirective != "" {
+		headers["x-amz-metadata-directive"] = []string{o.MetadataDirective}
+	}
+	if o.MetadataDirective == MetadataReplace {
+		if o.ContentType != "" {
+			headers["Content-Type"] = []string{o.ContentType}
+		}
+		for name, values := range o.Meta {
+			headers["x-amz-meta-"+strings.ToLower(name)] = values
+		}
+	}
+	addObjectHeaders(headers, o.StorageClass, o.ServerSideEncryption, o.SSEKMSKeyID, Grants{})
+	err := addSSECustomerHeaders(headers, "x-amz-copy-source-server-side-encryption-customer-", o.SourceSSECustomerKey)
+	if err != nil {
+		return err
+	}
+	return addSSECustomerHeaders(headers, "x-amz-server-side-encryption-customer-", o.SSECustomerKey)
+}
+
+// encodeTags encodes tags as the URL query formatted value expected in
+// the x-amz-tagging header.
+func encodeTags(tags map[string]string) string {
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var buf bytes.Buffer
+	for _, k := range keys {
+		if buf.Len() > 0 {
+			buf.WriteByte('&')
+		}
+		buf.WriteString(aws.Encode(k))
+		buf.WriteByte('=')
+		buf.WriteString(aws.Encode(tags[k]))
+	}
+	return buf.String()
+}
+
+// copySource returns the x-amz-copy-source header value for the object
+// at path in b.
+func (b *Bucket) copySource(path string) string {
+	segments := strings.Split(strings.TrimPrefix(path, "/"), "/")
+	for i, s := range segments {
+		segments[i] = aws.Encode(s)
+	}
+	return "/" + b.Name + "/" + strings.Join(segments, "/")
+}
+
+// CopyObjectResult holds the results of a Copy operation.
+type CopyObjectResult struct {
+	ETag         string
+	LastModified string
+	WriteResult  `xml:"-"`
+}
+
+// Copy creates a copy of the object at oldPath in the S3 bucket at
+// newPath. The copy is done server-side, without transferring the
+// object data.
+//
+// See https://docs.aws.amazon.com/AmazonS3/latest/API/API_CopyObject.html for details.
+func (b *Bucket) Copy(oldPath, newPath string, perm ACL, options CopyOptions) (result *CopyObjectResult, err error) {
+	headers := map[string][]string{
+		"x-amz-copy-source": {b.copySource(oldPath)},
+		"x-amz-acl":         {string(perm)},
+	}
+	if options.MetadataDirective == MetadataReplace && options.DetectContentType && options.ContentType == "" {
+		options.ContentType = mime.TypeByExtension(path.Ext(newPath))
+	}
+	err = options.addHeaders(headers)
+	if err != nil {
+		return nil, err
+	}
+	req := &request{
+		method:  "PUT",
+		bucket:  b.Name,
+		path:    newPath,
+		headers: headers,
+	}
+	result = &CopyObjectResult{}
+	header, err := b.S3.copyQuery(req, result)
+	if err != nil {
+		return nil, err
+	}
+	result.WriteResult = writeResultFromHeaders(header)
+	return result, nil
+}
+
+// copyQuery runs the copy request req, retrying it as the attempt
+// strategy allows, and decodes the response into result. S3 may report
+// a failed copy in the body of a 200 response, so a result without an
+// ETag is an error.
+func (s3 *S3) copyQuery(req *request, result *CopyObjectResult) (http.Header, error) {
+	for attempt := s3.startAttempts(); attempt.Next(); {
+		header, err := s3.queryHeader(req, result)
+		if s3.shouldRetry(req.method, err) && attempt.HasNext() {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if result.ETag == "" {
+			return nil, errors.New("copy succeeded with no ETag")
+		}
+		return header, nil
+	}
+	panic("unreachable")
+}
+
+// maxCopySize is the size of the largest object that may be copied in a
+// single request. Larger objects are renamed by copying them in parts of
+// copyPartSize bytes.
+var (
+	maxCopySize  int64 = 5 << 30
+	copyPartSize int64 = 512 << 20
+)
+
+// Rename moves the object at oldPath in the S3 bucket to newPath, which
+// S3 can't do in one step: the object is copied server-side with its
+// metadata, storage class and server-side encryption, provided the
+// object doesn't change meanwhile, the copy is verified by its ETag,
+// and only then the object at oldPath is deleted. If the copy fails or
+// is not verified, the object at oldPath is left in place and the copy
+// is deleted. As with Copy, the ACL of the new object is perm.
+//
+// The ETag of objects encrypted with KMS or with a customer key is not
+// the MD5 sum of their content, so their copies can't be verified and
+// are trusted.
+//
+// Objects larger than 5 GiB are copied in parts. Only their user-defined
+// metadata, content type, storage class and server-side encryption are
+// kept, every part is copied only if the object still has the same
+// ETag, and the copy is verified against the ETags of the parts.
+func (b *Bucket) Rename(oldPath, newPath string, perm ACL) error {
+	key, err := b.Info(oldPath)
+	if err != nil {
+		return err
+	}
+	if key.Size > maxCopySize {
+		err = b.renameMulti(key, newPath, perm)
+	} else {
+		var result *CopyObjectResult
+		result, err = b.Copy(oldPath, newPath, perm, CopyOptions{
+			IfMatch:              key.ETag,
+			StorageClass:         StorageClass(key.StorageClass),
+			ServerSideEncryption: key.ServerSideEncryption,
+			SSEKMSKeyID:          key.SSEKMSKeyID,
+		})
+		if err == nil && md5ETag(key) && strings.Trim(result.ETag, `"`) != strings.Trim(key.ETag, `"`) {
+			b.Del(newPath)
+			err = fmt.Errorf("s3: rename of %q not verified: got ETag %s, expected %s", oldPath, result.ETag, key.ETag)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	return b.Del(oldPath)
+}
+
+// md5ETag reports whether the ETag of the object described by key is the
+// MD5 sum of its content, which it isn't for objects uploaded in parts
+// or encrypted with KMS or with a customer key.
+func md5ETag(key *Key) bool {
+	return !strings.Contains(key.ETag, "-") &&
+		!strings.HasPrefix(key.ServerSideEncryption, "aws:kms") &&
+		key.Header.Get("x-amz-server-side-encryption-customer-algorithm") == ""
+}
+
+// renameMulti copies the object described by key to newPath in parts
+// and checks that the ETag of the copy matches the parts.
+func (b *Bucket) renameMulti(key *Key, newPath string, perm ACL) error {
+	multi, err := b.InitMultiWithOptions(newPath, key.ContentType, perm, MultiOptions{
+		Meta:                 key.Meta,
+		StorageClass:         StorageClass(key.StorageClass),
+		ServerSideEncryption: key.ServerSideEncryption,
+		SSEKMSKeyID:          key.SSEKMSKeyID,
+	})
+	if err != nil {
+		return err
+	}
+	var parts []Part
+	var sums [][]byte
+	for first := int64(0); first < key.Size && err == nil; first += copyPartSize {
+		last := first + copyPartSize - 1
+		if last >= key.Size {
+			last = key.Size - 1
+		}
+		var part Part
+		part, err = multi.PutPartCopy(len(parts)+1, b, key.Key, first, last, PartCopyOptions{IfMatch: key.ETag})
+		if err == nil {
+			var sum []byte
+			sum, err = hex.DecodeString(strings.Trim(part.ETag, `"`))
+			parts = append(parts, part)
+			sums = append(sums, sum)
+		}
+	}
+	var result *CompleteResult
+	if err == nil {
+		result, err = multi.CompleteWithResult(parts)
+	}
+	if err != nil {
+		multi.Abort()
+		return err
+	}
+	if etag := ComputeMultipartETag(sums); strings.Trim(result.ETag, `"`) != etag {
+		b.Del(newPath)
+		return fmt.Errorf("s3: rename of %q not verified: got ETag %s, expected %q", key.Key, result.ETag, etag)
+	}
+	return nil
+}
+
+// UpdateMetadata replaces the user-defined metadata of the object at
+// path with metadata, without uploading its content again: the object is
+// copied onto itself server-side with the metadata directive REPLACE,
+// which S3 accepts even if nothing changes (a plain self-copy is
+// rejected). The content type and storage class are changed too if
+// contType and storageClass are not empty, and kept otherwise. The copy
+// only succeeds if the object didn't change since its current settings
+// were read.
+//
+// The Cache-Control, Content-Disposition, Content-Encoding,
+// Content-Language, Expires and x-amz-website-redirect-location headers,
+// the tags and the server-side encryption of the object are kept as
+// well. Nothing else is: as with any copy, the ACL of the object is
+// reset to private, and its object lock retention and legal hold to the
+// bucket defaults. Objects encrypted with a customer key (SSE-C) need
+// UpdateMetadataWithOptions.
+func (b *Bucket) UpdateMetadata(path string, metadata map[string]string, contType, storageClass string) error {
+	return b.UpdateMetadataWithOptions(path, metadata, contType, storageClass, UpdateOptions{})
+}
+
+// UpdateOptions holds the options of UpdateMetadataWithOptions and
+// TouchWithOptions.
+type UpdateOptions struct {
+	// SSECustomerKey is the key the object is encrypted with by S3
+	// (SSE-C), if any. The object is encrypted with it again.
+	SSECustomerKey []byte
+}
+
+// UpdateMetadataWithOptions is like UpdateMetadata, with options.
+func (b *Bucket) UpdateMetadataWithOptions(path string, metadata map[string]string, contType, storageClass string, options UpdateOptions) error {
+	key, err := b.InfoWithOptions(path, GetOptions{SSECustomerKey: options.SSECustomerKey})
+	if err != nil {
+		return err
+	}
+	return b.updateMetadata(key, metadata, contType, storageClass, options)
+}
+
+// touchMetaName is the name of the user-defined metadata set by Touch.
+const touchMetaName = "goamz-touched"
+
+// Touch updates the last modified time of the object at path to the
+// current time by copying it onto itself server-side. S3 rejects a
+// self-copy that changes nothing, so the copy replaces the metadata and
+// also records the time of the copy in the goamz-touched metadata
+// value.
+//
+// Touch keeps what UpdateMetadata keeps: the content, user-defined
+// metadata, content type, storage class, tags and server-side
+// encryption of the object, and its Cache-Control, Content-Disposition,
+// Content-Encoding, Content-Language, Expires and
+// x-amz-website-redirect-location headers. It resets the ACL of the
+// object to private and its object lock retention and legal hold to the
+// bucket defaults. Objects encrypted with a customer key (SSE-C) need
+// TouchWithOptions.
+func (b *Bucket) Touch(path string) error {
+	return b.TouchWithOptions(path, UpdateOptions{})
+}
+
+// TouchWithOptions is like Touch, with options.
+func (b *Bucket) TouchWithOptions(path string, options UpdateOptions) error {
+	key, err := b.InfoWithOptions(path, GetOptions{SSECustomerKey: options.SSECustomerKey})
+	if err != nil {
+		return err
+	}
+	metadata := make(map[string]string, len(key.Meta)+1)
+	for name, values := range key.Meta {
+		metadata[name] = strings.Join(values, ",")
+	}
+	metadata[touchMetaName] = b.S3.now().UTC().Format(time.RFC3339Nano)
+	return b.updateMetadata(key, metadata, "", "", options)
+}
+
+// keptHeaders are the headers of an object that a copy with the metadata
+// directive REPLACE drops unless they are sent again, besides the content
+// type and user-defined metadata.
+var keptHeaders = []string{
+	"Cache-Control",
+	"Content-Disposition",
+	"Content-Encoding",
+	"Content-Language",
+	"Expires",
+	"x-amz-website-redirect-location",
+}
+
+// updateMetadata implements UpdateMetadataWithOptions for the object
+// described by key, as returned by Info.
+func (b *Bucket) updateMetadata(key *Key, metadata map[string]string, contType, storageClass string, options UpdateOptions) error {
+	path := key.Key
+	if contType == "" {
+		contType = key.ContentType
+	}
+	if storageClass == "" {
+		storageClass = key.StorageClass
+	}
 	headers := map[string][]string{
-		"Content-Length": {strconv.FormatInt(length, 10)},
-		"Content-Type":   {contType},
-		"x-amz-acl":      {string(perm)},
+		"x-amz-copy-source":          {b.copySource(path)},
+		"x-amz-copy-source-if-match": {key.ETag},
+		"x-amz-metadata-directive":   {"REPLACE"},
+	}
+	if contType != "" {
+		headers["Content-Type"] = []string{contType}
+	}
+	for _, name := range keptHeaders {
+		if value := key.Header.Get(name); value != "" {
+			headers[name] = []string{value}
+		}
+	}
+	addObjectHeaders(headers, StorageClass(storageClass), key.ServerSideEncryption, key.SSEKMSKeyID, Grants{})
+	for name, value := range metadata {
+		headers["x-amz-meta-"+strings.ToLower(name)] = []string{value}
+	}
+	err := addSSECustomerHeaders(headers, "x-amz-copy-source-server-side-encryption-customer-", options.SSECustomerKey)
+	if err != nil {
+		return err
+	}
+	err = addSSECustomerHeaders(headers, "x-amz-server-side-encryption-customer-", options.SSECustomerKey)
+	if err != nil {
+		return err
 	}
 	req := &request{
 		method:  "PUT",
 		bucket:  b.Name,
 		path:    path,
 		headers: headers,
-		payload: payload{
-			payload:   r,
-			md5b64:    md5b64,
-			sha256hex: sha256hex,
-		},
 	}
-	return b.S3.query(req, nil)
+	_, err = b.S3.copyQuery(req, &CopyObjectResult{})
+	return err
 }
 
 // Del removes an object from the S3 bucket.
@@ -281,13 +1700,58 @@ func (b *Bucket) Del(path string) error {
 	return b.S3.query(req, nil)
 }
 
+// ErrETagMismatch is returned by conditional deletes when the object's
+// ETag doesn't match the expected one.
+var ErrETagMismatch = errors.New("s3: object ETag does not match")
+
+// DelIfMatch removes the object at path only if its ETag is etag, which
+// S3 checks atomically ("If-Match" header). If the object changed,
+// ErrETagMismatch is returned. Stores that don't support conditional
+// deletes may ignore the condition; see DelIfETag.
+func (b *Bucket) DelIfMatch(path, etag string) error {
+	req := &request{
+		method:  "DELETE",
+		bucket:  b.Name,
+		path:    path,
+		headers: map[string][]string{"If-Match": {quoteETag(etag)}},
+	}
+	err := b.S3.query(req, nil)
+	if hasStatus(err, http.StatusPreconditionFailed) {
+		return ErrETagMismatch
+	}
+	return err
+}
+
+// DelIfETag removes the object at path only if its ETag is etag. Unlike
+// DelIfMatch, it first reads the object's ETag and returns
+// ErrETagMismatch without deleting anything if it differs, so it also
+// guards deletes on stores that ignore the "If-Match" header. There,
+// the object may still change between the check and the delete.
+func (b *Bucket) DelIfETag(path, etag string) error {
+	key, err := b.Info(path)
+	if err != nil {
+		return err
+	}
+	if key.ETag != quoteETag(etag) {
+		return ErrETagMismatch
+	}
+	return b.DelIfMatch(path, etag)
+}
+
+// quoteETag returns etag in double quotes, as S3 reports ETags.
+func quoteETag(etag string) string {
+	return `"` + strings.Trim(etag, `"`) + `"`
+}
+
 // The ListResp type holds the results of a List bucket operation.
 type ListResp struct {
 	Name      string
 	Prefix    string
 	Delimiter string
 	Marker    string
-	MaxKeys   int
+	// NextMarker is only returned by S3 when a delimiter is used.
+	NextMarker string
+	MaxKeys    int
 	// IsTruncated is true if the results have been truncated because
 	// there are more keys and prefixes than can fit in MaxKeys.
 	// N.B. this is the opposite sense to that documented (incorrectly) in
@@ -295,6 +1759,18 @@ type ListResp struct {
 	IsTruncated    bool
 	Contents       []Key
 	CommonPrefixes []string `xml:">Prefix"`
+	// EncodingType is "url" if the names in the listing were URL
+	// encoded by S3. List decodes them before returning.
+	EncodingType string `xml:",omitempty"`
+}
+
+// ListOptions holds optional settings for listings.
+type ListOptions struct {
+	// EncodeKeys asks S3 to URL encode the names in the listing, which
+	// is needed for names holding characters that XML 1.0 can't
+	// represent, such as most control characters. The names are
+	// decoded before being returned, so this is transparent to callers.
+	EncodeKeys bool
 }
 
 // The Key type represents an item stored in an S3 bucket.
@@ -306,21 +1782,145 @@ type Key struct {
 	// surrounded with double-quotes.
 	ETag         string
 	StorageClass string
-	Owner        Owner
+	// Owner is the owner of the object. It is set for keys returned
+	// by List, which always includes owner information, but not for
+	// keys built from response headers (e.g. by Info).
+	Owner Owner
+	// Meta holds the user-defined metadata of the object, as returned
+	// by ParseMeta. It is only set for keys built from response headers.
+	Meta map[string][]string `xml:"-"`
+	// RequestCharged is true if the requester was charged for the
+	// request that returned the key. It is only set for keys built
+	// from response headers.
+	RequestCharged bool `xml:"-"`
+	// PartsCount is the number of parts of objects uploaded via
+	// multipart upload, as reported by S3, or zero for other objects.
+	// It is only set for keys built from response headers.
+	PartsCount int `xml:"-"`
+	// ExpiryDate is the time at which the object will be deleted by a
+	// lifecycle expiration rule, and ExpiryRuleID the ID of that rule,
+	// as reported in the x-amz-expiration header (see ParseExpiration).
+	// They are only set for keys built from response headers of objects
+	// that are due to expire.
+	ExpiryDate   time.Time `xml:"-"`
+	ExpiryRuleID string    `xml:"-"`
+	// ContentType is the content type of the object. It is only set
+	// for keys built from response headers.
+	ContentType string `xml:"-"`
+	// ServerSideEncryption is the algorithm S3 encrypts the object
+	// with at rest ("AES256", "aws:kms", ...), and SSEKMSKeyID the ID
+	// of the KMS key used for aws:kms. They are only set for keys
+	// built from response headers of encrypted objects.
+	ServerSideEncryption string `xml:"-"`
+	SSEKMSKeyID          string `xml:"-"`
+	// ChecksumCRC64NVME is the base64 encoded CRC-64/NVME checksum of
+	// the object. It is only set for keys built from response headers
+	// that include it, as sent by S3 when checksums are requested
+	// (see GetOptions.ChecksumMode).
+	ChecksumCRC64NVME string `xml:"-"`
+	// Header holds all the headers of the response the key was built
+	// from. It is only set for keys built from response headers.
+	Header http.Header `xml:"-"`
+}
+
+// requestCharged reports whether the response headers h report that
+// the requester was charged for the request.
+func requestCharged(h http.Header) bool {
+	return h.Get("x-amz-request-charged") == "requester"
+}
+
+const metaPrefix = "X-Amz-Meta-"
+
+// ParseMeta returns the user-defined metadata held in the x-amz-meta-*
+// headers of h, keyed by name without the prefix. Names are lowercased:
+// S3 itself stores them in lower case, and net/http canonicalizes the
+// case of header names anyway, so the case used when storing metadata
+// can't be recovered. It returns nil if h holds no metadata.
+func ParseMeta(h http.Header) map[string][]string {
+	var meta map[string][]string
+	for name, values := range h {
+		if len(name) <= len(metaPrefix) || !strings.EqualFold(name[:len(metaPrefix)], metaPrefix) {
+			continue
+		}
+		if meta == nil {
+			meta = make(map[string][]string)
+		}
+		name = strings.ToLower(name[len(metaPrefix):])
+		meta[name] = append(meta[name], values...)
+	}
+	return meta
+}
+
+// ParseExpiration parses the value of the x-amz-expiration header S3
+// sends for objects that will be deleted by a lifecycle expiration rule,
+// such as:
+//
+//	expiry-date="Fri, 23 Dec 2012 00:00:00 GMT", rule-id="picture-deletion-rule"
+//
+// It returns the time at which the object expires and the ID of the rule.
+func ParseExpiration(value string) (expiry time.Time, ruleID string, err error) {
+	var date string
+	rest := value
+	for rest = strings.TrimLeft(rest, ", "); rest != ""; rest = strings.TrimLeft(rest, ", ") {
+		eq := strings.Index(rest, `="`)
+		if eq < 0 {
+			return time.Time{}, "", fmt.Errorf("bad x-amz-expiration header: %q", value)
+		}
+		name := rest[:eq]
+		rest = rest[eq+2:]
+		end := strings.Index(rest, `"`)
+		if end < 0 {
+			return time.Time{}, "", fmt.Errorf("bad x-amz-expiration header: %q", value)
+		}
+		switch name {
+		case "expiry-date":
+			date = rest[:end]
+		case "rule-id":
+			ruleID = rest[:end]
+		}
+		rest = rest[end+1:]
+	}
+	expiry, err = time.Parse(time.RFC1123, date)
+	if err != nil {
+		return time.Time{}, "", fmt.Errorf("bad x-amz-expiration header: %q", value)
+	}
+	return expiry, ruleID, nil
 }
 
 func keyFromHeaders(path string, h http.Header) (key *Key) {
 	mtime, _ := time.Parse(time.RFC1123, h.Get("Last-Modified"))
 	size, _ := strconv.ParseInt(h.Get("Content-Length"), 10, 64)
+	partsCount, _ := strconv.Atoi(h.Get("x-amz-mp-parts-count"))
+	expiry, ruleID, _ := ParseExpiration(h.Get("x-amz-expiration"))
 
 	return &Key{
-		Key:          path,
-		LastModified: mtime.Format("2006-01-02T15:04:05") + ".000Z",
-		Size:         size,
-		ETag:         h.Get("ETag"),
+		Key:            path,
+		LastModified:   mtime.Format("2006-01-02T15:04:05") + ".000Z",
+		Size:           size,
+		ETag:           h.Get("ETag"),
+		Meta:           ParseMeta(h),
+		RequestCharged: requestCharged(h),
+		PartsCount:     partsCount,
+		StorageClass:   h.Get("x-amz-storage-class"),
+		ExpiryDate:     expiry,
+		ExpiryRuleID:   ruleID,
+		ContentType:    h.Get("Content-Type"),
+
+		ServerSideEncryption: h.Get("x-amz-server-side-encryption"),
+		SSEKMSKeyID:          h.Get("x-amz-server-side-encryption-aws-kms-key-id"),
+		ChecksumCRC64NVME:    h.Get("x-amz-checksum-crc64nvme"),
+		Header:               h,
 	}
 }
 
+// encrypted reports whether the response headers h report that the
+// object is encrypted at rest, with a key managed by S3 or KMS or with
+// one provided by the customer (SSE-C).
+func encrypted(h http.Header) bool {
+	return h.Get("x-amz-server-side-encryption") != "" ||
+		h.Get("x-amz-server-side-encryption-customer-algorithm") != ""
+}
+
 // List returns information about objects in an S3 bucket.
 //
 // The prefix parameter limits the response to keys that begin with the
@@ -336,7 +1936,8 @@ func keyFromHeaders(path string, h http.Header) (key *Key) {
 // will return keys alphabetically greater than the marker.
 //
 // The max parameter specifies how many keys + common prefixes to return in
-// the response. The default is 1000.
+// the response. The default is 1000, which is also the maximum; larger
+// values are lowered to it.
 //
 // For example, given these keys in a bucket:
 //
@@ -378,31 +1979,294 @@ func keyFromHeaders(path string, h http.Header) (key *Key) {
 //
 // See http://goo.gl/YjQTc for details.
 func (b *Bucket) List(prefix, delim, marker string, max int) (result *ListResp, err error) {
+	return b.ListWithOptions(prefix, delim, marker, max, ListOptions{})
+}
+
+// ListWithOptions is like List but also applies the given listing options.
+func (b *Bucket) ListWithOptions(prefix, delim, marker string, max int, options ListOptions) (result *ListResp, err error) {
 	params := map[string][]string{
 		"prefix":    {prefix},
 		"delimiter": {delim},
 		"marker":    {marker},
 	}
+	if max > maxListKeys {
+		max = maxListKeys
+	}
 	if max != 0 {
 		params["max-keys"] = []string{strconv.FormatInt(int64(max), 10)}
 	}
+	if options.EncodeKeys {
+		params["encoding-type"] = []string{"url"}
+	}
 	req := &request{
 		bucket: b.Name,
 		params: params,
 	}
 	result = &ListResp{}
-	for attempt := attempts.Start(); attempt.Next(); {
+	for attempt := b.S3.startAttempts(); attempt.Next(); {
 		err = b.S3.query(req, result)
-		if !shouldRetry(err) {
+		if !b.S3.shouldRetry(req.method, err) {
 			break
 		}
 	}
 	if err != nil {
 		return nil, err
 	}
+	if result.EncodingType == "url" {
+		err = result.decode()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// decode URL decodes the names in resp.
+func (resp *ListResp) decode() error {
+	names := []*string{&resp.Prefix, &resp.Delimiter, &resp.Marker, &resp.NextMarker}
+	for i := range resp.Contents {
+		names = append(names, &resp.Contents[i].Key)
+	}
+	for i := range resp.CommonPrefixes {
+		names = append(names, &resp.CommonPrefixes[i])
+	}
+	for _, name := range names {
+		decoded, err := url.QueryUnescape(*name)
+		if err != nil {
+			return fmt.Errorf("bad URL encoded name in listing: %q", *name)
+		}
+		*name = decoded
+	}
+	resp.EncodingType = ""
+	return nil
+}
+
+// ListResult holds a page of a listing returned by ListPage.
+type ListResult struct {
+	Keys     []Key
+	Prefixes []string
+	// IsTruncated is true if there are more keys and prefixes to list.
+	IsTruncated bool
+	// Token is an opaque token that may be passed to ListPage to get
+	// the next page of the listing. It is empty on the last page.
+	Token string
+}
+
+const listTokenPrefix = "m:"
+
+// ListPage returns a page of up to maxKeys keys and common prefixes in b,
+// as List would. The page starts at the beginning of the listing if token
+// is empty, and otherwise where the page that returned token ended.
+// Tokens remain valid indefinitely, so they may be persisted to resume a
+// listing later, for example after a restart. They must only be passed
+// back with the same prefix and delim.
+func (b *Bucket) ListPage(prefix, delim, token string, maxKeys int) (*ListResult, error) {
+	marker := ""
+	if token != "" {
+		data, err := base64.RawURLEncoding.DecodeString(token)
+		if err != nil || !strings.HasPrefix(string(data), listTokenPrefix) {
+			return nil, fmt.Errorf("bad list token: %q", token)
+		}
+		marker = string(data[len(listTokenPrefix):])
+	}
+	resp, err := b.List(prefix, delim, marker, maxKeys)
+	if err != nil {
+		return nil, err
+	}
+	result := &ListResult{
+		Keys:        resp.Contents,
+		Prefixes:    resp.CommonPrefixes,
+		IsTruncated: resp.IsTruncated,
+	}
+	if resp.IsTruncated {
+		result.Token = base64.RawURLEncoding.EncodeToString([]byte(listTokenPrefix + resp.nextMarker()))
+	}
 	return result, nil
 }
 
+// maxListKeys is the largest number of keys and common prefixes S3
+// returns in a single listing response.
+const maxListKeys = 1000
+
+// ListFirst returns up to n keys and common prefixes in b, as List
+// would, stopping as soon as n of them are collected. It fetches as many
+// pages as needed, but no more, so ListFirst(prefix, "", 1) is a cheap
+// way to check whether any object exists under prefix.
+func (b *Bucket) ListFirst(prefix, delim string, n int) (keys []Key, prefixes []string, err error) {
+	marker := ""
+	for len(keys)+len(prefixes) < n {
+		resp, err := b.List(prefix, delim, marker, n-len(keys)-len(prefixes))
+		if err != nil {
+			return nil, nil, err
+		}
+		keys = append(keys, resp.Contents...)
+		prefixes = append(prefixes, resp.CommonPrefixes...)
+		if !resp.IsTruncated {
+			break
+		}
+		marker = resp.nextMarker()
+	}
+	return keys, prefixes, nil
+}
+
+// nextMarker returns the marker from which the listing that produced
+// resp should continue if it was truncated.
+func (resp *ListResp) nextMarker() string {
+	if resp.NextMarker != "" {
+		return resp.NextMarker
+	}
+	marker := ""
+	if n := len(resp.Contents); n > 0 {
+		marker = resp.Contents[n-1].Key
+	}
+	if n := len(resp.CommonPrefixes); n > 0 && resp.CommonPrefixes[n-1] > marker {
+		marker = resp.CommonPrefixes[n-1]
+	}
+	return marker
+}
+
+// ListPrefixes returns the "directories" immediately below prefix,
+// that is, the common prefixes of the keys beginning with prefix
+// up to the next "/". Objects are not returned. All pages of results
+// are retrieved.
+func (b *Bucket) ListPrefixes(prefix string) ([]string, error) {
+	var prefixes []string
+	marker := ""
+	for {
+		resp, err := b.List(prefix, "/", marker, 0)
+		if err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, resp.CommonPrefixes...)
+		if !resp.IsTruncated {
+			return prefixes, nil
+		}
+		marker = resp.nextMarker()
+	}
+}
+
+// ListEntry is a key or a common prefix in a listing. Exactly one of
+// Key and Prefix is set.
+type ListEntry struct {
+	Key    *Key
+	Prefix string
+}
+
+// Entries returns the keys and common prefixes in resp merged in
+// lexicographic order, as they would appear in a directory listing.
+// S3 returns them in two separate lists, each of them ordered.
+func (resp *ListResp) Entries() []ListEntry {
+	entries := make([]ListEntry, 0, len(resp.Contents)+len(resp.CommonPrefixes))
+	keys, prefixes := resp.Contents, resp.CommonPrefixes
+	for len(keys) > 0 || len(prefixes) > 0 {
+		if len(prefixes) == 0 || len(keys) > 0 && keys[0].Key < prefixes[0] {
+			entries = append(entries, ListEntry{Key: &keys[0]})
+			keys = keys[1:]
+		} else {
+			entries = append(entries, ListEntry{Prefix: prefixes[0]})
+			prefixes = prefixes[1:]
+		}
+	}
+	return entries
+}
+
+// WalkEntries calls f for each key and common prefix in b, as List
+// would return them for prefix and delim, in lexicographic order across
+// all pages of the listing (see ListResp.Entries). Pages are retrieved
+// as needed. If f returns an error, the walk stops and returns it.
+func (b *Bucket) WalkEntries(prefix, delim string, f func(entry ListEntry) error) error {
+	marker := ""
+	for {
+		resp, err := b.List(prefix, delim, marker, 0)
+		if err != nil {
+			return err
+		}
+		for _, entry := range resp.Entries() {
+			if err := f(entry); err != nil {
+				return err
+			}
+		}
+		if !resp.IsTruncated {
+			return nil
+		}
+		marker = resp.nextMarker()
+	}
+}
+
+// PrefixUsage holds the total size and number of a set of objects.
+type PrefixUsage struct {
+	Bytes int64
+	Count int64
+}
+
+// PrefixSize returns the total size and the number of the objects whose
+// keys begin with prefix. The objects are listed one page at a time, so
+// memory use doesn't grow with their number.
+func (b *Bucket) PrefixSize(prefix string) (totalBytes int64, count int64, err error) {
+	err = b.walkPrefix(prefix, func(key *Key) {
+		totalBytes += key.Size
+		count++
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	return totalBytes, count, nil
+}
+
+// PrefixSizeByClass is like PrefixSize, but breaks the usage down by
+// the storage class of the objects.
+func (b *Bucket) PrefixSizeByClass(prefix string) (map[string]PrefixUsage, error) {
+	usage := make(map[string]PrefixUsage)
+	err := b.walkPrefix(prefix, func(key *Key) {
+		u := usage[key.StorageClass]
+		u.Bytes += key.Size
+		u.Count++
+		usage[key.StorageClass] = u
+	})
+	if err != nil {
+		return nil, err
+	}
+	return usage, nil
+}
+
+// ListModifiedSince returns the objects whose keys begin with prefix
+// and that were last modified after since, as for incremental backups.
+// S3 can't filter objects by time, so all of them are listed, but only
+// the matching ones are retained. Objects whose modification time can't
+// be parsed are returned as well, so that none is missed.
+func (b *Bucket) ListModifiedSince(prefix string, since time.Time) ([]Key, error) {
+	var keys []Key
+	err := b.walkPrefix(prefix, func(key *Key) {
+		mtime, err := time.Parse(time.RFC3339, key.LastModified)
+		if err != nil || mtime.After(since) {
+			keys = append(keys, *key)
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+// walkPrefix calls f with each of the objects whose keys begin with
+// prefix, retrieving all pages of results.
+func (b *Bucket) walkPrefix(prefix string, f func(key *Key)) error {
+	marker := ""
+	for {
+		resp, err := b.List(prefix, "", marker, 0)
+		if err != nil {
+			return err
+		}
+		for i := range resp.Contents {
+			f(&resp.Contents[i])
+		}
+		if !resp.IsTruncated {
+			return nil
+		}
+		marker = resp.nextMarker()
+	}
+}
+
 // URL returns a non-signed URL that allows retriving the
 // object at path. It only works if the object is publicly
 // readable (see SignedURL).
@@ -471,6 +2335,9 @@ type request struct {
 	baseurl  string
 	payload  payload
 	prepared bool
+
+	// ctx, if not nil, is the context the request is sent with.
+	ctx context.Context
 }
 
 func (req *request) encodeParams() string {
@@ -515,21 +2382,57 @@ func (req *request) url() (*url.URL, error) {
 // If resp is not nil, the XML data contained in the response
 // body will be unmarshalled on it.
 func (s3 *S3) query(req *request, resp interface{}) error {
+	_, err := s3.queryHeader(req, resp)
+	return err
+}
+
+// queryHeader is like query but also returns the headers of the
+// http response.
+func (s3 *S3) queryHeader(req *request, resp interface{}) (http.Header, error) {
 	err := s3.prepare(req)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	hresp, err := s3.run(req)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	if resp != nil {
-		err = xml.NewDecoder(hresp.Body).Decode(resp)
+		body := &io.LimitedReader{R: hresp.Body, N: math.MaxInt64}
+		if s3.MaxResponseSize > 0 && s3.MaxResponseSize < math.MaxInt64 {
+			// One byte more tells a body of the maximum size from
+			// a larger one.
+			body.N = s3.MaxResponseSize + 1
+		}
+		// The body is read in full before decoding it, so that a
+		// body cut short, as a chunked one whose last chunk is
+		// missing, fails the request instead of being decoded up to
+		// where it ends.
+		data, err := ioutil.ReadAll(body)
+		if body.N == 0 {
+			hresp.Body.Close()
+			return nil, ErrResponseTooLarge
+		}
+		if err != nil {
+			hresp.Body.Close()
+			return nil, err
+		}
+		hresp.Body.Close()
+		// An empty body leaves resp alone, but a malformed one fails
+		// the request.
+		err = xml.NewDecoder(bytes.NewReader(data)).Decode(resp)
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		return hresp.Header, nil
 	}
 	hresp.Body.Close()
-	return nil
+	return hresp.Header, nil
 }
 
+// accelerateEndpoint is the bucket endpoint used when UseAccelerate is set.
+const accelerateEndpoint = "https://${bucket}.s3-accelerate.amazonaws.com"
+
 // prepare sets up req to be delivered to S3.
 func (s3 *S3) prepare(req *request) error {
 	if !req.prepared {
@@ -546,6 +2449,9 @@ func (s3 *S3) prepare(req *request) error {
 		for k, v := range req.headers {
 			headers[k] = v
 		}
+		for k, v := range s3.headers {
+			headers[k] = v
+		}
 		req.params = params
 		req.headers = headers
 		if !strings.HasPrefix(req.path, "/") {
@@ -554,6 +2460,12 @@ func (s3 *S3) prepare(req *request) error {
 		req.signpath = req.path
 		if req.bucket != "" {
 			req.baseurl = s3.Region.S3BucketEndpoint
+			if s3.UseAccelerate {
+				if strings.Contains(req.bucket, ".") {
+					return fmt.Errorf("bad S3 bucket for transfer acceleration: %q (path-style addressing is not supported)", req.bucket)
+				}
+				req.baseurl = accelerateEndpoint
+			}
 			if req.baseurl == "" {
 				// Use the path method to address the bucket.
 				req.baseurl = s3.Region.S3Endpoint
@@ -567,6 +2479,9 @@ func (s3 *S3) prepare(req *request) error {
 			}
 			req.signpath = "/" + req.bucket + req.signpath
 		}
+		if s3.DisableSSL && strings.HasPrefix(req.baseurl, "https://") {
+			req.baseurl = "http://" + req.baseurl[len("https://"):]
+		}
 	}
 
 	// Always sign again as it's not clear how far the
@@ -576,7 +2491,10 @@ func (s3 *S3) prepare(req *request) error {
 		return fmt.Errorf("bad S3 endpoint URL %q: %v", req.baseurl, err)
 	}
 	req.headers["Host"] = []string{u.Host}
-	req.headers["Date"] = []string{time.Now().In(time.UTC).Format(time.RFC1123)}
+	if s3.SigningHost != "" {
+		req.headers["Host"] = []string{s3.SigningHost}
+	}
+	req.headers["Date"] = []string{s3.now().In(time.UTC).Format(time.RFC1123)}
 
 	return nil
 }
@@ -597,15 +2515,21 @@ func (s3 *S3) run(req *request) (*http.Response, error) {
 		Method:     req.method,
 		ProtoMajor: 1,
 		ProtoMinor: 1,
-		Close:      true,
+		Close:      !s3.HTTP2,
 		Header:     req.headers,
 	}
 
 	hreq.Host = hreq.URL.Host
+	if s3.SigningHost != "" {
+		hreq.Host = s3.SigningHost
+	}
+
+	if s3.RequestModifier != nil {
+		s3.RequestModifier(&hreq)
+	}
 
 	if s3.Region.S3V4Signature {
-		signer := NewV4Signer(s3.Auth, "s3", s3.Region)
-		err = signer.Sign(&hreq, req.payload.sha256hex)
+		err = s3.signer(req.bucket).Sign(&hreq, req.payload.sha256hex)
 		if err != nil {
 			return nil, err
 		}
@@ -613,28 +2537,131 @@ func (s3 *S3) run(req *request) (*http.Response, error) {
 		Sign(s3.Auth, req.method, req.signpath, req.params, req.headers)
 	}
 
+	empty := false
 	if v, ok := req.headers["Content-Length"]; ok {
 		hreq.ContentLength, _ = strconv.ParseInt(v[0], 10, 64)
+		empty = hreq.ContentLength == 0
 		delete(req.headers, "Content-Length")
 	}
 	if req.payload.payload != nil {
 		hreq.Body = ioutil.NopCloser(req.payload.payload)
+		if empty {
+			// Otherwise net/http takes the length as unknown.
+			hreq.Body = http.NoBody
+		}
+	}
+
+	if s3.DryRun != nil {
+		return s3.DryRun.record(&hreq)
 	}
 
-	hresp, err := http.DefaultClient.Do(&hreq)
+	client := http.DefaultClient
+	if s3.NoRedirects {
+		client = noRedirectClient
+	}
+	if s3.HTTP2 {
+		client = http2Client
+		if s3.NoRedirects {
+			client = http2NoRedirectClient
+		}
+	}
+	r := &hreq
+	if req.ctx != nil {
+		r = hreq.WithContext(req.ctx)
+	}
+	var traced func(resp *http.Response, err error)
+	if s3.OnTrace != nil {
+		r, traced = s3.traceRequest(r)
+	}
+	hresp, err := client.Do(r)
+	if traced != nil {
+		traced(hresp, err)
+	}
 	if err != nil {
 		return nil, err
 	}
+	if region := hresp.Header.Get("x-amz-bucket-region"); region != "" && req.bucket != "" {
+		s3.regions.add(req.bucket, region)
+	}
+	if s3.OnRequestCharged != nil && requestCharged(hresp.Header) {
+		s3.OnRequestCharged(hresp)
+	}
 	if debug {
 		dump, _ := httputil.DumpResponse(hresp, true)
 		log.Printf("} -> %s\n", dump)
 	}
+	if s3.NoRedirects && isRedirect(hresp.StatusCode) {
+		return nil, buildRedirectError(hresp)
+	}
 	if hresp.StatusCode != 200 && hresp.StatusCode != 204 && hresp.StatusCode != 206 {
 		return nil, buildError(hresp)
 	}
 	return hresp, err
 }
 
+// noRedirectClient is used instead of http.DefaultClient by clients
+// that don't follow redirects.
+var noRedirectClient = &http.Client{
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+func isRedirect(status int) bool {
+	switch status {
+	case 301, 302, 303, 307, 308:
+		return true
+	}
+	return false
+}
+
+// Sign signs req in place with the AWS Signature Version 4 Signing
+// Process, using the credentials and region of s3. It allows requests
+// built by hand to be sent to S3 with the same settings as the client.
+// If payloadHash is empty, the hash of an empty payload is assumed;
+// it may also be UnsignedPayload to leave the body out of the signature.
+func (s3 *S3) Sign(req *http.Request, payloadHash string) error {
+	if req.Host == "" {
+		req.Host = req.URL.Host
+	}
+	return s3.signer("").Sign(req, payloadHash)
+}
+
+// SignBody is like Sign but computes the payload hash from body, which
+// should hold the content sent as the request body (see V4Signer.SignBody).
+// To sign without hashing the body, pass UnsignedPayload to Sign instead.
+func (s3 *S3) SignBody(req *http.Request, body io.ReadSeeker) error {
+	if req.Host == "" {
+		req.Host = req.URL.Host
+	}
+	return s3.signer("").SignBody(req, body)
+}
+
+// signer returns a V4 signer for requests to the named bucket, which
+// signs for the recorded region of the bucket if known.
+func (s3 *S3) signer(bucket string) *V4Signer {
+	region := s3.Region
+	if name, ok := s3.regions.get(bucket); ok && bucket != "" {
+		region.Name = name
+	}
+	service := s3.SigningService
+	if service == "" {
+		service = "s3"
+	}
+	signer := NewV4Signer(s3.Auth, service, region)
+	signer.now = s3.now
+	signer.SpaceAsPlus = s3.QuerySpaceAsPlus
+	return signer
+}
+
+// now returns the current time according to the clock of s3.
+func (s3 *S3) now() time.Time {
+	if s3.clock != nil {
+		return s3.clock()
+	}
+	return time.Now()
+}
+
 // Error represents an error in an operation with S3.
 type Error struct {
 	StatusCode int    // HTTP status code (200, 403, ...)
@@ -643,12 +2670,58 @@ type Error struct {
 	BucketName string
 	RequestId  string
 	HostId     string
+
+	// Status is the HTTP status line ("503 Service Unavailable", ...).
+	Status string `xml:"-"`
+	// Header holds selected headers of the response that may help
+	// diagnosing the error (see errorHeaders).
+	Header http.Header `xml:"-"`
+	// Body holds the beginning of the response body if it isn't an S3
+	// error document, as when the error comes from a proxy.
+	Body string `xml:"-"`
+}
+
+// errorHeaders lists the response headers kept in Error.Header.
+var errorHeaders = []string{
+	"Content-Type",
+	"Retry-After",
+	"Server",
+	"X-Amz-Request-Id",
+	"X-Amz-Id-2",
+	"X-Amz-Bucket-Region",
 }
 
+// errorBodySnippetSize is the number of bytes of non-S3 error response
+// bodies kept in Error.Body.
+const errorBodySnippetSize = 512
+
 func (e *Error) Error() string {
 	return e.Message
 }
 
+// Errors matched by errors.Is against an *Error with the corresponding
+// S3 error code, which saves callers from comparing codes themselves.
+var (
+	ErrNoSuchKey    = errors.New("s3: no such key")
+	ErrNoSuchBucket = errors.New("s3: no such bucket")
+	ErrAccessDenied = errors.New("s3: access denied")
+	ErrNoSuchUpload = errors.New("s3: no such upload")
+)
+
+// codeErrors maps S3 error codes to the errors an *Error wraps.
+var codeErrors = map[string]error{
+	"NoSuchKey":    ErrNoSuchKey,
+	"NoSuchBucket": ErrNoSuchBucket,
+	"AccessDenied": ErrAccessDenied,
+	"NoSuchUpload": ErrNoSuchUpload,
+}
+
+// Unwrap returns the error matching the S3 error code of e, if any,
+// such as ErrNoSuchKey for NoSuchKey.
+func (e *Error) Unwrap() error {
+	return codeErrors[e.Code]
+}
+
 func buildError(r *http.Response) error {
 	if debug {
 		log.Printf("got error (status code %v)", r.StatusCode)
@@ -662,19 +2735,69 @@ func buildError(r *http.Response) error {
 	}
 
 	err := Error{}
-	// TODO return error if Unmarshal fails?
-	xml.NewDecoder(r.Body).Decode(&err)
+	data, _ := ioutil.ReadAll(io.LimitReader(r.Body, 64*1024))
 	r.Body.Close()
+	if xml.Unmarshal(data, &err) != nil || err.Code == "" {
+		if len(data) > errorBodySnippetSize {
+			data = data[:errorBodySnippetSize]
+		}
+		err.Body = string(data)
+	}
 	err.StatusCode = r.StatusCode
+	err.Status = r.Status
 	if err.Message == "" {
 		err.Message = r.Status
 	}
+	if err.RequestId == "" {
+		err.RequestId = r.Header.Get("x-amz-request-id")
+	}
+	for _, name := range errorHeaders {
+		if v, ok := r.Header[name]; ok {
+			if err.Header == nil {
+				err.Header = make(http.Header)
+			}
+			err.Header[name] = v
+		}
+	}
 	if debug {
 		log.Printf("err: %#v\n", err)
 	}
 	return &err
 }
 
+// RedirectError is returned by clients with NoRedirects set when S3
+// responds with a redirect, for example because the bucket is in another
+// region than the one the request was sent to.
+type RedirectError struct {
+	StatusCode int    // HTTP status code (301, 307, ...)
+	Code       string // S3 error code ("PermanentRedirect", ...), if any
+	Message    string
+	Location   string // the Location header, if any
+	Region     string // the x-amz-bucket-region header, if any
+}
+
+func (e *RedirectError) Error() string {
+	msg := "s3: redirect: " + e.Message
+	if e.Location != "" {
+		msg += " (location " + e.Location + ")"
+	}
+	if e.Region != "" {
+		msg += " (bucket region " + e.Region + ")"
+	}
+	return msg
+}
+
+func buildRedirectError(r *http.Response) error {
+	err := buildError(r).(*Error)
+	return &RedirectError{
+		StatusCode: err.StatusCode,
+		Code:       err.Code,
+		Message:    err.Message,
+		Location:   r.Header.Get("Location"),
+		Region:     r.Header.Get("x-amz-bucket-region"),
+	}
+}
+
 func shouldRetry(err error) bool {
 	if err == nil {
 		return false
@@ -683,9 +2806,12 @@ func shouldRetry(err error) bool {
 	case io.ErrUnexpectedEOF, io.EOF:
 		return true
 	}
+	// DNS errors usually come wrapped by net/http.
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return !dnsErr.IsNotFound || retryDNSNotFound
+	}
 	switch e := err.(type) {
-	case *net.DNSError:
-		return true
 	case *net.OpError:
 		switch e.Op {
 		case "read", "write":
@@ -700,7 +2826,61 @@ func shouldRetry(err error) bool {
 	return false
 }
 
+// RetryPolicy reports whether a request with the given HTTP method
+// that failed with err should be retried.
+type RetryPolicy func(method string, err error) bool
+
+// DefaultRetryPolicy retries requests of any method that failed with
+// network errors or transient S3 errors such as InternalError. It is
+// used by clients without a RetryPolicy.
+func DefaultRetryPolicy(method string, err error) bool {
+	return shouldRetry(err)
+}
+
+// RetryMethods returns a RetryPolicy that retries requests with one of
+// the given methods as DefaultRetryPolicy does, and never retries other
+// requests. For example, RetryMethods("GET", "HEAD", "PUT") leaves
+// non-idempotent POST requests, such as the completion of multipart
+// uploads, to the caller.
+func RetryMethods(methods ...string) RetryPolicy {
+	retried := make(map[string]bool, len(methods))
+	for _, method := range methods {
+		retried[method] = true
+	}
+	return func(method string, err error) bool {
+		return retried[method] && shouldRetry(err)
+	}
+}
+
+// shouldRetry reports whether a request with the given method that
+// failed with err should be retried according to s3.RetryPolicy.
+func (s3 *S3) shouldRetry(method string, err error) bool {
+	if err == nil {
+		return false
+	}
+	if method == "" {
+		method = "GET"
+	}
+	if s3.RetryPolicy != nil {
+		return s3.RetryPolicy(method, err)
+	}
+	return shouldRetry(err)
+}
+
+// retriesMethod reports whether s3.RetryPolicy retries requests with the
+// given method at all, by asking it about a transient error. Requests
+// that are sent again for reasons of their own, which the policy doesn't
+// know about, check it first.
+func (s3 *S3) retriesMethod(method string) bool {
+	return s3.shouldRetry(method, &Error{StatusCode: 500, Code: "InternalError"})
+}
+
 func hasCode(err error, code string) bool {
 	s3err, ok := err.(*Error)
 	return ok && s3err.Code == code
 }
+
+func hasStatus(err error, status int) bool {
+	s3err, ok := err.(*Error)
+	return ok && s3err.StatusCode == status
+}
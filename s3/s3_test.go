@@ -2,8 +2,20 @@ package s3_test
 
 import (
 	"bytes"
+	"compress/gzip"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
 	"io/ioutil"
+	"math"
+	"net"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
@@ -49,6 +61,33 @@ func (s *S) TearDownTest(c *C) {
 	testServer.Flush()
 }
 
+func (s *S) TestNewFromEnv(c *C) {
+	for _, name := range []string{"HOME", "AWS_PROFILE", "AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY", "AWS_REGION", "AWS_DEFAULT_REGION",
+		"EC2_ACCESS_KEY", "EC2_SECRET_KEY", "AWS_SHARED_CREDENTIALS_FILE", "AWS_CONFIG_FILE"} {
+		if value, ok := os.LookupEnv(name); ok {
+			defer os.Setenv(name, value)
+		} else {
+			defer os.Unsetenv(name)
+		}
+		os.Unsetenv(name)
+	}
+	os.Setenv("HOME", c.MkDir())
+
+	_, err := s3.NewFromEnv()
+	c.Assert(err, ErrorMatches, "no AWS credentials found: .*")
+
+	os.Setenv("AWS_ACCESS_KEY_ID", "access")
+	os.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	_, err = s3.NewFromEnv()
+	c.Assert(err, Equals, aws.ErrNoRegion)
+
+	os.Setenv("AWS_REGION", "eu-west-1")
+	client, err := s3.NewFromEnv()
+	c.Assert(err, IsNil)
+	c.Assert(client.Auth, Equals, aws.Auth{AccessKey: "access", SecretKey: "secret"})
+	c.Assert(client.Region, Equals, aws.EUWest)
+}
+
 // PutBucket docs: http://goo.gl/kBTCu
 
 func (s *S) TestPutBucket(c *C) {
@@ -113,6 +152,49 @@ func (s *S) TestURL(c *C) {
 	c.Assert(req.URL.Path, Equals, "/bucket/name")
 }
 
+func (s *S) TestDisableSSL(c *C) {
+	region := aws.Region{
+		Name:       "faux-region-1",
+		S3Endpoint: strings.Replace(testServer.URL, "http://", "https://", 1),
+	}
+	secure := s3.New(s.s3.Auth, region)
+	plain := s3.New(s.s3.Auth, region)
+	plain.DisableSSL = true
+	now := func() time.Time { return time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC) }
+	s3.SetClock(secure, now)
+	s3.SetClock(plain, now)
+
+	testServer.Response(200, nil, "content")
+	data, err := plain.Bucket("bucket").Get("name")
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "content")
+	req := testServer.WaitRequest()
+	c.Assert(req.URL.Path, Equals, "/bucket/name")
+
+	b := plain.Bucket("bucket")
+	c.Assert(b.URL("name"), Equals, testServer.URL+"/bucket/name")
+	c.Assert(strings.HasPrefix(b.SignedURL("name", now().Add(time.Hour)), "http://"), Equals, true)
+
+	urls, err := b.PresignURLs([]string{"name"}, time.Hour)
+	c.Assert(err, IsNil)
+	secureURLs, err := secure.Bucket("bucket").PresignURLs([]string{"name"}, time.Hour)
+	c.Assert(err, IsNil)
+	c.Assert(strings.HasPrefix(secureURLs[0], "https://"), Equals, true)
+	c.Assert(urls[0], Equals, "http://"+strings.TrimPrefix(secureURLs[0], "https://"))
+}
+
+func (s *S) TestURLAccelerate(c *C) {
+	accel := s3.New(s.s3.Auth, aws.USEast)
+	accel.UseAccelerate = true
+
+	b := accel.Bucket("bucket")
+	c.Assert(b.URL("name"), Equals, "https://bucket.s3-accelerate.amazonaws.com/name")
+
+	b = accel.Bucket("my.bucket")
+	_, err := b.Get("name")
+	c.Assert(err, ErrorMatches, `bad S3 bucket for transfer acceleration: "my.bucket" .*`)
+}
+
 func (s *S) TestGetReader(c *C) {
 	testServer.Response(200, nil, "content")
 
@@ -130,6 +212,344 @@ func (s *S) TestGetReader(c *C) {
 	c.Assert(req.Header["Date"], Not(Equals), "")
 }
 
+func (s *S) TestGetReaderResponse(c *C) {
+	testServer.Response(206, map[string]string{
+		"Content-Range":     "bytes 0-6/20",
+		"X-Amz-Custom-Flag": "set",
+	}, "content")
+
+	b := s.s3.Bucket("bucket")
+	resp, err := b.GetReaderResponse("name", map[string][]string{"Range": {"bytes=0-6"}})
+	c.Assert(err, IsNil)
+	c.Assert(resp.StatusCode, Equals, 206)
+	c.Assert(resp.Header.Get("Content-Range"), Equals, "bytes 0-6/20")
+	c.Assert(resp.Header.Get("X-Amz-Custom-Flag"), Equals, "set")
+	c.Assert(readAll(resp.Body), Equals, "content")
+	resp.Body.Close()
+
+	req := testServer.WaitRequest()
+	c.Assert(req.Method, Equals, "GET")
+	c.Assert(req.URL.Path, Equals, "/bucket/name")
+	c.Assert(req.Header.Get("Range"), Equals, "bytes=0-6")
+}
+
+func (s *S) TestGetIfChanged(c *C) {
+	testServer.Response(200, map[string]string{"ETag": `"new"`}, "content")
+
+	b := s.s3.Bucket("bucket")
+	rc, etag, changed, err := b.GetIfChanged("name", `"old"`)
+	c.Assert(err, IsNil)
+	c.Assert(changed, Equals, true)
+	c.Assert(etag, Equals, `"new"`)
+	data, err := ioutil.ReadAll(rc)
+	rc.Close()
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "content")
+
+	req := testServer.WaitRequest()
+	c.Assert(req.Method, Equals, "GET")
+	c.Assert(req.URL.Path, Equals, "/bucket/name")
+	c.Assert(req.Header["If-None-Match"], DeepEquals, []string{`"old"`})
+}
+
+func (s *S) TestGetIfChangedNotModified(c *C) {
+	testServer.Response(304, nil, "")
+
+	b := s.s3.Bucket("bucket")
+	rc, etag, changed, err := b.GetIfChanged("name", `"old"`)
+	c.Assert(err, IsNil)
+	c.Assert(changed, Equals, false)
+	c.Assert(etag, Equals, `"old"`)
+	c.Assert(rc, IsNil)
+
+	req := testServer.WaitRequest()
+	c.Assert(req.Header["If-None-Match"], DeepEquals, []string{`"old"`})
+}
+
+// bufferAt is an io.WriterAt writing to memory.
+type bufferAt []byte
+
+func (b *bufferAt) WriteAt(p []byte, off int64) (int, error) {
+	if end := int(off) + len(p); end > len(*b) {
+		*b = append(*b, make([]byte, end-len(*b))...)
+	}
+	return copy((*b)[off:], p), nil
+}
+
+func (s *S) TestResumeDownload(c *C) {
+	testServer.Response(206, map[string]string{"ETag": `"old"`}, "world")
+
+	b := s.s3.Bucket("bucket")
+	w := bufferAt("hello ")
+	etag, offset, err := b.ResumeDownload("name", &w, `"old"`, 6)
+	c.Assert(err, IsNil)
+	c.Assert(etag, Equals, `"old"`)
+	c.Assert(offset, Equals, int64(11))
+	c.Assert(string(w), Equals, "hello world")
+
+	req := testServer.WaitRequest()
+	c.Assert(req.Header.Get("If-Match"), Equals, `"old"`)
+	c.Assert(req.Header.Get("Range"), Equals, "bytes=6-")
+}
+
+func (s *S) TestResumeDownloadChanged(c *C) {
+	testServer.Response(412, nil, "")
+	testServer.Response(200, map[string]string{"ETag": `"new"`}, "new content")
+
+	b := s.s3.Bucket("bucket")
+	w := bufferAt("hello ")
+	etag, offset, err := b.ResumeDownload("name", &w, `"old"`, 6)
+	c.Assert(err, IsNil)
+	c.Assert(etag, Equals, `"new"`)
+	c.Assert(offset, Equals, int64(11))
+	c.Assert(string(w), Equals, "new content")
+
+	req := testServer.WaitRequest()
+	c.Assert(req.Header.Get("If-Match"), Equals, `"old"`)
+	c.Assert(req.Header.Get("Range"), Equals, "bytes=6-")
+	req = testServer.WaitRequest()
+	c.Assert(req.Header.Get("If-Match"), Equals, "")
+	c.Assert(req.Header.Get("Range"), Equals, "")
+}
+
+func (s *S) TestGetReaderIfRange(c *C) {
+	testServer.Response(206, map[string]string{"ETag": `"old"`}, "world")
+
+	b := s.s3.Bucket("bucket")
+	rc, etag, partial, err := b.GetReaderIfRange("name", `"old"`, s3.ObjectRange{Start: 6, End: 10})
+	c.Assert(err, IsNil)
+	data, err := ioutil.ReadAll(rc)
+	rc.Close()
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "world")
+	c.Assert(etag, Equals, `"old"`)
+	c.Assert(partial, Equals, true)
+
+	req := testServer.WaitRequest()
+	c.Assert(req.Header.Get("If-Range"), Equals, `"old"`)
+	c.Assert(req.Header.Get("Range"), Equals, "bytes=6-10")
+}
+
+func (s *S) TestGetReaderIfRangeChanged(c *C) {
+	testServer.Response(200, map[string]string{"ETag": `"new"`}, "new content")
+
+	b := s.s3.Bucket("bucket")
+	rc, etag, partial, err := b.GetReaderIfRange("name", `"old"`, s3.ObjectRange{Start: 6, End: -1})
+	c.Assert(err, IsNil)
+	data, err := ioutil.ReadAll(rc)
+	rc.Close()
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "new content")
+	c.Assert(etag, Equals, `"new"`)
+	c.Assert(partial, Equals, false)
+
+	req := testServer.WaitRequest()
+	c.Assert(req.Header.Get("If-Range"), Equals, `"old"`)
+	c.Assert(req.Header.Get("Range"), Equals, "bytes=6-")
+}
+
+var sseCustomerKey = []byte("0123456789abcdef0123456789abcdef")
+
+func (s *S) TestGetReaderSSECustomerKey(c *C) {
+	testServer.Response(200, nil, "content")
+
+	b := s.s3.Bucket("bucket")
+	rc, err := b.GetReaderWithOptions("name", s3.GetOptions{SSECustomerKey: sseCustomerKey})
+	c.Assert(err, IsNil)
+	c.Assert(readAll(rc), Equals, "content")
+	rc.Close()
+
+	req := testServer.WaitRequest()
+	c.Assert(req.Method, Equals, "GET")
+	c.Assert(req.Header["X-Amz-Server-Side-Encryption-Customer-Algorithm"], DeepEquals, []string{"AES256"})
+	c.Assert(req.Header["X-Amz-Server-Side-Encryption-Customer-Key"], DeepEquals, []string{"MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY="})
+	c.Assert(req.Header["X-Amz-Server-Side-Encryption-Customer-Key-Md5"], DeepEquals, []string{"hRasmdxgYDKV3nvbahU1MA=="})
+}
+
+func (s *S) TestInfoSSECustomerKey(c *C) {
+	testServer.Response(200, map[string]string{"Content-Length": "7"}, "")
+	testServer.Response(206, nil, "con")
+
+	b := s.s3.Bucket("bucket")
+	key, err := b.InfoWithOptions("name", s3.GetOptions{SSECustomerKey: sseCustomerKey})
+	c.Assert(err, IsNil)
+	c.Assert(key.Size, Equals, int64(7))
+	req := testServer.WaitRequest()
+	c.Assert(req.Method, Equals, "HEAD")
+	c.Assert(req.Header["X-Amz-Server-Side-Encryption-Customer-Algorithm"], DeepEquals, []string{"AES256"})
+	c.Assert(req.Header["X-Amz-Server-Side-Encryption-Customer-Key"], DeepEquals, []string{"MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY="})
+	c.Assert(req.Header["X-Amz-Server-Side-Encryption-Customer-Key-Md5"], DeepEquals, []string{"hRasmdxgYDKV3nvbahU1MA=="})
+
+	_, rc, err := b.GetInfoRangeReaderWithOptions("name", &s3.ObjectRange{Start: 0, End: 2}, s3.GetOptions{SSECustomerKey: sseCustomerKey})
+	c.Assert(err, IsNil)
+	c.Assert(readAll(rc), Equals, "con")
+	rc.Close()
+	req = testServer.WaitRequest()
+	c.Assert(req.Method, Equals, "GET")
+	c.Assert(req.Header.Get("Range"), Equals, "bytes=0-2")
+	c.Assert(req.Header["X-Amz-Server-Side-Encryption-Customer-Key"], DeepEquals, []string{"MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY="})
+
+	_, err = b.InfoWithOptions("name", s3.GetOptions{SSECustomerKey: []byte("short")})
+	c.Assert(err, ErrorMatches, `bad SSE-C key length: 5 bytes \(must be 32\)`)
+	_, _, err = b.GetInfoRangeReaderWithOptions("name", nil, s3.GetOptions{SSECustomerKey: []byte("short")})
+	c.Assert(err, ErrorMatches, `bad SSE-C key length: 5 bytes \(must be 32\)`)
+}
+
+func (s *S) TestGetReaderSSECustomerKeyLength(c *C) {
+	b := s.s3.Bucket("bucket")
+	_, err := b.GetReaderWithOptions("name", s3.GetOptions{SSECustomerKey: []byte("short")})
+	c.Assert(err, ErrorMatches, `bad SSE-C key length: 5 bytes \(must be 32\)`)
+}
+
+func (s *S) TestGetReaderRequireEncryption(c *C) {
+	headers := map[string]string{
+		"x-amz-server-side-encryption":                "aws:kms",
+		"x-amz-server-side-encryption-aws-kms-key-id": "arn:aws:kms:us-east-1:123456789012:key/example",
+	}
+	testServer.Response(200, headers, "content")
+	testServer.Response(200, headers, "")
+
+	b := s.s3.Bucket("bucket")
+	rc, err := b.GetReaderWithOptions("name", s3.GetOptions{RequireEncryption: true})
+	c.Assert(err, IsNil)
+	c.Assert(readAll(rc), Equals, "content")
+	rc.Close()
+	testServer.WaitRequest()
+
+	key, err := b.Info("name")
+	c.Assert(err, IsNil)
+	c.Assert(key.ServerSideEncryption, Equals, "aws:kms")
+	c.Assert(key.SSEKMSKeyID, Equals, "arn:aws:kms:us-east-1:123456789012:key/example")
+}
+
+func (s *S) TestGetReaderRequireEncryptionUnencrypted(c *C) {
+	testServer.Response(200, nil, "content")
+	testServer.Response(200, nil, "")
+
+	b := s.s3.Bucket("bucket")
+	_, err := b.GetReaderWithOptions("name", s3.GetOptions{RequireEncryption: true})
+	c.Assert(err, Equals, s3.ErrNotEncrypted)
+	testServer.WaitRequest()
+
+	key, err := b.Info("name")
+	c.Assert(err, IsNil)
+	c.Assert(key.ServerSideEncryption, Equals, "")
+	c.Assert(key.SSEKMSKeyID, Equals, "")
+}
+
+func (s *S) TestGetReaderVerifyLength(c *C) {
+	testServer.Response(200, nil, "content")
+	testServer.Response(200, map[string]string{"Content-Length": "10"}, "content")
+
+	b := s.s3.Bucket("bucket")
+	rc, err := b.GetReaderWithOptions("name", s3.GetOptions{VerifyLength: true})
+	c.Assert(err, IsNil)
+	c.Assert(readAll(rc), Equals, "content")
+	rc.Close()
+	testServer.WaitRequest()
+
+	rc, err = b.GetReaderWithOptions("name", s3.GetOptions{VerifyLength: true})
+	c.Assert(err, IsNil)
+	data, err := ioutil.ReadAll(rc)
+	c.Assert(err, Equals, s3.ErrShortBody)
+	c.Assert(string(data), Equals, "content")
+	rc.Close()
+	testServer.WaitRequest()
+}
+
+func gzipString(data string) string {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write([]byte(data))
+	zw.Close()
+	return buf.String()
+}
+
+func (s *S) TestGetReaderAcceptEncodingGzip(c *C) {
+	sent := gzipString("text content")
+	testServer.Responses(2, 200, map[string]string{"Content-Encoding": "gzip"}, sent)
+
+	b := s.s3.Bucket("bucket")
+	rc, err := b.GetReaderWithOptions("name", s3.GetOptions{AcceptEncoding: "gzip", VerifyLength: true})
+	c.Assert(err, IsNil)
+	c.Assert(readAll(rc), Equals, "text content")
+	c.Assert(rc.Close(), IsNil)
+	req := testServer.WaitRequest()
+	c.Assert(req.Header["Accept-Encoding"], DeepEquals, []string{"gzip"})
+
+	// Without gzip accepted, the body is read as sent.
+	rc, err = b.GetReaderWithOptions("name", s3.GetOptions{AcceptEncoding: "identity"})
+	c.Assert(err, IsNil)
+	c.Assert(readAll(rc), Equals, sent)
+	rc.Close()
+	req = testServer.WaitRequest()
+	c.Assert(req.Header["Accept-Encoding"], DeepEquals, []string{"identity"})
+}
+
+func (s *S) TestGetReaderAcceptEncodingStored(c *C) {
+	stored := gzipString("text content")
+	testServer.Response(200, map[string]string{"Content-Encoding": "gzip"}, stored)
+
+	// Objects stored gzip encoded may be read as stored.
+	b := s.s3.Bucket("bucket")
+	rc, err := b.GetReaderWithOptions("name", s3.GetOptions{AcceptEncoding: "gzip", KeepStoredEncoding: true})
+	c.Assert(err, IsNil)
+	c.Assert(readAll(rc), Equals, stored)
+	rc.Close()
+	testServer.WaitRequest()
+}
+
+func (s *S) TestGetReaderAcceptEncodingTransfer(c *C) {
+	stored := gzipString("text content")
+	sent := gzipString(stored)
+	testServer.Responses(3, 200, map[string]string{"Content-Encoding": "gzip, gzip"}, sent)
+
+	// The gzip coding applied in transit is decoded, not the stored one.
+	b := s.s3.Bucket("bucket")
+	rc, err := b.GetReaderWithOptions("name", s3.GetOptions{AcceptEncoding: "br, gzip;q=0.5"})
+	c.Assert(err, IsNil)
+	c.Assert(readAll(rc), Equals, stored)
+	rc.Close()
+	testServer.WaitRequest()
+
+	rc, err = b.GetReaderWithOptions("name", s3.GetOptions{AcceptEncoding: "gzip", KeepStoredEncoding: true})
+	c.Assert(err, IsNil)
+	c.Assert(readAll(rc), Equals, stored)
+	rc.Close()
+	testServer.WaitRequest()
+
+	// An encoding accepted with q=0 is refused.
+	rc, err = b.GetReaderWithOptions("name", s3.GetOptions{AcceptEncoding: "*, gzip;q=0"})
+	c.Assert(err, IsNil)
+	c.Assert(readAll(rc), Equals, sent)
+	rc.Close()
+	testServer.WaitRequest()
+}
+
+func (s *S) TestCRC64NVMEChecksum(c *C) {
+	checksum := s3.CRC64NVMEB64([]byte("content"))
+	testServer.Response(200, nil, "")
+	testServer.Responses(2, 200, map[string]string{"x-amz-checksum-crc64nvme": checksum}, "content")
+
+	b := s.s3.Bucket("bucket")
+	_, err := b.PutReaderWithOptions("name", strings.NewReader("content"), 7, "text/plain", s3.Private, "", "",
+		s3.Options{ChecksumCRC64NVME: checksum})
+	c.Assert(err, IsNil)
+	req := testServer.WaitRequest()
+	c.Assert(req.Header.Get("x-amz-checksum-crc64nvme"), Equals, checksum)
+
+	rc, err := b.GetReaderWithOptions("name", s3.GetOptions{ChecksumMode: true})
+	c.Assert(err, IsNil)
+	rc.Close()
+	req = testServer.WaitRequest()
+	c.Assert(req.Header.Get("x-amz-checksum-mode"), Equals, "ENABLED")
+
+	key, rc, err := b.GetInfoRangeReader("name", nil)
+	c.Assert(err, IsNil)
+	rc.Close()
+	c.Assert(key.ChecksumCRC64NVME, Equals, checksum)
+}
+
 func (s *S) TestGetNotFound(c *C) {
 	for i := 0; i < 10; i++ {
 		testServer.Response(404, nil, GetObjectErrorDump)
@@ -155,6 +575,138 @@ func (s *S) TestGetNotFound(c *C) {
 	c.Assert(data, IsNil)
 }
 
+func (s *S) TestGetNonXMLError(c *C) {
+	body := "<html><head><title>503 Service Unavailable</title></head>" +
+		"<body>" + strings.Repeat("Try again later. ", 100) + "</body></html>"
+	testServer.Response(503, map[string]string{
+		"Content-Type":     "text/html",
+		"Retry-After":      "5",
+		"x-amz-request-id": "REQ123",
+		"X-Unrelated":      "ignored",
+	}, body)
+
+	b := s.s3.Bucket("bucket")
+	_, err := b.Get("name")
+	testServer.WaitRequest()
+
+	s3err, _ := err.(*s3.Error)
+	c.Assert(s3err, NotNil)
+	c.Assert(s3err.StatusCode, Equals, 503)
+	c.Assert(s3err.Status, Equals, "503 Service Unavailable")
+	c.Assert(s3err.Code, Equals, "")
+	c.Assert(s3err.Message, Equals, "503 Service Unavailable")
+	c.Assert(s3err.RequestId, Equals, "REQ123")
+	c.Assert(s3err.Header.Get("Content-Type"), Equals, "text/html")
+	c.Assert(s3err.Header.Get("Retry-After"), Equals, "5")
+	c.Assert(s3err.Header.Get("X-Unrelated"), Equals, "")
+	c.Assert(s3err.Body, Equals, body[:512])
+}
+
+func (s *S) TestGetErrorKeepsStatus(c *C) {
+	for i := 0; i < 10; i++ {
+		testServer.Response(404, nil, GetObjectErrorDump)
+	}
+
+	b := s.s3.Bucket("non-existent-bucket")
+	_, err := b.Get("non-existent")
+	testServer.WaitRequest()
+
+	s3err, _ := err.(*s3.Error)
+	c.Assert(s3err, NotNil)
+	c.Assert(s3err.Status, Equals, "404 Not Found")
+	c.Assert(s3err.Code, Equals, "NoSuchBucket")
+	c.Assert(s3err.Body, Equals, "")
+}
+
+func (s *S) TestErrorIs(c *C) {
+	tests := []struct {
+		status int
+		dump   string
+		target error
+	}{
+		{404, NoSuchKeyErrorDump, s3.ErrNoSuchKey},
+		{404, GetObjectErrorDump, s3.ErrNoSuchBucket},
+		{403, AccessDeniedErrorDump, s3.ErrAccessDenied},
+		{404, NoSuchUploadErrorDump, s3.ErrNoSuchUpload},
+		{500, InternalErrorDump, nil},
+	}
+	b := s.s3.Bucket("bucket")
+	for _, t := range tests {
+		// Some of the codes are retried.
+		testServer.Responses(10, t.status, nil, t.dump)
+		_, err := b.Get("name")
+		c.Assert(err, NotNil)
+		testServer.Flush()
+
+		for _, target := range []error{s3.ErrNoSuchKey, s3.ErrNoSuchBucket, s3.ErrAccessDenied, s3.ErrNoSuchUpload} {
+			c.Assert(errors.Is(err, target), Equals, target == t.target, Commentf("%v is %v", err, target))
+		}
+	}
+}
+
+func (s *S) TestGetObjectAttributes(c *C) {
+	testServer.Response(200, nil, GetObjectAttributesDump)
+
+	b := s.s3.Bucket("bucket")
+	attrs, err := b.GetObjectAttributes("name", []string{s3.AttrETag, s3.AttrObjectParts})
+	c.Assert(err, IsNil)
+
+	req := testServer.WaitRequest()
+	c.Assert(req.Method, Equals, "GET")
+	c.Assert(req.URL.Path, Equals, "/bucket/name")
+	c.Assert(req.Form["attributes"], DeepEquals, []string{""})
+	c.Assert(req.Header["X-Amz-Object-Attributes"], DeepEquals, []string{"ETag,ObjectParts"})
+
+	c.Assert(attrs.ETag, Equals, "d41d8cd98f00b204e9800998ecf8427e-2")
+	c.Assert(attrs.ObjectParts.PartsCount, Equals, 2)
+	c.Assert(attrs.ObjectParts.IsTruncated, Equals, false)
+	c.Assert(attrs.ObjectParts.Parts, HasLen, 2)
+	c.Assert(attrs.ObjectParts.Parts[0].PartNumber, Equals, 1)
+	c.Assert(attrs.ObjectParts.Parts[0].Size, Equals, int64(5242880))
+	c.Assert(attrs.ObjectParts.Parts[0].ChecksumCRC32C, Equals, "3S1Zxw==")
+	c.Assert(attrs.ObjectParts.Parts[1].PartNumber, Equals, 2)
+	c.Assert(attrs.ObjectParts.Parts[1].Size, Equals, int64(1024))
+	c.Assert(attrs.StorageClass, Equals, "")
+}
+
+func (s *S) TestMatchesMD5(c *C) {
+	headers := map[string]string{"ETag": `"9a0364b9e99bb480dd25e1f0284c8555"`}
+	testServer.Response(200, headers, "")
+	testServer.Response(200, headers, "")
+
+	b := s.s3.Bucket("bucket")
+	ok, err := b.MatchesMD5("name", "9a0364b9e99bb480dd25e1f0284c8555")
+	c.Assert(err, IsNil)
+	c.Assert(ok, Equals, true)
+
+	req := testServer.WaitRequest()
+	c.Assert(req.Method, Equals, "HEAD")
+	c.Assert(req.URL.Path, Equals, "/bucket/name")
+
+	ok, err = b.MatchesMD5("name", "d41d8cd98f00b204e9800998ecf8427e")
+	c.Assert(err, IsNil)
+	c.Assert(ok, Equals, false)
+}
+
+func (s *S) TestMatchesMD5Multipart(c *C) {
+	headers := map[string]string{"ETag": `"9a0364b9e99bb480dd25e1f0284c8555-2"`}
+	testServer.Response(200, headers, "")
+
+	b := s.s3.Bucket("bucket")
+	ok, err := b.MatchesMD5("name", "9a0364b9e99bb480dd25e1f0284c8555")
+	c.Assert(err, IsNil)
+	c.Assert(ok, Equals, false)
+}
+
+func (s *S) TestMatchesMD5NotFound(c *C) {
+	testServer.Response(404, nil, "")
+
+	b := s.s3.Bucket("bucket")
+	ok, err := b.MatchesMD5("name", "9a0364b9e99bb480dd25e1f0284c8555")
+	c.Assert(err, IsNil)
+	c.Assert(ok, Equals, false)
+}
+
 // PutObject docs: http://goo.gl/FEBPD
 
 func (s *S) TestPutObject(c *C) {
@@ -200,27 +752,1043 @@ func (s *S) TestPutReader(c *C) {
 	c.Assert(req.Header["X-Amz-Acl"], DeepEquals, []string{"private"})
 }
 
-// DelObject docs: http://goo.gl/APeTt
-
-func (s *S) TestDelObject(c *C) {
+func (s *S) TestPutBadDigestRetried(c *C) {
+	testServer.Response(400, nil, BadDigestErrorDump)
 	testServer.Response(200, nil, "")
 
 	b := s.s3.Bucket("bucket")
-	err := b.Del("name")
+	err := b.Put("name", []byte("content"), "text/plain", s3.Private)
 	c.Assert(err, IsNil)
 
-	req := testServer.WaitRequest()
-	c.Assert(req.Method, Equals, "DELETE")
-	c.Assert(req.URL.Path, Equals, "/bucket/name")
-	c.Assert(req.Header["Date"], Not(Equals), "")
+	for _, req := range testServer.WaitRequests(2) {
+		c.Assert(req.Method, Equals, "PUT")
+		c.Assert(readAll(req.Body), Equals, "content")
+	}
 }
 
-// Bucket List Objects docs: http://goo.gl/YjQTc
+func (s *S) TestPutReaderBadDigestTwice(c *C) {
+	testServer.Responses(2, 400, nil, BadDigestErrorDump)
 
-func (s *S) TestList(c *C) {
-	testServer.Response(200, nil, GetListResultDump1)
+	b := s.s3.Bucket("bucket")
+	payload := []byte("content")
+	r := bytes.NewReader(payload)
+	r.Seek(2, io.SeekStart)
+	err := b.PutReader("name", r, 5, "text/plain", s3.Private, s3.MD5B64(payload[2:]), "")
+	c.Assert(err, ErrorMatches, "The Content-MD5 you specified did not match what we received.")
 
-	b := s.s3.Bucket("quotes")
+	// The body is sent again from where it started.
+	for _, req := range testServer.WaitRequests(2) {
+		c.Assert(readAll(req.Body), Equals, "ntent")
+	}
+}
+
+func (s *S) TestPutReaderBadDigestUnseekable(c *C) {
+	testServer.Response(400, nil, BadDigestErrorDump)
+
+	b := s.s3.Bucket("bucket")
+	err := b.PutReader("name", onlyReader{strings.NewReader("content")}, 7, "text/plain", s3.Private, "", "")
+	c.Assert(err, ErrorMatches, "The Content-MD5 you specified did not match what we received.")
+	testServer.WaitRequest()
+}
+
+func (s *S) TestPutReaderIfNoneMatch(c *C) {
+	testServer.Response(200, nil, "")
+	testServer.Response(412, nil, PreconditionFailedDump)
+
+	b := s.s3.Bucket("bucket")
+	payload := []byte("content")
+	options := s3.Options{IfNoneMatch: true}
+	put := func() error {
+		_, err := b.PutReaderWithOptions(
+			"name",
+			bytes.NewReader(payload),
+			int64(len(payload)),
+			"content-type",
+			s3.Private,
+			s3.MD5B64(payload),
+			s3.SHA256Hex(payload),
+			options,
+		)
+		return err
+	}
+
+	err := put()
+	c.Assert(err, IsNil)
+
+	req := testServer.WaitRequest()
+	c.Assert(req.Method, Equals, "PUT")
+	c.Assert(req.Header["If-None-Match"], DeepEquals, []string{"*"})
+
+	err = put()
+	c.Assert(err, Equals, s3.ErrObjectExists)
+
+	req = testServer.WaitRequest()
+	c.Assert(req.Header["If-None-Match"], DeepEquals, []string{"*"})
+}
+
+func (s *S) TestPutReaderIdempotencyKey(c *C) {
+	// The first attempt is stored, but its response is lost.
+	testServer.Response(500, nil, InternalErrorDump)
+	// The retry finds the object written by the first attempt.
+	testServer.Response(412, nil, PreconditionFailedDump)
+	testServer.Response(200, map[string]string{
+		"ETag":                             `"9a0364b9e99bb480dd25e1f0284c8555"`,
+		"x-amz-meta-goamz-idempotency-key": "upload-1",
+	}, "")
+	// Another upload finds an object written by someone else.
+	testServer.Response(412, nil, PreconditionFailedDump)
+	testServer.Response(200, map[string]string{
+		"ETag":                             `"9a0364b9e99bb480dd25e1f0284c8555"`,
+		"x-amz-meta-goamz-idempotency-key": "upload-1",
+	}, "")
+
+	b := s.s3.Bucket("bucket")
+	put := func(idempotencyKey string) (*s3.WriteResult, error) {
+		return b.PutReaderWithOptions("name", strings.NewReader("content"), 7, "text/plain", s3.Private, "", "",
+			s3.Options{IdempotencyKey: idempotencyKey})
+	}
+
+	_, err := put("upload-1")
+	c.Assert(err, ErrorMatches, "Not relevant")
+	req := testServer.WaitRequest()
+	c.Assert(req.Method, Equals, "PUT")
+	c.Assert(req.Header["If-None-Match"], DeepEquals, []string{"*"})
+	c.Assert(req.Header["X-Amz-Meta-Goamz-Idempotency-Key"], DeepEquals, []string{"upload-1"})
+
+	result, err := put("upload-1")
+	c.Assert(err, IsNil)
+	c.Assert(result.ETag, Equals, `"9a0364b9e99bb480dd25e1f0284c8555"`)
+	reqs := testServer.WaitRequests(2)
+	c.Assert(reqs[0].Method, Equals, "PUT")
+	c.Assert(reqs[1].Method, Equals, "HEAD")
+	c.Assert(reqs[1].URL.Path, Equals, "/bucket/name")
+
+	_, err = put("upload-2")
+	c.Assert(err, Equals, s3.ErrObjectExists)
+	testServer.WaitRequests(2)
+}
+
+// onlyReader hides any methods of the reader beyond Read, making it
+// unseekable.
+type onlyReader struct {
+	io.Reader
+}
+
+func (s *S) TestPutStream(c *C) {
+	testServer.Response(200, nil, "")
+
+	client, _ := s.v4Client()
+	b := client.Bucket("bucket")
+	_, err := b.PutStream("name", onlyReader{strings.NewReader("content")}, 7, "text/plain", s3.Private, s3.Options{})
+	c.Assert(err, IsNil)
+
+	req := testServer.WaitRequest()
+	c.Assert(req.Method, Equals, "PUT")
+	c.Assert(req.ContentLength, Equals, int64(7))
+	c.Assert(req.Header.Get("x-amz-content-sha256"), Equals, "UNSIGNED-PAYLOAD")
+	c.Assert(readAll(req.Body), Equals, "content")
+}
+
+func (s *LocalBucketSuite) TestDoubleSlashKey(c *C) {
+	region := s.srv.region
+	region.S3V4Signature = true
+	b := s3.New(s.srv.auth, region).Bucket("bucket")
+	c.Assert(b.Put("a//b", []byte("double"), "text/plain", s3.Private), IsNil)
+	c.Assert(b.Put("a/b", []byte("single"), "text/plain", s3.Private), IsNil)
+
+	data, err := b.Get("a//b")
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "double")
+	data, err = b.Get("a/b")
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "single")
+}
+
+func (s *S) TestDoubleSlashKeySignature(c *C) {
+	testServer.Response(200, nil, "content")
+
+	client, _ := s.v4Client()
+	_, err := client.Bucket("bucket").Get("a//./b")
+	c.Assert(err, IsNil)
+	req := testServer.WaitRequest()
+	c.Assert(req.URL.Path, Equals, "/bucket/a//./b")
+
+	// The path is signed as sent, as S3 expects.
+	hreq, err := http.NewRequest("GET", testServer.URL+"/bucket/a//./b", nil)
+	c.Assert(err, IsNil)
+	for _, name := range []string{"X-Amz-Date", "X-Amz-Content-Sha256", "Date"} {
+		hreq.Header[name] = req.Header[name]
+	}
+	signer := s3.NewV4Signer(s.s3.Auth, "s3", aws.Region{Name: "faux-region-1"})
+	c.Assert(signer.Sign(hreq, req.Header.Get("X-Amz-Content-Sha256")), IsNil)
+	c.Assert(hreq.Header.Get("Authorization"), Equals, req.Header.Get("Authorization"))
+
+	creq, err := s3.CanonicalRequest("GET", "https://bucket.s3.amazonaws.com/a//./b", nil, "")
+	c.Assert(err, IsNil)
+	c.Assert(strings.Split(creq, "\n")[1], Equals, "/a//./b")
+}
+
+func (s *LocalBucketSuite) TestPutStreamBadLength(c *C) {
+	b := s.b
+
+	_, err := b.PutStream("name", onlyReader{strings.NewReader("short")}, 7, "text/plain", s3.Private, s3.Options{})
+	c.Assert(err, ErrorMatches, "s3: short read: got 5 bytes, expected 7")
+	_, err = b.PutStream("name", onlyReader{strings.NewReader("too long")}, 7, "text/plain", s3.Private, s3.Options{})
+	c.Assert(err, ErrorMatches, "s3: long read: got more than 7 bytes")
+
+	_, err = b.Get("name")
+	c.Assert(err, ErrorMatches, "The specified key does not exist.")
+}
+
+func (s *S) TestPutEmpty(c *C) {
+	testServer.Responses(2, 200, nil, "")
+
+	client, _ := s.v4Client()
+	b := client.Bucket("bucket")
+	err := b.PutEmpty("folder/", "", s3.Private)
+	c.Assert(err, IsNil)
+
+	req := testServer.WaitRequest()
+	c.Assert(req.Method, Equals, "PUT")
+	c.Assert(req.URL.Path, Equals, "/bucket/folder/")
+	c.Assert(req.ContentLength, Equals, int64(0))
+	c.Assert(req.TransferEncoding, HasLen, 0)
+	c.Assert(req.Header["Content-Length"], DeepEquals, []string{"0"})
+	c.Assert(req.Header["Content-Type"], DeepEquals, []string{"binary/octet-stream"})
+	c.Assert(req.Header["X-Amz-Content-Sha256"], DeepEquals, []string{s3.EmptyStringSHA256Hex})
+
+	err = b.PutEmpty("folder/", "application/x-directory", s3.Private)
+	c.Assert(err, IsNil)
+
+	req = testServer.WaitRequest()
+	c.Assert(req.Header["Content-Type"], DeepEquals, []string{"application/x-directory"})
+}
+
+func (s *S) TestAppendObject(c *C) {
+	testServer.Response(200, map[string]string{"x-amz-object-size": "12"}, "")
+	testServer.Response(200, nil, "")
+
+	client := s3.New(s.s3.Auth, s.s3.Region)
+	b := client.Bucket("bucket")
+	_, err := b.AppendObject("name", 5, strings.NewReader("content"))
+	c.Assert(err, Equals, s3.ErrAppendNotSupported)
+
+	client.AppendSupported = true
+	size, err := b.AppendObject("name", 5, strings.NewReader("content"))
+	c.Assert(err, IsNil)
+	c.Assert(size, Equals, int64(12))
+
+	req := testServer.WaitRequest()
+	c.Assert(req.Method, Equals, "PUT")
+	c.Assert(req.URL.Path, Equals, "/bucket/name")
+	c.Assert(req.Header["X-Amz-Write-Offset-Bytes"], DeepEquals, []string{"5"})
+	c.Assert(req.Header["Content-Length"], DeepEquals, []string{"7"})
+	data, err := ioutil.ReadAll(req.Body)
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "content")
+
+	// Without a reported size, it's derived from the offset.
+	size, err = b.AppendObject("name", 12, strings.NewReader("more"))
+	c.Assert(err, IsNil)
+	c.Assert(size, Equals, int64(16))
+
+	req = testServer.WaitRequest()
+	c.Assert(req.Header["X-Amz-Write-Offset-Bytes"], DeepEquals, []string{"12"})
+}
+
+func (s *S) TestPutRange(c *C) {
+	// The fake store writes ranges that start within the object.
+	var object []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var first, last int64
+		_, err := fmt.Sscanf(r.Header.Get("Content-Range"), "bytes %d-%d/*", &first, &last)
+		data, _ := ioutil.ReadAll(r.Body)
+		if err != nil || first > int64(len(object)) || last-first+1 != int64(len(data)) {
+			w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+			return
+		}
+		object = append(object[:first], append(data, object[min(last+1, int64(len(object))):]...)...)
+		w.Header().Set("x-amz-object-size", strconv.Itoa(len(object)))
+	}))
+	defer srv.Close()
+
+	client := s3.New(s.s3.Auth, aws.Region{Name: "faux-region-1", S3Endpoint: srv.URL})
+	b := client.Bucket("bucket")
+	err := b.PutRange("name", 0, strings.NewReader("hello world"))
+	c.Assert(err, Equals, s3.ErrRangedPutNotSupported)
+
+	client.RangedPutSupported = true
+	err = b.PutRange("name", 0, strings.NewReader("hello world"))
+	c.Assert(err, IsNil)
+	err = b.PutRange("name", 6, strings.NewReader("WORLD"))
+	c.Assert(err, IsNil)
+	c.Assert(string(object), Equals, "hello WORLD")
+
+	err = b.PutRange("name", 20, strings.NewReader("!"))
+	c.Assert(err, ErrorMatches, "416 Requested Range Not Satisfiable")
+	c.Assert(string(object), Equals, "hello WORLD")
+}
+
+func (s *S) TestMetaRoundTrip(c *C) {
+	testServer.Response(200, nil, "")
+	testServer.Response(200, map[string]string{
+		"x-amz-meta-foo-Bar": "value",
+		"X-AMZ-META-LOWER":   "other",
+	}, "")
+
+	b := s.s3.Bucket("bucket")
+	payload := []byte("content")
+	_, err := b.PutReaderWithOptions("name", bytes.NewReader(payload), int64(len(payload)),
+		"text/plain", s3.Private, s3.MD5B64(payload), s3.SHA256Hex(payload),
+		s3.Options{Meta: map[string][]string{"foo-Bar": {"value"}, "lower": {"other"}}})
+	c.Assert(err, IsNil)
+
+	req := testServer.WaitRequest()
+	c.Assert(req.Header["X-Amz-Meta-Foo-Bar"], DeepEquals, []string{"value"})
+	c.Assert(req.Header["X-Amz-Meta-Lower"], DeepEquals, []string{"other"})
+
+	key, err := b.Info("name")
+	c.Assert(err, IsNil)
+	c.Assert(key.Meta, DeepEquals, map[string][]string{
+		"foo-bar": {"value"},
+		"lower":   {"other"},
+	})
+}
+
+func (s *S) TestParseMeta(c *C) {
+	meta := s3.ParseMeta(http.Header{
+		"X-Amz-Meta-Foo-Bar": {"a"},
+		"x-amz-meta-foo-bar": {"b"},
+		"X-Amz-Meta-":        {"ignored"},
+		"Content-Type":       {"text/plain"},
+	})
+	c.Assert(meta["foo-bar"], HasLen, 2)
+	c.Assert(meta, HasLen, 1)
+	c.Assert(s3.ParseMeta(http.Header{"Content-Type": {"text/plain"}}), IsNil)
+}
+
+func (s *S) TestRequestCharged(c *C) {
+	charged := map[string]string{"x-amz-request-charged": "requester"}
+	testServer.Response(200, charged, "")
+	testServer.Response(200, nil, "")
+	testServer.Response(404, charged, GetObjectErrorDump)
+
+	client := s3.New(s.s3.Auth, s.s3.Region)
+	var paths []string
+	client.OnRequestCharged = func(resp *http.Response) {
+		paths = append(paths, resp.Request.URL.Path)
+	}
+	b := client.Bucket("bucket")
+
+	key, err := b.Info("charged")
+	c.Assert(err, IsNil)
+	c.Assert(key.RequestCharged, Equals, true)
+
+	key, err = b.Info("free")
+	c.Assert(err, IsNil)
+	c.Assert(key.RequestCharged, Equals, false)
+
+	_, err = b.Info("missing")
+	c.Assert(err, NotNil)
+
+	c.Assert(paths, DeepEquals, []string{"/bucket/charged", "/bucket/missing"})
+}
+
+func (s *S) TestRetryDNSErrors(c *C) {
+	wrap := func(err *net.DNSError) error {
+		return &url.Error{Op: "Get", URL: "https://bucket.s3.example.com/", Err: &net.OpError{Op: "dial", Net: "tcp", Err: err}}
+	}
+	notFound := &net.DNSError{Err: "no such host", Name: "bucket.s3.example.com", IsNotFound: true}
+	timeout := &net.DNSError{Err: "i/o timeout", Name: "bucket.s3.example.com", IsTimeout: true, IsTemporary: true}
+	misbehaving := &net.DNSError{Err: "server misbehaving", Name: "bucket.s3.example.com", IsTemporary: true}
+
+	c.Assert(s3.ShouldRetry(notFound), Equals, false)
+	c.Assert(s3.ShouldRetry(wrap(notFound)), Equals, false)
+	c.Assert(s3.ShouldRetry(timeout), Equals, true)
+	c.Assert(s3.ShouldRetry(wrap(timeout)), Equals, true)
+	c.Assert(s3.ShouldRetry(wrap(misbehaving)), Equals, true)
+
+	s3.RetryDNSNotFound(true)
+	defer s3.RetryDNSNotFound(false)
+	c.Assert(s3.ShouldRetry(wrap(notFound)), Equals, true)
+}
+
+func (s *S) TestNoRedirects(c *C) {
+	testServer.Response(307, map[string]string{
+		"Location":            "https://bucket.s3-eu-west-1.amazonaws.com/name",
+		"x-amz-bucket-region": "eu-west-1",
+	}, TemporaryRedirectDump)
+
+	client := s3.New(s.s3.Auth, s.s3.Region)
+	client.NoRedirects = true
+	_, err := client.Bucket("bucket").Get("name")
+
+	rerr, ok := err.(*s3.RedirectError)
+	c.Assert(ok, Equals, true, Commentf("%#v", err))
+	c.Assert(rerr.StatusCode, Equals, 307)
+	c.Assert(rerr.Code, Equals, "TemporaryRedirect")
+	c.Assert(rerr.Location, Equals, "https://bucket.s3-eu-west-1.amazonaws.com/name")
+	c.Assert(rerr.Region, Equals, "eu-west-1")
+	c.Assert(err, ErrorMatches, `s3: redirect: Please re-send .* \(location https://bucket.s3-eu-west-1.amazonaws.com/name\) \(bucket region eu-west-1\)`)
+
+	testServer.WaitRequest()
+}
+
+func (s *S) TestHeadBucket(c *C) {
+	testServer.Response(200, nil, "")
+	testServer.Response(404, nil, "")
+	testServer.Response(403, map[string]string{"x-amz-bucket-region": "eu-west-1"}, "")
+	defer s.s3.ClearBucketRegions()
+
+	b := s.s3.Bucket("bucket")
+	err := b.HeadBucket()
+	c.Assert(err, IsNil)
+	req := testServer.WaitRequest()
+	c.Assert(req.Method, Equals, "HEAD")
+	c.Assert(req.URL.Path, Equals, "/bucket/")
+
+	err = b.HeadBucket()
+	c.Assert(errors.Is(err, s3.ErrNoSuchBucket), Equals, true)
+	c.Assert(err.(*s3.Error).StatusCode, Equals, 404)
+	testServer.WaitRequest()
+
+	err = b.HeadBucket()
+	c.Assert(errors.Is(err, s3.ErrAccessDenied), Equals, true)
+	c.Assert(err.(*s3.Error).Header.Get("x-amz-bucket-region"), Equals, "eu-west-1")
+	testServer.WaitRequest()
+}
+
+func (s *S) TestWithAttempts(c *C) {
+	testServer.Response(500, nil, InternalErrorDump)
+	testServer.Response(500, nil, InternalErrorDump)
+	testServer.Response(200, nil, "content")
+
+	b := s.s3.Bucket("bucket")
+	fast := b.WithAttempts(aws.AttemptStrategy{})
+	c.Assert(fast.Name, Equals, "bucket")
+	c.Assert(b.Attempts, IsNil)
+
+	// The request through fast is not retried.
+	_, err := fast.Get("name")
+	c.Assert(err, ErrorMatches, "Not relevant")
+	testServer.WaitRequest()
+
+	// The one through b is.
+	data, err := b.Get("name")
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "content")
+	testServer.WaitRequests(2)
+}
+
+func (s *S) TestInfoPartsCount(c *C) {
+	testServer.Response(200, map[string]string{
+		"ETag":                 `"d41d8cd98f00b204e9800998ecf8427e-3"`,
+		"x-amz-mp-parts-count": "3",
+	}, "")
+	testServer.Response(200, nil, "")
+
+	b := s.s3.Bucket("bucket")
+	key, err := b.Info("multi")
+	c.Assert(err, IsNil)
+	c.Assert(key.PartsCount, Equals, 3)
+
+	key, err = b.Info("single")
+	c.Assert(err, IsNil)
+	c.Assert(key.PartsCount, Equals, 0)
+}
+
+func (s *S) TestInfoExpiration(c *C) {
+	testServer.Response(200, map[string]string{
+		"x-amz-expiration": `expiry-date="Fri, 23 Dec 2012 00:00:00 GMT", rule-id="picture-deletion-rule"`,
+	}, "")
+
+	b := s.s3.Bucket("bucket")
+	key, err := b.Info("name")
+	c.Assert(err, IsNil)
+	c.Assert(key.ExpiryDate.Equal(time.Date(2012, 12, 23, 0, 0, 0, 0, time.UTC)), Equals, true)
+	c.Assert(key.ExpiryRuleID, Equals, "picture-deletion-rule")
+}
+
+func (s *S) TestParseExpiration(c *C) {
+	expiry, ruleID, err := s3.ParseExpiration(`rule-id="a, b", expiry-date="Mon, 02 Jan 2006 00:00:00 GMT"`)
+	c.Assert(err, IsNil)
+	c.Assert(expiry.Equal(time.Date(2006, 1, 2, 0, 0, 0, 0, time.UTC)), Equals, true)
+	c.Assert(ruleID, Equals, "a, b")
+
+	for _, value := range []string{
+		"",
+		`rule-id="rule"`,
+		`expiry-date="tomorrow", rule-id="rule"`,
+		`expiry-date="Mon, 02 Jan 2006 00:00:00 GMT`,
+	} {
+		_, _, err := s3.ParseExpiration(value)
+		c.Assert(err, ErrorMatches, "bad x-amz-expiration header: .*", Commentf("%q", value))
+	}
+}
+
+func (s *S) TestCopy(c *C) {
+	testServer.Response(200, nil, CopyObjectResultDump)
+
+	b := s.s3.Bucket("bucket")
+	result, err := b.Copy("old dir/name", "new/name", s3.Private, s3.CopyOptions{})
+	c.Assert(err, IsNil)
+	c.Assert(result.ETag, Equals, `"9b2cf535f27731c974343645a3985328"`)
+	c.Assert(result.LastModified, Equals, "2009-10-28T22:32:00.000Z")
+
+	req := testServer.WaitRequest()
+	c.Assert(req.Method, Equals, "PUT")
+	c.Assert(req.URL.Path, Equals, "/bucket/new/name")
+	c.Assert(req.Header["X-Amz-Copy-Source"], DeepEquals, []string{"/bucket/old%20dir/name"})
+	c.Assert(req.Header["X-Amz-Acl"], DeepEquals, []string{"private"})
+	c.Assert(req.Header["X-Amz-Tagging-Directive"], IsNil)
+	c.Assert(req.Header["X-Amz-Tagging"], IsNil)
+}
+
+func (s *S) TestUpdateMetadata(c *C) {
+	testServer.Response(200, map[string]string{
+		"ETag":                `"9b2cf535f27731c974343645a3985328"`,
+		"Content-Type":        "image/png",
+		"x-amz-storage-class": "STANDARD_IA",
+		"x-amz-meta-old":      "value",
+	}, "")
+	testServer.Response(200, nil, CopyObjectResultDump)
+
+	b := s.s3.Bucket("bucket")
+	err := b.UpdateMetadata("dir/a b.png", map[string]string{"Owner": "alice"}, "", "")
+	c.Assert(err, IsNil)
+
+	req := testServer.WaitRequest()
+	c.Assert(req.Method, Equals, "HEAD")
+	req = testServer.WaitRequest()
+	c.Assert(req.Method, Equals, "PUT")
+	c.Assert(req.URL.Path, Equals, "/bucket/dir/a b.png")
+	c.Assert(req.Header.Get("x-amz-copy-source"), Equals, "/bucket/dir/a%20b.png")
+	c.Assert(req.Header.Get("x-amz-copy-source-if-match"), Equals, `"9b2cf535f27731c974343645a3985328"`)
+	c.Assert(req.Header.Get("x-amz-metadata-directive"), Equals, "REPLACE")
+	c.Assert(req.Header.Get("Content-Type"), Equals, "image/png")
+	c.Assert(req.Header.Get("x-amz-storage-class"), Equals, "STANDARD_IA")
+	c.Assert(req.Header["X-Amz-Meta-Owner"], DeepEquals, []string{"alice"})
+	c.Assert(req.Header["X-Amz-Meta-Old"], IsNil)
+}
+
+func (s *S) TestUpdateMetadataStorageClass(c *C) {
+	testServer.Response(200, map[string]string{"ETag": `"etag"`, "Content-Type": "text/plain"}, "")
+	testServer.Response(200, nil, CopyObjectResultDump)
+
+	b := s.s3.Bucket("bucket")
+	err := b.UpdateMetadata("name", nil, "text/csv", "GLACIER")
+	c.Assert(err, IsNil)
+
+	testServer.WaitRequest()
+	req := testServer.WaitRequest()
+	c.Assert(req.Header.Get("x-amz-copy-source"), Equals, "/bucket/name")
+	c.Assert(req.Header.Get("x-amz-metadata-directive"), Equals, "REPLACE")
+	c.Assert(req.Header.Get("Content-Type"), Equals, "text/csv")
+	c.Assert(req.Header.Get("x-amz-storage-class"), Equals, "GLACIER")
+}
+
+func (s *S) TestUpdateMetadataKeepsHeaders(c *C) {
+	testServer.Response(200, map[string]string{
+		"ETag":                         `"etag"`,
+		"Content-Type":                 "text/plain",
+		"Cache-Control":                "max-age=3600",
+		"Content-Encoding":             "gzip",
+		"Content-Disposition":          `attachment; filename="a.txt"`,
+		"x-amz-server-side-encryption": "aws:kms",
+		"x-amz-server-side-encryption-aws-kms-key-id": "arn:aws:kms:us-east-1:123456789012:key/abcd",
+	}, "")
+	testServer.Response(200, nil, CopyObjectResultDump)
+
+	b := s.s3.Bucket("bucket")
+	err := b.UpdateMetadata("name", map[string]string{"owner": "alice"}, "", "")
+	c.Assert(err, IsNil)
+
+	testServer.WaitRequest()
+	req := testServer.WaitRequest()
+	c.Assert(req.Header.Get("Cache-Control"), Equals, "max-age=3600")
+	c.Assert(req.Header.Get("Content-Encoding"), Equals, "gzip")
+	c.Assert(req.Header.Get("Content-Disposition"), Equals, `attachment; filename="a.txt"`)
+	c.Assert(req.Header["Content-Language"], IsNil)
+	c.Assert(req.Header.Get("x-amz-server-side-encryption"), Equals, "aws:kms")
+	c.Assert(req.Header.Get("x-amz-server-side-encryption-aws-kms-key-id"), Equals, "arn:aws:kms:us-east-1:123456789012:key/abcd")
+}
+
+func (s *S) TestUpdateMetadataSSECustomerKey(c *C) {
+	testServer.Response(200, map[string]string{"ETag": `"etag"`}, "")
+	testServer.Response(200, nil, CopyObjectResultDump)
+
+	b := s.s3.Bucket("bucket")
+	err := b.UpdateMetadataWithOptions("name", nil, "", "", s3.UpdateOptions{SSECustomerKey: sseCustomerKey})
+	c.Assert(err, IsNil)
+
+	req := testServer.WaitRequest()
+	c.Assert(req.Method, Equals, "HEAD")
+	c.Assert(req.Header["X-Amz-Server-Side-Encryption-Customer-Key"], DeepEquals, []string{"MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY="})
+	req = testServer.WaitRequest()
+	c.Assert(req.Method, Equals, "PUT")
+	c.Assert(req.Header["X-Amz-Copy-Source-Server-Side-Encryption-Customer-Key"], DeepEquals, []string{"MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY="})
+	c.Assert(req.Header["X-Amz-Server-Side-Encryption-Customer-Key"], DeepEquals, []string{"MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY="})
+}
+
+func (s *S) TestTouch(c *C) {
+	testServer.Response(200, map[string]string{
+		"ETag":                     `"9b2cf535f27731c974343645a3985328"`,
+		"Content-Type":             "image/png",
+		"x-amz-meta-old":           "value",
+		"x-amz-meta-goamz-touched": "2020-01-01T00:00:00Z",
+	}, "")
+	testServer.Response(200, nil, CopyObjectResultDump)
+
+	client := s3.New(s.s3.Auth, s.s3.Region)
+	s3.SetClock(client, func() time.Time { return time.Date(2021, 2, 3, 4, 5, 6, 0, time.UTC) })
+	err := client.Bucket("bucket").Touch("name")
+	c.Assert(err, IsNil)
+
+	req := testServer.WaitRequest()
+	c.Assert(req.Method, Equals, "HEAD")
+	req = testServer.WaitRequest()
+	c.Assert(req.Method, Equals, "PUT")
+	c.Assert(req.Header.Get("x-amz-copy-source"), Equals, "/bucket/name")
+	c.Assert(req.Header.Get("x-amz-copy-source-if-match"), Equals, `"9b2cf535f27731c974343645a3985328"`)
+	c.Assert(req.Header.Get("x-amz-metadata-directive"), Equals, "REPLACE")
+	c.Assert(req.Header.Get("Content-Type"), Equals, "image/png")
+	c.Assert(req.Header["X-Amz-Meta-Old"], DeepEquals, []string{"value"})
+	c.Assert(req.Header["X-Amz-Meta-Goamz-Touched"], DeepEquals, []string{"2021-02-03T04:05:06Z"})
+}
+
+func (s *S) TestTouchKeepsHeaders(c *C) {
+	testServer.Response(200, map[string]string{
+		"ETag":                         `"etag"`,
+		"Cache-Control":                "max-age=3600",
+		"Content-Encoding":             "gzip",
+		"x-amz-server-side-encryption": "aws:kms",
+		"x-amz-server-side-encryption-aws-kms-key-id": "arn:aws:kms:us-east-1:123456789012:key/abcd",
+	}, "")
+	testServer.Response(200, nil, CopyObjectResultDump)
+
+	err := s.s3.Bucket("bucket").Touch("name")
+	c.Assert(err, IsNil)
+
+	testServer.WaitRequest()
+	req := testServer.WaitRequest()
+	c.Assert(req.Header.Get("x-amz-metadata-directive"), Equals, "REPLACE")
+	c.Assert(req.Header.Get("Cache-Control"), Equals, "max-age=3600")
+	c.Assert(req.Header.Get("Content-Encoding"), Equals, "gzip")
+	c.Assert(req.Header.Get("x-amz-server-side-encryption-aws-kms-key-id"), Equals, "arn:aws:kms:us-east-1:123456789012:key/abcd")
+}
+
+func (s *S) TestTouchSSECustomerKey(c *C) {
+	testServer.Response(200, map[string]string{"ETag": `"etag"`}, "")
+	testServer.Response(200, nil, CopyObjectResultDump)
+
+	err := s.s3.Bucket("bucket").TouchWithOptions("name", s3.UpdateOptions{SSECustomerKey: sseCustomerKey})
+	c.Assert(err, IsNil)
+
+	req := testServer.WaitRequest()
+	c.Assert(req.Header["X-Amz-Server-Side-Encryption-Customer-Key"], DeepEquals, []string{"MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY="})
+	req = testServer.WaitRequest()
+	c.Assert(req.Header["X-Amz-Copy-Source-Server-Side-Encryption-Customer-Key"], DeepEquals, []string{"MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY="})
+	c.Assert(req.Header["X-Amz-Meta-Goamz-Touched"], HasLen, 1)
+}
+
+func (s *S) TestRename(c *C) {
+	testServer.Response(200, map[string]string{
+		"ETag":           `"9b2cf535f27731c974343645a3985328"`,
+		"Content-Length": "5",
+	}, "")
+	testServer.Response(200, nil, CopyObjectResultDump)
+	testServer.Response(204, nil, "")
+
+	b := s.s3.Bucket("bucket")
+	err := b.Rename("old", "new", s3.Private)
+	c.Assert(err, IsNil)
+
+	reqs := testServer.WaitRequests(3)
+	c.Assert(reqs[0].Method, Equals, "HEAD")
+	c.Assert(reqs[0].URL.Path, Equals, "/bucket/old")
+	c.Assert(reqs[1].Method, Equals, "PUT")
+	c.Assert(reqs[1].URL.Path, Equals, "/bucket/new")
+	c.Assert(reqs[1].Header.Get("x-amz-copy-source"), Equals, "/bucket/old")
+	c.Assert(reqs[1].Header.Get("x-amz-copy-source-if-match"), Equals, `"9b2cf535f27731c974343645a3985328"`)
+	c.Assert(reqs[1].Header.Get("x-amz-metadata-directive"), Equals, "")
+	c.Assert(reqs[2].Method, Equals, "DELETE")
+	c.Assert(reqs[2].URL.Path, Equals, "/bucket/old")
+}
+
+func (s *S) TestRenameNotVerified(c *C) {
+	testServer.Response(200, map[string]string{
+		"ETag":           `"0cc175b9c0f1b6a831c399e269772661"`,
+		"Content-Length": "5",
+	}, "")
+	testServer.Response(200, nil, CopyObjectResultDump)
+	testServer.Response(204, nil, "")
+
+	b := s.s3.Bucket("bucket")
+	err := b.Rename("old", "new", s3.Private)
+	c.Assert(err, ErrorMatches, `s3: rename of "old" not verified: .*`)
+
+	// The copy is deleted and the object at the old path is not.
+	reqs := testServer.WaitRequests(3)
+	c.Assert(reqs[1].Method, Equals, "PUT")
+	c.Assert(reqs[2].Method, Equals, "DELETE")
+	c.Assert(reqs[2].URL.Path, Equals, "/bucket/new")
+}
+
+func (s *S) TestRenameKMS(c *C) {
+	testServer.Response(200, map[string]string{
+		"ETag":                         `"0cc175b9c0f1b6a831c399e269772661"`,
+		"Content-Length":               "5",
+		"x-amz-storage-class":          "STANDARD_IA",
+		"x-amz-server-side-encryption": "aws:kms",
+		"x-amz-server-side-encryption-aws-kms-key-id": "arn:aws:kms:us-east-1:123456789012:key/abcd",
+	}, "")
+	testServer.Response(200, nil, CopyObjectResultDump)
+	testServer.Response(204, nil, "")
+
+	// The ETag of the copy differs, but KMS ETags are not MD5 sums.
+	b := s.s3.Bucket("bucket")
+	err := b.Rename("old", "new", s3.Private)
+	c.Assert(err, IsNil)
+
+	reqs := testServer.WaitRequests(3)
+	c.Assert(reqs[1].Method, Equals, "PUT")
+	c.Assert(reqs[1].Header.Get("x-amz-storage-class"), Equals, "STANDARD_IA")
+	c.Assert(reqs[1].Header.Get("x-amz-server-side-encryption"), Equals, "aws:kms")
+	c.Assert(reqs[1].Header.Get("x-amz-server-side-encryption-aws-kms-key-id"), Equals, "arn:aws:kms:us-east-1:123456789012:key/abcd")
+	c.Assert(reqs[2].Method, Equals, "DELETE")
+	c.Assert(reqs[2].URL.Path, Equals, "/bucket/old")
+}
+
+func (s *S) TestRenameMulti(c *C) {
+	s3.SetCopySizes(8, 4)
+	defer s3.SetCopySizes(5<<30, 512<<20)
+
+	sums := []string{
+		"0cc175b9c0f1b6a831c399e269772661",
+		"92eb5ffee6ae2fec3ad71c777531578f",
+		"4a8a08f09d37b73795649038408b5f33",
+	}
+	var partSums [][]byte
+	testServer.Response(200, map[string]string{
+		"ETag":                `"d41d8cd98f00b204e9800998ecf8427e-2"`,
+		"Content-Length":      "10",
+		"Content-Type":        "image/png",
+		"x-amz-meta-color":    "blue",
+		"x-amz-storage-class": "STANDARD_IA",
+	}, "")
+	testServer.Response(200, nil, InitMultiResultDump)
+	for _, sum := range sums {
+		testServer.Response(200, nil, "<CopyPartResult><ETag>&quot;"+sum+"&quot;</ETag></CopyPartResult>")
+		b, _ := hex.DecodeString(sum)
+		partSums = append(partSums, b)
+	}
+	testServer.Response(200, nil, "<CompleteMultipartUploadResult><ETag>&quot;"+s3.ComputeMultipartETag(partSums)+"&quot;</ETag></CompleteMultipartUploadResult>")
+	testServer.Response(204, nil, "")
+
+	b := s.s3.Bucket("bucket")
+	err := b.Rename("old", "new", s3.PublicRead)
+	c.Assert(err, IsNil)
+
+	reqs := testServer.WaitRequests(7)
+	c.Assert(reqs[0].Method, Equals, "HEAD")
+	c.Assert(reqs[1].Method, Equals, "POST")
+	c.Assert(reqs[1].URL.Path, Equals, "/bucket/new")
+	c.Assert(reqs[1].Header.Get("Content-Type"), Equals, "image/png")
+	c.Assert(reqs[1].Header.Get("x-amz-meta-color"), Equals, "blue")
+	c.Assert(reqs[1].Header.Get("x-amz-acl"), Equals, "public-read")
+	c.Assert(reqs[1].Header.Get("x-amz-storage-class"), Equals, "STANDARD_IA")
+	for i, r := range []string{"bytes=0-3", "bytes=4-7", "bytes=8-9"} {
+		req := reqs[2+i]
+		c.Assert(req.Method, Equals, "PUT")
+		c.Assert(req.Form["partNumber"], DeepEquals, []string{strconv.Itoa(i + 1)})
+		c.Assert(req.Header.Get("x-amz-copy-source"), Equals, "/bucket/old")
+		c.Assert(req.Header.Get("x-amz-copy-source-range"), Equals, r)
+		c.Assert(req.Header.Get("x-amz-copy-source-if-match"), Equals, `"d41d8cd98f00b204e9800998ecf8427e-2"`)
+	}
+	c.Assert(reqs[5].Method, Equals, "POST")
+	c.Assert(reqs[6].Method, Equals, "DELETE")
+	c.Assert(reqs[6].URL.Path, Equals, "/bucket/old")
+}
+
+func (s *S) TestRenameMultiSourceChanged(c *C) {
+	s3.SetCopySizes(8, 4)
+	defer s3.SetCopySizes(5<<30, 512<<20)
+
+	testServer.Response(200, map[string]string{
+		"ETag":           `"d41d8cd98f00b204e9800998ecf8427e-2"`,
+		"Content-Length": "10",
+	}, "")
+	testServer.Response(200, nil, InitMultiResultDump)
+	testServer.Response(200, nil, "<CopyPartResult><ETag>&quot;0cc175b9c0f1b6a831c399e269772661&quot;</ETag></CopyPartResult>")
+	// The object is overwritten before the second part is copied.
+	testServer.Response(412, nil, PreconditionFailedDump)
+	testServer.Response(204, nil, "")
+
+	b := s.s3.Bucket("bucket")
+	err := b.Rename("old", "new", s3.Private)
+	c.Assert(err, ErrorMatches, ".*At least one of the pre-conditions you specified did not hold.*")
+
+	reqs := testServer.WaitRequests(5)
+	c.Assert(reqs[3].Header.Get("x-amz-copy-source-if-match"), Equals, `"d41d8cd98f00b204e9800998ecf8427e-2"`)
+	// The upload is aborted and the object at the old path survives.
+	c.Assert(reqs[4].Method, Equals, "DELETE")
+	c.Assert(reqs[4].URL.Path, Equals, "/bucket/new")
+	c.Assert(reqs[4].Form["uploadId"], DeepEquals, []string{"JNbR_cMdwnGiD12jKAd6WK2PUkfj2VxA7i4nCwjE6t71nI9Tl3eVDPFlU0nOixhftH7I17ZPGkV3QA.l7ZD.QQ--"})
+}
+
+func (s *S) TestCopyReplaceTags(c *C) {
+	testServer.Response(200, nil, CopyObjectResultDump)
+
+	b := s.s3.Bucket("bucket")
+	_, err := b.Copy("old", "new", s3.Private, s3.CopyOptions{
+		TaggingDirective: s3.TaggingReplace,
+		Tags:             map[string]string{"project": "blue sky", "env": "prod"},
+	})
+	c.Assert(err, IsNil)
+
+	req := testServer.WaitRequest()
+	c.Assert(req.Header["X-Amz-Tagging-Directive"], DeepEquals, []string{"REPLACE"})
+	c.Assert(req.Header["X-Amz-Tagging"], DeepEquals, []string{"env=prod&project=blue%20sky"})
+}
+
+func (s *S) TestCopyDetectContentType(c *C) {
+	testServer.Responses(2, 200, nil, CopyObjectResultDump)
+
+	b := s.s3.Bucket("bucket")
+	_, err := b.Copy("data.txt", "data.json", s3.Private, s3.CopyOptions{
+		MetadataDirective: s3.MetadataReplace,
+		Meta:              map[string][]string{"Source": {"legacy"}},
+		DetectContentType: true,
+	})
+	c.Assert(err, IsNil)
+
+	req := testServer.WaitRequest()
+	c.Assert(req.Header["X-Amz-Metadata-Directive"], DeepEquals, []string{"REPLACE"})
+	c.Assert(req.Header["Content-Type"], DeepEquals, []string{"application/json"})
+	c.Assert(req.Header["X-Amz-Meta-Source"], DeepEquals, []string{"legacy"})
+
+	// An explicit content type wins over detection.
+	_, err = b.Copy("data.txt", "data.json", s3.Private, s3.CopyOptions{
+		MetadataDirective: s3.MetadataReplace,
+		ContentType:       "text/plain",
+		DetectContentType: true,
+	})
+	c.Assert(err, IsNil)
+
+	req = testServer.WaitRequest()
+	c.Assert(req.Header["Content-Type"], DeepEquals, []string{"text/plain"})
+}
+
+func (s *S) TestCopySSECustomerKey(c *C) {
+	testServer.Response(200, nil, CopyObjectResultDump)
+
+	b := s.s3.Bucket("bucket")
+	_, err := b.Copy("old", "new", s3.Private, s3.CopyOptions{
+		SourceSSECustomerKey: sseCustomerKey,
+	})
+	c.Assert(err, IsNil)
+
+	req := testServer.WaitRequest()
+	c.Assert(req.Header["X-Amz-Copy-Source-Server-Side-Encryption-Customer-Algorithm"], DeepEquals, []string{"AES256"})
+	c.Assert(req.Header["X-Amz-Copy-Source-Server-Side-Encryption-Customer-Key"], DeepEquals, []string{"MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY="})
+	c.Assert(req.Header["X-Amz-Copy-Source-Server-Side-Encryption-Customer-Key-Md5"], DeepEquals, []string{"hRasmdxgYDKV3nvbahU1MA=="})
+	c.Assert(req.Header["X-Amz-Server-Side-Encryption-Customer-Key"], IsNil)
+}
+
+func (s *S) TestCopyErrorIn200(c *C) {
+	testServer.Response(200, nil, InternalErrorDump)
+
+	b := s.s3.Bucket("bucket")
+	_, err := b.Copy("old", "new", s3.Private, s3.CopyOptions{})
+	c.Assert(err, ErrorMatches, "copy succeeded with no ETag")
+}
+
+var writeResponseHeaders = map[string]string{
+	"ETag":                         `"9a0364b9e99bb480dd25e1f0284c8555"`,
+	"x-amz-version-id":             "3HL4kqtJlcpXroDTDmJ+rmSpXd3dIbrHY",
+	"x-amz-server-side-encryption": "AES256",
+	"x-amz-expiration":             `expiry-date="Fri, 23 Dec 2012 00:00:00 GMT", rule-id="picture-deletion-rule"`,
+	"x-amz-request-charged":        "requester",
+}
+
+func checkWriteResult(c *C, result *s3.WriteResult) {
+	c.Assert(result.VersionId, Equals, "3HL4kqtJlcpXroDTDmJ+rmSpXd3dIbrHY")
+	c.Assert(result.ServerSideEncryption, Equals, "AES256")
+	c.Assert(result.Expiration, Equals, `expiry-date="Fri, 23 Dec 2012 00:00:00 GMT", rule-id="picture-deletion-rule"`)
+	c.Assert(result.RequestCharged, Equals, true)
+	c.Assert(result.Header.Get("x-amz-server-side-encryption"), Equals, "AES256")
+}
+
+func (s *S) TestPutReaderWithOptionsResult(c *C) {
+	testServer.Response(200, writeResponseHeaders, "")
+
+	b := s.s3.Bucket("bucket")
+	payload := []byte("content")
+	result, err := b.PutReaderWithOptions(
+		"name",
+		bytes.NewReader(payload),
+		int64(len(payload)),
+		"content-type",
+		s3.Private,
+		s3.MD5B64(payload),
+		s3.SHA256Hex(payload),
+		s3.Options{},
+	)
+	c.Assert(err, IsNil)
+	testServer.WaitRequest()
+
+	c.Assert(result.ETag, Equals, `"9a0364b9e99bb480dd25e1f0284c8555"`)
+	checkWriteResult(c, result)
+}
+
+func (s *S) TestCopyResult(c *C) {
+	testServer.Response(200, writeResponseHeaders, CopyObjectResultDump)
+
+	b := s.s3.Bucket("bucket")
+	result, err := b.Copy("old", "new", s3.Private, s3.CopyOptions{})
+	c.Assert(err, IsNil)
+	testServer.WaitRequest()
+
+	c.Assert(result.ETag, Equals, `"9b2cf535f27731c974343645a3985328"`)
+	checkWriteResult(c, &result.WriteResult)
+}
+
+// DelObject docs: http://goo.gl/APeTt
+
+func (s *S) TestDelObject(c *C) {
+	testServer.Response(200, nil, "")
+
+	b := s.s3.Bucket("bucket")
+	err := b.Del("name")
+	c.Assert(err, IsNil)
+
+	req := testServer.WaitRequest()
+	c.Assert(req.Method, Equals, "DELETE")
+	c.Assert(req.URL.Path, Equals, "/bucket/name")
+	c.Assert(req.Header["Date"], Not(Equals), "")
+}
+
+func (s *S) TestDelIfMatch(c *C) {
+	testServer.Response(412, nil, "")
+
+	b := s.s3.Bucket("bucket")
+	err := b.DelIfMatch("name", "abc")
+	c.Assert(err, Equals, s3.ErrETagMismatch)
+
+	req := testServer.WaitRequest()
+	c.Assert(req.Method, Equals, "DELETE")
+	c.Assert(req.Header.Get("If-Match"), Equals, `"abc"`)
+}
+
+func (s *S) TestDelIfETag(c *C) {
+	testServer.Response(200, map[string]string{"ETag": `"abc"`}, "")
+	testServer.Response(204, nil, "")
+
+	b := s.s3.Bucket("bucket")
+	err := b.DelIfETag("name", `"abc"`)
+	c.Assert(err, IsNil)
+
+	req := testServer.WaitRequest()
+	c.Assert(req.Method, Equals, "HEAD")
+	req = testServer.WaitRequest()
+	c.Assert(req.Method, Equals, "DELETE")
+	c.Assert(req.URL.Path, Equals, "/bucket/name")
+	c.Assert(req.Header.Get("If-Match"), Equals, `"abc"`)
+}
+
+func (s *S) TestDelIfETagMismatch(c *C) {
+	testServer.Response(200, map[string]string{"ETag": `"def"`}, "")
+
+	b := s.s3.Bucket("bucket")
+	err := b.DelIfETag("name", "abc")
+	c.Assert(err, Equals, s3.ErrETagMismatch)
+
+	req := testServer.WaitRequest()
+	c.Assert(req.Method, Equals, "HEAD")
+}
+
+// Bucket List Objects docs: http://goo.gl/YjQTc
+
+func (s *S) TestMaxResponseSize(c *C) {
+	testServer.Responses(3, 200, nil, GetListResultDump1)
+
+	client := s3.New(s.s3.Auth, s.s3.Region)
+	client.MaxResponseSize = int64(len(GetListResultDump1)) - 1
+	_, err := client.Bucket("quotes").List("N", "", "", 0)
+	c.Assert(err, Equals, s3.ErrResponseTooLarge)
+
+	client.MaxResponseSize = int64(len(GetListResultDump1))
+	data, err := client.Bucket("quotes").List("N", "", "", 0)
+	c.Assert(err, IsNil)
+	c.Assert(data.Contents, HasLen, 2)
+
+	client.MaxResponseSize = math.MaxInt64
+	data, err = client.Bucket("quotes").List("N", "", "", 0)
+	c.Assert(err, IsNil)
+	c.Assert(data.Contents, HasLen, 2)
+}
+
+func (s *S) TestMalformedResponse(c *C) {
+	testServer.Response(200, nil, GetListResultDump1[:len(GetListResultDump1)/2])
+
+	_, err := s.s3.Bucket("quotes").List("N", "", "", 0)
+	c.Assert(err, ErrorMatches, "XML syntax error.*")
+}
+
+func (s *S) TestPrefixSize(c *C) {
+	testServer.Response(200, nil, GetListUsageDump1)
+	testServer.Response(200, nil, GetListUsageDump2)
+
+	b := s.s3.Bucket("bucket")
+	total, count, err := b.PrefixSize("logs/")
+	c.Assert(err, IsNil)
+	c.Assert(total, Equals, int64(2130))
+	c.Assert(count, Equals, int64(3))
+
+	reqs := testServer.WaitRequests(2)
+	c.Assert(reqs[0].Form["prefix"], DeepEquals, []string{"logs/"})
+	c.Assert(reqs[0].Form["marker"], DeepEquals, []string{""})
+	c.Assert(reqs[1].Form["prefix"], DeepEquals, []string{"logs/"})
+	c.Assert(reqs[1].Form["marker"], DeepEquals, []string{"logs/b"})
+}
+
+func (s *S) TestPrefixSizeByClass(c *C) {
+	testServer.Response(200, nil, GetListUsageDump1)
+	testServer.Response(200, nil, GetListUsageDump2)
+
+	b := s.s3.Bucket("bucket")
+	usage, err := b.PrefixSizeByClass("logs/")
+	c.Assert(err, IsNil)
+	c.Assert(usage, DeepEquals, map[string]s3.PrefixUsage{
+		"STANDARD": {Bytes: 130, Count: 2},
+		"GLACIER":  {Bytes: 2000, Count: 1},
+	})
+	testServer.WaitRequests(2)
+}
+
+func (s *S) TestListModifiedSince(c *C) {
+	testServer.Response(200, nil, ListModifiedDump1)
+	testServer.Response(200, nil, ListModifiedDump2)
+
+	b := s.s3.Bucket("bucket")
+	keys, err := b.ListModifiedSince("backup/", time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC))
+	c.Assert(err, IsNil)
+	var names []string
+	for _, key := range keys {
+		names = append(names, key.Key)
+	}
+	c.Assert(names, DeepEquals, []string{"backup/c", "backup/d"})
+	c.Assert(keys[1].Size, Equals, int64(40))
+
+	reqs := testServer.WaitRequests(2)
+	c.Assert(reqs[0].Form["prefix"], DeepEquals, []string{"backup/"})
+	c.Assert(reqs[1].Form["marker"], DeepEquals, []string{"backup/b"})
+}
+
+func (s *S) TestList(c *C) {
+	testServer.Response(200, nil, GetListResultDump1)
+
+	b := s.s3.Bucket("quotes")
 
 	data, err := b.List("N", "", "", 0)
 	c.Assert(err, IsNil)
@@ -282,6 +1850,238 @@ func (s *S) TestListWithDelimiter(c *C) {
 	c.Assert(data.CommonPrefixes, DeepEquals, []string{"photos/2006/feb/", "photos/2006/jan/"})
 }
 
+func (s *S) TestRequestModifier(c *C) {
+	testServer.Response(200, nil, "content")
+
+	s3v4 := s3.New(s.s3.Auth, aws.Region{
+		Name:          "faux-region-1",
+		S3Endpoint:    testServer.URL,
+		S3V4Signature: true,
+	})
+	s3v4.RequestModifier = func(req *http.Request) {
+		req.Header.Set("X-Trace-Id", "trace-1")
+	}
+
+	b := s3v4.Bucket("bucket")
+	_, err := b.Get("name")
+	c.Assert(err, IsNil)
+
+	req := testServer.WaitRequest()
+	c.Assert(req.Header["X-Trace-Id"], DeepEquals, []string{"trace-1"})
+	c.Assert(req.Header.Get("Authorization"), Matches, "AWS4-HMAC-SHA256 .*SignedHeaders=[^,]*;x-trace-id[;,].*")
+}
+
+// checkV4Signature verifies that req, as received by the test server,
+// carries a valid V4 signature for the given auth and region.
+func checkV4Signature(c *C, req *http.Request, auth aws.Auth, region aws.Region) {
+	authz := req.Header.Get("Authorization")
+	i := strings.Index(authz, "SignedHeaders=")
+	c.Assert(i >= 0, Equals, true, Commentf("Authorization: %q", authz))
+	signed := strings.Split(strings.SplitN(authz[i+len("SignedHeaders="):], ",", 2)[0], ";")
+
+	u := *req.URL
+	sreq := &http.Request{Method: req.Method, URL: &u, Host: req.Host, Header: make(http.Header)}
+	for _, h := range signed {
+		if h == "host" {
+			continue
+		}
+		sreq.Header[http.CanonicalHeaderKey(h)] = append([]string(nil), req.Header[http.CanonicalHeaderKey(h)]...)
+	}
+	signer := s3.NewV4Signer(auth, "s3", region)
+	err := signer.Sign(sreq, req.Header.Get("X-Amz-Content-Sha256"))
+	c.Assert(err, IsNil)
+	c.Assert(sreq.Header.Get("Authorization"), Equals, authz)
+}
+
+func (s *S) TestSigningHost(c *C) {
+	testServer.Response(200, nil, "content")
+
+	region := aws.Region{
+		Name:          "faux-region-1",
+		S3Endpoint:    testServer.URL,
+		S3V4Signature: true,
+	}
+	proxied := s3.New(s.s3.Auth, region)
+	proxied.SigningHost = "s3.example.com"
+
+	b := proxied.Bucket("bucket")
+	_, err := b.Get("name")
+	c.Assert(err, IsNil)
+
+	req := testServer.WaitRequest()
+	c.Assert(req.Host, Equals, "s3.example.com")
+	c.Assert(req.URL.Path, Equals, "/bucket/name")
+	c.Assert(req.Header.Get("Authorization"), Matches, ".*SignedHeaders=([^,]*;)?host;.*")
+	checkV4Signature(c, req, s.s3.Auth, region)
+}
+
+func (s *S) TestListEncodeKeys(c *C) {
+	testServer.Response(200, nil, ListEncodedResultDump)
+
+	b := s.s3.Bucket("bucket")
+	resp, err := b.ListWithOptions("notes/", "/", "", 0, s3.ListOptions{EncodeKeys: true})
+	c.Assert(err, IsNil)
+
+	req := testServer.WaitRequest()
+	c.Assert(req.Form["encoding-type"], DeepEquals, []string{"url"})
+
+	c.Assert(resp.EncodingType, Equals, "")
+	c.Assert(resp.Prefix, Equals, "notes/")
+	c.Assert(resp.Delimiter, Equals, "/")
+	c.Assert(resp.Contents, HasLen, 1)
+	c.Assert(resp.Contents[0].Key, Equals, "notes/line\nbreak and\x01control.txt")
+	c.Assert(resp.CommonPrefixes, DeepEquals, []string{"notes/✓/"})
+}
+
+func (s *S) TestListPrefixes(c *C) {
+	testServer.Response(200, nil, ListPrefixesResultDump1)
+	testServer.Response(200, nil, ListPrefixesResultDump2)
+
+	b := s.s3.Bucket("example-bucket")
+
+	prefixes, err := b.ListPrefixes("photos/")
+	c.Assert(err, IsNil)
+	c.Assert(prefixes, DeepEquals, []string{"photos/2006/", "photos/2007/", "photos/2008/"})
+
+	req := testServer.WaitRequest()
+	c.Assert(req.Method, Equals, "GET")
+	c.Assert(req.URL.Path, Equals, "/example-bucket/")
+	c.Assert(req.Form["prefix"], DeepEquals, []string{"photos/"})
+	c.Assert(req.Form["delimiter"], DeepEquals, []string{"/"})
+	c.Assert(req.Form["marker"], DeepEquals, []string{""})
+
+	req = testServer.WaitRequest()
+	c.Assert(req.Form["prefix"], DeepEquals, []string{"photos/"})
+	c.Assert(req.Form["delimiter"], DeepEquals, []string{"/"})
+	c.Assert(req.Form["marker"], DeepEquals, []string{"photos/2006/"})
+}
+
+func (s *S) TestListFirst(c *C) {
+	testServer.Response(200, nil, ListPrefixesResultDump1)
+	testServer.Response(200, nil, ListPrefixesResultDump2)
+	testServer.Response(200, nil, ListPrefixesResultDump1)
+
+	b := s.s3.Bucket("example-bucket")
+
+	keys, prefixes, err := b.ListFirst("photos/", "/", 4)
+	c.Assert(err, IsNil)
+	c.Assert(keys, HasLen, 1)
+	c.Assert(keys[0].Key, Equals, "photos/index.html")
+	c.Assert(prefixes, DeepEquals, []string{"photos/2006/", "photos/2007/", "photos/2008/"})
+
+	reqs := testServer.WaitRequests(2)
+	c.Assert(reqs[0].Form["max-keys"], DeepEquals, []string{"4"})
+	c.Assert(reqs[0].Form["marker"], DeepEquals, []string{""})
+	c.Assert(reqs[1].Form["max-keys"], DeepEquals, []string{"2"})
+	c.Assert(reqs[1].Form["marker"], DeepEquals, []string{"photos/2006/"})
+
+	// Pagination stops once enough keys were collected.
+	keys, prefixes, err = b.ListFirst("photos/", "/", 2)
+	c.Assert(err, IsNil)
+	c.Assert(keys, HasLen, 1)
+	c.Assert(prefixes, DeepEquals, []string{"photos/2006/"})
+
+	req := testServer.WaitRequest()
+	c.Assert(req.Form["max-keys"], DeepEquals, []string{"2"})
+}
+
+func (s *S) TestWalkEntries(c *C) {
+	testServer.Response(200, nil, ListInterleavedResultDump1)
+	testServer.Response(200, nil, ListInterleavedResultDump2)
+
+	b := s.s3.Bucket("example-bucket")
+
+	var names []string
+	err := b.WalkEntries("", "/", func(entry s3.ListEntry) error {
+		if entry.Key != nil {
+			c.Check(entry.Prefix, Equals, "")
+			names = append(names, entry.Key.Key)
+		} else {
+			names = append(names, entry.Prefix)
+		}
+		return nil
+	})
+	c.Assert(err, IsNil)
+	c.Assert(names, DeepEquals, []string{"a.txt", "b/", "c.txt", "d/", "e.txt", "f/"})
+
+	reqs := testServer.WaitRequests(2)
+	c.Assert(reqs[0].Form["delimiter"], DeepEquals, []string{"/"})
+	c.Assert(reqs[1].Form["marker"], DeepEquals, []string{"d/"})
+}
+
+func (s *S) TestListMaxKeysClamped(c *C) {
+	testServer.Response(200, nil, GetListResultDump1)
+
+	b := s.s3.Bucket("quotes")
+	_, err := b.List("", "", "", 5000)
+	c.Assert(err, IsNil)
+
+	req := testServer.WaitRequest()
+	c.Assert(req.Form["max-keys"], DeepEquals, []string{"1000"})
+}
+
+func (s *S) TestListChunked(c *C) {
+	// The first response is chunked and cut short after its first
+	// entry, the second one is chunked and complete.
+	var requests int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		i := strings.Index(GetListResultDump1, "</Contents>") + len("</Contents>")
+		w.Write([]byte(GetListResultDump1[:i]))
+		w.(http.Flusher).Flush()
+		if requests == 1 {
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			conn.Close()
+			return
+		}
+		w.Write([]byte(GetListResultDump1[i:]))
+	}))
+	defer srv.Close()
+
+	b := s3.New(s.s3.Auth, aws.Region{Name: "faux-region-1", S3Endpoint: srv.URL}).Bucket("quotes")
+	resp, err := b.List("N", "", "", 0)
+	c.Assert(err, IsNil)
+	c.Assert(requests, Equals, 2)
+	c.Assert(resp.Contents, HasLen, 2)
+	c.Assert(resp.Contents[0].Key, Equals, "Nelson")
+	c.Assert(resp.Contents[1].Key, Equals, "Neo")
+}
+
+func (s *S) TestListPage(c *C) {
+	testServer.Response(200, nil, ListPrefixesResultDump1)
+	testServer.Response(200, nil, ListPrefixesResultDump2)
+
+	b := s.s3.Bucket("example-bucket")
+
+	page, err := b.ListPage("photos/", "/", "", 2)
+	c.Assert(err, IsNil)
+	c.Assert(page.Keys, HasLen, 1)
+	c.Assert(page.Keys[0].Key, Equals, "photos/index.html")
+	c.Assert(page.Prefixes, DeepEquals, []string{"photos/2006/"})
+	c.Assert(page.IsTruncated, Equals, true)
+	c.Assert(page.Token, Not(Equals), "")
+
+	req := testServer.WaitRequest()
+	c.Assert(req.Form["marker"], DeepEquals, []string{""})
+	c.Assert(req.Form["max-keys"], DeepEquals, []string{"2"})
+
+	// The token may be persisted and used by another client.
+	token := []byte(page.Token)
+	other := s3.New(s.s3.Auth, s.s3.Region).Bucket("example-bucket")
+	page, err = other.ListPage("photos/", "/", string(token), 2)
+	c.Assert(err, IsNil)
+	c.Assert(page.Keys, HasLen, 0)
+	c.Assert(page.Prefixes, DeepEquals, []string{"photos/2007/", "photos/2008/"})
+	c.Assert(page.IsTruncated, Equals, false)
+	c.Assert(page.Token, Equals, "")
+
+	req = testServer.WaitRequest()
+	c.Assert(req.Form["marker"], DeepEquals, []string{"photos/2006/"})
+
+	_, err = b.ListPage("photos/", "/", "not a token", 2)
+	c.Assert(err, ErrorMatches, `bad list token: "not a token"`)
+}
+
 func (s *S) TestRetryAttempts(c *C) {
 	s3.SetAttemptStrategy(nil)
 	orig := s3.AttemptStrategy()
@@ -290,3 +2090,24 @@ func (s *S) TestRetryAttempts(c *C) {
 	s3.RetryAttempts(true)
 	c.Assert(s3.AttemptStrategy(), Equals, orig)
 }
+
+func (s *S) TestRetryClock(c *C) {
+	testServer.Responses(2, 500, nil, InternalErrorDump)
+	testServer.Response(200, nil, "content")
+
+	// The retries wait on the clock of the client, which only moves
+	// when slept on.
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	var slept []time.Duration
+	client := s3.New(s.s3.Auth, s.s3.Region)
+	s3.SetClock(client, func() time.Time { return now })
+	s3.SetSleep(client, func(d time.Duration) {
+		slept = append(slept, d)
+		now = now.Add(d)
+	})
+	data, err := client.Bucket("bucket").Get("name")
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "content")
+	c.Assert(slept, DeepEquals, []time.Duration{100 * time.Millisecond, 100 * time.Millisecond})
+	testServer.WaitRequests(3)
+}
@@ -28,6 +28,25 @@ func (s *LocalServer) SetUp(c *C) {
 	}
 }
 
+// LocalBucketSuite runs each test against a fresh s3test server holding
+// an empty bucket, b.
+type LocalBucketSuite struct {
+	srv LocalServer
+	b   *s3.Bucket
+}
+
+var _ = Suite(&LocalBucketSuite{})
+
+func (s *LocalBucketSuite) SetUpTest(c *C) {
+	s.srv.SetUp(c)
+	s.b = s3.New(s.srv.auth, s.srv.region).Bucket("bucket")
+	c.Assert(s.b.PutBucket(s3.Private), IsNil)
+}
+
+func (s *LocalBucketSuite) TearDownTest(c *C) {
+	s.srv.srv.Quit()
+}
+
 // LocalServerSuite defines tests that will run
 // against the local s3test server. It includes
 // selected tests from ClientTests;
@@ -3,6 +3,7 @@ package s3test
 import (
 	"bytes"
 	"crypto/md5"
+	"encoding/base64"
 	"encoding/hex"
 	"encoding/xml"
 	"fmt"
@@ -76,6 +77,7 @@ type bucket struct {
 	acl     s3.ACL
 	ctime   time.Time
 	objects map[string]*object
+	uploads map[string]*multipartUpload
 }
 
 type object struct {
@@ -84,6 +86,16 @@ type object struct {
 	meta     http.Header // metadata to return with requests.
 	checksum []byte      // also held as Content-MD5 in meta.
 	data     []byte
+	etag     string // set for objects assembled from multipart uploads.
+}
+
+// multipartUpload holds the state of an unfinished multipart upload.
+type multipartUpload struct {
+	id        string
+	key       string
+	initiated time.Time
+	meta      http.Header
+	parts     map[int]*object
 }
 
 // A resource encapsulates the subject of an HTTP request.
@@ -213,14 +225,12 @@ var unimplementedBucketResourceNames = map[string]bool{
 	"requestPayment": true,
 	"versioning":     true,
 	"website":        true,
-	"uploads":        true,
 }
 
 var unimplementedObjectResourceNames = map[string]bool{
-	"uploadId": true,
-	"acl":      true,
-	"torrent":  true,
-	"uploads":  true,
+	"acl":     true,
+	"tagging": true,
+	"torrent": true,
 }
 
 var pathRegexp = regexp.MustCompile("/(([^/]+)(/(.*))?)?")
@@ -247,6 +257,9 @@ func (srv *Server) resourceForURL(u *url.URL) (r resource) {
 				return nullResource{}
 			}
 		}
+		if _, ok := q["uploads"]; ok {
+			return uploadsResource(b)
+		}
 		return b
 
 	}
@@ -266,6 +279,12 @@ func (srv *Server) resourceForURL(u *url.URL) (r resource) {
 	if obj := objr.bucket.objects[objr.name]; obj != nil {
 		objr.object = obj
 	}
+	if _, ok := q["uploads"]; ok {
+		return multipartResource{objectResource: objr}
+	}
+	if id := q.Get("uploadId"); id != "" {
+		return multipartResource{objectResource: objr, uploadId: id}
+	}
 	return objr
 }
 
@@ -386,7 +405,7 @@ func (obj *object) s3Key() s3.Key {
 		Key:          obj.name,
 		LastModified: obj.mtime.Format(timeFormat),
 		Size:         int64(len(obj.data)),
-		ETag:         fmt.Sprintf(`"%x"`, obj.checksum),
+		ETag:         obj.etagHeader(),
 		// TODO StorageClass
 		// TODO Owner
 	}
@@ -421,6 +440,7 @@ func (r bucketResource) put(a *action) interface{} {
 			name: r.name,
 			// TODO default acl
 			objects: make(map[string]*object),
+			uploads: make(map[string]*multipartUpload),
 		}
 		a.srv.buckets[r.name] = r.bucket
 		created = true
@@ -523,7 +543,7 @@ func (objr objectResource) get(a *action) interface{} {
 	// TODO Connection: close ??
 	// TODO x-amz-request-id
 	h.Set("Content-Length", fmt.Sprint(len(obj.data)))
-	h.Set("ETag", `"`+hex.EncodeToString(obj.checksum)+`"`)
+	h.Set("ETag", obj.etagHeader())
 	h.Set("Last-Modified", obj.mtime.Format(time.RFC1123))
 	if a.req.Method == "HEAD" {
 		return nil
@@ -543,14 +563,16 @@ var metaHeaders = map[string]bool{
 	"Content-Type":        true,
 	"Content-Encoding":    true,
 	"Content-Disposition": true,
+
+	"X-Amz-Storage-Class":                         true,
+	"X-Amz-Server-Side-Encryption":                true,
+	"X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id": true,
 }
 
 // PUT on an object creates the object.
 func (objr objectResource) put(a *action) interface{} {
 	// TODO Cache-Control header
 	// TODO Expires header
-	// TODO x-amz-server-side-encryption
-	// TODO x-amz-storage-class
 
 	// TODO is this correct, or should we erase all previous metadata?
 	obj := objr.object
@@ -592,11 +614,21 @@ func (objr objectResource) put(a *action) interface{} {
 	}
 	obj.data = data
 	obj.checksum = gotHash
+	obj.etag = ""
 	obj.mtime = time.Now()
 	objr.bucket.objects[objr.name] = obj
+	a.w.Header().Set("ETag", obj.etagHeader())
 	return nil
 }
 
+// etagHeader returns the quoted ETag of obj.
+func (obj *object) etagHeader() string {
+	if obj.etag != "" {
+		return `"` + obj.etag + `"`
+	}
+	return `"` + hex.EncodeToString(obj.checksum) + `"`
+}
+
 func (objr objectResource) delete(a *action) interface{} {
 	delete(objr.bucket.objects, objr.name)
 	return nil
@@ -627,3 +659,283 @@ func locationConstraint(a *action) string {
 	}
 	return loc.LocationConstraint
 }
+
+// uploadsResource is a bucket referred to with the "uploads"
+// subresource, which lists the unfinished multipart uploads in it.
+type uploadsResource bucketResource
+
+type listMultipartUploadsResult struct {
+	XMLName     xml.Name `xml:"ListMultipartUploadsResult"`
+	Bucket      string
+	Prefix      string
+	IsTruncated bool
+	Upload      []listedUpload
+}
+
+type listedUpload struct {
+	Key       string
+	UploadId  string
+	Initiated string
+}
+
+// GET on a bucket with the "uploads" subresource lists the
+// unfinished multipart uploads in it. Pagination is not supported.
+// http://docs.aws.amazon.com/AmazonS3/latest/API/mpUploadListMPUpload.html
+func (r uploadsResource) get(a *action) interface{} {
+	if r.bucket == nil {
+		fatalf(404, "NoSuchBucket", "The specified bucket does not exist")
+	}
+	prefix := a.req.Form.Get("prefix")
+	resp := &listMultipartUploadsResult{
+		Bucket: r.name,
+		Prefix: prefix,
+	}
+	for _, u := range r.bucket.uploads {
+		if strings.HasPrefix(u.key, prefix) {
+			resp.Upload = append(resp.Upload, listedUpload{
+				Key:       u.key,
+				UploadId:  u.id,
+				Initiated: u.initiated.Format(timeFormat),
+			})
+		}
+	}
+	sort.Sort(orderedUploads(resp.Upload))
+	return resp
+}
+
+func (uploadsResource) put(a *action) interface{}    { return notAllowed() }
+func (uploadsResource) post(a *action) interface{}   { return notAllowed() }
+func (uploadsResource) delete(a *action) interface{} { return notAllowed() }
+
+// orderedUploads holds a slice of uploads that can be sorted
+// by key and upload id.
+type orderedUploads []listedUpload
+
+func (s orderedUploads) Len() int {
+	return len(s)
+}
+func (s orderedUploads) Swap(i, j int) {
+	s[i], s[j] = s[j], s[i]
+}
+func (s orderedUploads) Less(i, j int) bool {
+	if s[i].Key != s[j].Key {
+		return s[i].Key < s[j].Key
+	}
+	return s[i].UploadId < s[j].UploadId
+}
+
+// multipartResource is an object referred to with the "uploads" or
+// "uploadId" subresources, used to manipulate multipart uploads.
+type multipartResource struct {
+	objectResource
+	uploadId string // empty when initiating a new upload.
+}
+
+// upload returns the multipart upload referred to by r.
+func (r multipartResource) upload() *multipartUpload {
+	u := r.bucket.uploads[r.uploadId]
+	if u == nil || u.key != r.name {
+		fatalf(404, "NoSuchUpload", "The specified upload does not exist. The upload ID may be invalid, or the upload may have been aborted or completed.")
+	}
+	return u
+}
+
+type initiateMultipartUploadResult struct {
+	XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+	Bucket   string
+	Key      string
+	UploadId string
+}
+
+type completeMultipartUploadResult struct {
+	XMLName  xml.Name `xml:"CompleteMultipartUploadResult"`
+	Location string
+	Bucket   string
+	Key      string
+	ETag     string
+}
+
+type completeMultipartUpload struct {
+	Part []struct {
+		PartNumber int
+		ETag       string
+	}
+}
+
+// POST on an object with the "uploads" subresource initiates a
+// multipart upload, and with the "uploadId" one completes it.
+// http://docs.aws.amazon.com/AmazonS3/latest/API/mpUploadInitiate.html
+// http://docs.aws.amazon.com/AmazonS3/latest/API/mpUploadComplete.html
+func (r multipartResource) post(a *action) interface{} {
+	if r.uploadId == "" {
+		u := &multipartUpload{
+			id:        a.reqId,
+			key:       r.name,
+			initiated: time.Now(),
+			meta:      make(http.Header),
+			parts:     make(map[int]*object),
+		}
+		for key, values := range a.req.Header {
+			key = http.CanonicalHeaderKey(key)
+			if metaHeaders[key] || strings.HasPrefix(key, "X-Amz-Meta-") {
+				u.meta[key] = values
+			}
+		}
+		r.bucket.uploads[u.id] = u
+		return &initiateMultipartUploadResult{
+			Bucket:   r.bucket.name,
+			Key:      r.name,
+			UploadId: u.id,
+		}
+	}
+	u := r.upload()
+	var req completeMultipartUpload
+	if err := xml.NewDecoder(a.req.Body).Decode(&req); err != nil {
+		fatalf(400, "MalformedXML", "The XML you provided was not well-formed or did not validate against our published schema")
+	}
+	if len(req.Part) == 0 {
+		fatalf(400, "MalformedXML", "The XML you provided was not well-formed or did not validate against our published schema")
+	}
+	var data []byte
+	var sums [][]byte
+	for i, p := range req.Part {
+		if i > 0 && p.PartNumber <= req.Part[i-1].PartNumber {
+			fatalf(400, "InvalidPartOrder", "The list of parts was not in ascending order.")
+		}
+		part := u.parts[p.PartNumber]
+		if part == nil || strings.Trim(p.ETag, `"`) != hex.EncodeToString(part.checksum) {
+			fatalf(400, "InvalidPart", "One or more of the specified parts could not be found.")
+		}
+		data = append(data, part.data...)
+		sums = append(sums, part.checksum)
+	}
+	sum := md5.Sum(data)
+	obj := &object{
+		name:     r.name,
+		mtime:    time.Now(),
+		meta:     u.meta,
+		checksum: sum[:],
+		data:     data,
+		etag:     s3.ComputeMultipartETag(sums),
+	}
+	r.bucket.objects[r.name] = obj
+	delete(r.bucket.uploads, u.id)
+	return &completeMultipartUploadResult{
+		Location: a.srv.URL() + "/" + r.bucket.name + "/" + r.name,
+		Bucket:   r.bucket.name,
+		Key:      r.name,
+		ETag:     obj.etagHeader(),
+	}
+}
+
+// PUT on an object with the "uploadId" subresource uploads a part.
+// http://docs.aws.amazon.com/AmazonS3/latest/API/mpUploadUploadPart.html
+func (r multipartResource) put(a *action) interface{} {
+	if r.uploadId == "" {
+		return notAllowed()
+	}
+	u := r.upload()
+	n, err := strconv.Atoi(a.req.Form.Get("partNumber"))
+	if err != nil || n < 1 || n > 10000 {
+		fatalf(400, "InvalidArgument", "Part number must be an integer between 1 and 10000, inclusive")
+	}
+	var expectHash []byte
+	if c := a.req.Header.Get("Content-MD5"); c != "" {
+		expectHash, err = base64.StdEncoding.DecodeString(c)
+		if err != nil || len(expectHash) != md5.Size {
+			fatalf(400, "InvalidDigest", "The Content-MD5 you specified was invalid")
+		}
+	}
+	sum := md5.New()
+	data, err := ioutil.ReadAll(io.TeeReader(a.req.Body, sum))
+	if err != nil {
+		fatalf(400, "TODO", "read error")
+	}
+	gotHash := sum.Sum(nil)
+	if expectHash != nil && bytes.Compare(gotHash, expectHash) != 0 {
+		fatalf(400, "BadDigest", "The Content-MD5 you specified did not match what we received")
+	}
+	u.parts[n] = &object{
+		mtime:    time.Now(),
+		checksum: gotHash,
+		data:     data,
+	}
+	a.w.Header().Set("ETag", `"`+hex.EncodeToString(gotHash)+`"`)
+	return nil
+}
+
+type listPartsResult struct {
+	XMLName              xml.Name `xml:"ListPartsResult"`
+	Bucket               string
+	Key                  string
+	UploadId             string
+	NextPartNumberMarker int
+	IsTruncated          bool
+	Part                 []listedPart
+}
+
+type listedPart struct {
+	PartNumber   int
+	LastModified string
+	ETag         string
+	Size         int64
+}
+
+// GET on an object with the "uploadId" subresource lists the
+// parts uploaded so far.
+// http://docs.aws.amazon.com/AmazonS3/latest/API/mpUploadListParts.html
+func (r multipartResource) get(a *action) interface{} {
+	if r.uploadId == "" {
+		return notAllowed()
+	}
+	u := r.upload()
+	marker, _ := strconv.Atoi(a.req.Form.Get("part-number-marker"))
+	maxParts := 1000
+	if s := a.req.Form.Get("max-parts"); s != "" {
+		i, err := strconv.Atoi(s)
+		if err != nil || i <= 0 {
+			fatalf(400, "InvalidArgument", "invalid value for max-parts: %q", s)
+		}
+		maxParts = i
+	}
+	var numbers []int
+	for n := range u.parts {
+		if n > marker {
+			numbers = append(numbers, n)
+		}
+	}
+	sort.Ints(numbers)
+	resp := &listPartsResult{
+		Bucket:   r.bucket.name,
+		Key:      r.name,
+		UploadId: u.id,
+	}
+	for _, n := range numbers {
+		if len(resp.Part) >= maxParts {
+			resp.IsTruncated = true
+			break
+		}
+		part := u.parts[n]
+		resp.Part = append(resp.Part, listedPart{
+			PartNumber:   n,
+			LastModified: part.mtime.Format(timeFormat),
+			ETag:         `"` + hex.EncodeToString(part.checksum) + `"`,
+			Size:         int64(len(part.data)),
+		})
+		resp.NextPartNumberMarker = n
+	}
+	return resp
+}
+
+// DELETE on an object with the "uploadId" subresource aborts
+// the multipart upload.
+// http://docs.aws.amazon.com/AmazonS3/latest/API/mpUploadAbort.html
+func (r multipartResource) delete(a *action) interface{} {
+	if r.uploadId == "" {
+		return notAllowed()
+	}
+	u := r.upload()
+	delete(r.bucket.uploads, u.id)
+	a.w.WriteHeader(http.StatusNoContent)
+	return nil
+}
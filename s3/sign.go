@@ -19,12 +19,16 @@ var b64 = base64.StdEncoding
 
 var s3ParamsToSign = map[string]bool{
 	"acl":                          true,
+	"attributes":                   true,
+	"lifecycle":                    true,
 	"location":                     true,
 	"logging":                      true,
 	"notification":                 true,
+	"object-lock":                  true,
 	"partNumber":                   true,
 	"policy":                       true,
 	"requestPayment":               true,
+	"tagging":                      true,
 	"torrent":                      true,
 	"uploadId":                     true,
 	"uploads":                      true,
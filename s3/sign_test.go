@@ -1,6 +1,15 @@
 package s3_test
 
 import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
 	. "gopkg.in/check.v1"
 
 	"github.com/koofr/goamz/aws"
@@ -131,3 +140,353 @@ func (s *S) TestSignExampleUnicodeKeys(c *C) {
 	expected := "AWS 0PN5J17HBGZHT7JJ3X82:6fE6lydvV8/IHLXtiMgHXnb55EA="
 	c.Assert(headers["Authorization"], DeepEquals, []string{expected})
 }
+
+// presign returns a copy of the URL presigned with the V4 signer for
+// expires seconds, as if it was signed at time t.
+func presign(c *C, signer *s3.V4Signer, method, rawurl string, t time.Time, expires int) string {
+	req, err := http.NewRequest(method, rawurl, nil)
+	c.Assert(err, IsNil)
+	req.Form = req.URL.Query()
+	req.Form.Set("X-Amz-Expires", fmt.Sprint(expires))
+	req.Header.Set("X-Amz-Date", t.UTC().Format(s3.ISO8601BasicFormat))
+	err = signer.Sign(req, "")
+	c.Assert(err, IsNil)
+	req.URL.RawQuery = req.Form.Encode()
+	return req.URL.String()
+}
+
+func (s *S) TestVerifyPresignedRequest(c *C) {
+	signer := s3.NewV4Signer(testAuth, "s3", aws.USEast)
+	signed := presign(c, signer, "GET", "https://examplebucket.s3.amazonaws.com/test.txt", time.Now(), 3600)
+
+	req, err := http.NewRequest("GET", signed, nil)
+	c.Assert(err, IsNil)
+	valid, expired, err := s3.VerifyPresignedRequest(req, testAuth.SecretKey)
+	c.Assert(err, IsNil)
+	c.Assert(valid, Equals, true)
+	c.Assert(expired, Equals, false)
+
+	valid, _, err = s3.VerifyPresignedRequest(req, "wrong-secret")
+	c.Assert(err, IsNil)
+	c.Assert(valid, Equals, false)
+}
+
+func (s *S) TestVerifyPresignedRequestTampered(c *C) {
+	signer := s3.NewV4Signer(testAuth, "s3", aws.USEast)
+	signed := presign(c, signer, "GET", "https://examplebucket.s3.amazonaws.com/test.txt", time.Now(), 3600)
+
+	u, err := url.Parse(signed)
+	c.Assert(err, IsNil)
+	u.Path = "/other.txt"
+	req, err := http.NewRequest("GET", u.String(), nil)
+	c.Assert(err, IsNil)
+	valid, _, err := s3.VerifyPresignedRequest(req, testAuth.SecretKey)
+	c.Assert(err, IsNil)
+	c.Assert(valid, Equals, false)
+
+	u, err = url.Parse(signed)
+	c.Assert(err, IsNil)
+	q := u.Query()
+	q.Set("X-Amz-Expires", "86400")
+	u.RawQuery = q.Encode()
+	req, err = http.NewRequest("GET", u.String(), nil)
+	c.Assert(err, IsNil)
+	valid, _, err = s3.VerifyPresignedRequest(req, testAuth.SecretKey)
+	c.Assert(err, IsNil)
+	c.Assert(valid, Equals, false)
+
+	req, err = http.NewRequest("PUT", signed, nil)
+	c.Assert(err, IsNil)
+	valid, _, err = s3.VerifyPresignedRequest(req, testAuth.SecretKey)
+	c.Assert(err, IsNil)
+	c.Assert(valid, Equals, false)
+}
+
+func (s *S) TestVerifyPresignedRequestExpired(c *C) {
+	signer := s3.NewV4Signer(testAuth, "s3", aws.USEast)
+	signed := presign(c, signer, "GET", "https://examplebucket.s3.amazonaws.com/test.txt", time.Now().Add(-2*time.Hour), 3600)
+
+	req, err := http.NewRequest("GET", signed, nil)
+	c.Assert(err, IsNil)
+	valid, expired, err := s3.VerifyPresignedRequest(req, testAuth.SecretKey)
+	c.Assert(err, IsNil)
+	c.Assert(valid, Equals, true)
+	c.Assert(expired, Equals, true)
+}
+
+func (s *S) TestVerifyPresignedRequestClock(c *C) {
+	signed := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	signer := s3.NewV4Signer(testAuth, "s3", aws.USEast)
+	u := presign(c, signer, "GET", "https://examplebucket.s3.amazonaws.com/test.txt", signed, 3600)
+
+	req, err := http.NewRequest("GET", u, nil)
+	c.Assert(err, IsNil)
+	at := func(t time.Time) func() time.Time { return func() time.Time { return t } }
+	valid, expired, err := s3.VerifyPresignedRequestAt(req, testAuth.SecretKey, at(signed.Add(time.Hour)))
+	c.Assert(err, IsNil)
+	c.Assert(valid, Equals, true)
+	c.Assert(expired, Equals, false)
+
+	valid, expired, err = s3.VerifyPresignedRequestAt(req, testAuth.SecretKey, at(signed.Add(time.Hour+time.Second)))
+	c.Assert(err, IsNil)
+	c.Assert(valid, Equals, true)
+	c.Assert(expired, Equals, true)
+}
+
+func (s *S) TestVerifyPresignedRequestMalformed(c *C) {
+	req, err := http.NewRequest("GET", "https://examplebucket.s3.amazonaws.com/test.txt", nil)
+	c.Assert(err, IsNil)
+	_, _, err = s3.VerifyPresignedRequest(req, testAuth.SecretKey)
+	c.Assert(err, ErrorMatches, "presigned request has no AWS4-HMAC-SHA256 algorithm")
+}
+
+func (s *S) TestCanonicalQueryStringSpaces(c *C) {
+	u, err := url.Parse("https://examplebucket.s3.amazonaws.com/?prefix=photos/my+trip&marker=a%2Bb%20c")
+	c.Assert(err, IsNil)
+
+	signer := s3.NewV4Signer(testAuth, "s3", aws.USEast)
+	c.Assert(s3.CanonicalQueryString(signer, u), Equals, "marker=a%2Bb%20c&prefix=photos%2Fmy%20trip")
+
+	signer.SpaceAsPlus = true
+	c.Assert(s3.CanonicalQueryString(signer, u), Equals, "marker=a%2Bb+c&prefix=photos%2Fmy+trip")
+
+	// The client option selects the encoding of the requests it signs.
+	sign := func(spaceAsPlus bool) string {
+		client := s3.New(testAuth, aws.USEast)
+		client.QuerySpaceAsPlus = spaceAsPlus
+		req, err := http.NewRequest("GET", u.String(), nil)
+		c.Assert(err, IsNil)
+		req.Header.Set("X-Amz-Date", "20130524T000000Z")
+		c.Assert(client.Sign(req, ""), IsNil)
+		return req.Header.Get("Authorization")
+	}
+	c.Assert(sign(true), Not(Equals), sign(false))
+}
+
+func (s *S) TestS3Sign(c *C) {
+	client := s3.New(testAuth, aws.USEast)
+
+	req, err := http.NewRequest("PUT", "https://examplebucket.s3.amazonaws.com/test.txt", nil)
+	c.Assert(err, IsNil)
+	req.Header.Set("X-Custom", "value")
+	payloadHash := s3.SHA256Hex([]byte("content"))
+	err = client.Sign(req, payloadHash)
+	c.Assert(err, IsNil)
+
+	c.Assert(req.Header.Get("X-Amz-Content-Sha256"), Equals, payloadHash)
+	c.Assert(req.Header.Get("X-Amz-Date"), Matches, "[0-9]{8}T[0-9]{6}Z")
+	c.Assert(req.Header.Get("Authorization"), Matches,
+		"AWS4-HMAC-SHA256 Credential=0PN5J17HBGZHT7JJ3X82/[0-9]{8}/us-east-1/s3/aws4_request, "+
+			"SignedHeaders=host;x-amz-content-sha256;x-amz-date;x-custom, "+
+			"Signature=[0-9a-f]{64}")
+}
+
+func (s *S) TestSigningService(c *C) {
+	testServer.Response(200, nil, "content")
+
+	client := s3.New(testAuth, aws.Region{Name: "us-west-2", S3Endpoint: testServer.URL, S3V4Signature: true})
+	client.SigningService = "s3-outposts"
+	_, err := client.Bucket("bucket").Get("name")
+	c.Assert(err, IsNil)
+
+	req := testServer.WaitRequest()
+	c.Assert(req.Header.Get("Authorization"), Matches,
+		"AWS4-HMAC-SHA256 Credential=0PN5J17HBGZHT7JJ3X82/[0-9]{8}/us-west-2/s3-outposts/aws4_request, .*")
+}
+
+func (s *S) TestS3SignBody(c *C) {
+	client := s3.New(testAuth, aws.USEast)
+
+	body := bytes.NewReader([]byte("content"))
+	req, err := http.NewRequest("PUT", "https://examplebucket.s3.amazonaws.com/test.txt", body)
+	c.Assert(err, IsNil)
+	req.Header.Set("X-Amz-Date", "20130524T000000Z")
+	err = client.SignBody(req, body)
+	c.Assert(err, IsNil)
+
+	payloadHash := s3.SHA256Hex([]byte("content"))
+	c.Assert(req.Header.Get("X-Amz-Content-Sha256"), Equals, payloadHash)
+
+	// The body is left in place to be sent.
+	data, err := ioutil.ReadAll(req.Body)
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "content")
+
+	// The signature is the same as with a precomputed hash.
+	expected, err := http.NewRequest("PUT", "https://examplebucket.s3.amazonaws.com/test.txt", nil)
+	c.Assert(err, IsNil)
+	expected.Header.Set("X-Amz-Date", "20130524T000000Z")
+	err = client.Sign(expected, payloadHash)
+	c.Assert(err, IsNil)
+	c.Assert(req.Header.Get("Authorization"), Equals, expected.Header.Get("Authorization"))
+}
+
+func (s *S) TestS3SignUnsignedPayload(c *C) {
+	client := s3.New(testAuth, aws.USEast)
+
+	req, err := http.NewRequest("PUT", "https://examplebucket.s3.amazonaws.com/test.txt", nil)
+	c.Assert(err, IsNil)
+	err = client.Sign(req, s3.UnsignedPayload)
+	c.Assert(err, IsNil)
+	c.Assert(req.Header.Get("X-Amz-Content-Sha256"), Equals, "UNSIGNED-PAYLOAD")
+}
+
+func (s *S) TestClockSignsDeterministically(c *C) {
+	testServer.Responses(2, 200, nil, "content")
+
+	client, _ := s.v4Client()
+	client.Auth = testAuth
+	now := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	s3.SetClock(client, func() time.Time { return now })
+
+	b := client.Bucket("bucket")
+	_, err := b.Get("name")
+	c.Assert(err, IsNil)
+	_, err = b.Get("name")
+	c.Assert(err, IsNil)
+
+	reqs := testServer.WaitRequests(2)
+	for _, req := range reqs {
+		c.Assert(req.Header.Get("Date"), Equals, "Thu, 02 Jan 2020 03:04:05 UTC")
+		c.Assert(req.Header.Get("X-Amz-Date"), Equals, "20200102T030405Z")
+		c.Assert(req.Header.Get("Authorization"), Equals,
+			"AWS4-HMAC-SHA256 Credential=0PN5J17HBGZHT7JJ3X82/20200102/faux-region-1/s3/aws4_request, "+
+				"SignedHeaders=date;host;x-amz-content-sha256;x-amz-date, "+
+				"Signature=3243eb00b1ab0c2239cb408352d98da4894e21c5dfe78ce7ef0619c6c3518d61")
+	}
+}
+
+func (s *S) TestSignerClock(c *C) {
+	signer := s3.NewV4Signer(testAuth, "s3", aws.USEast)
+	s3.SetSignerClock(signer, func() time.Time {
+		return time.Date(2020, 1, 2, 3, 4, 5, 0, time.FixedZone("CET", 3600))
+	})
+
+	req, err := http.NewRequest("GET", "https://examplebucket.s3.amazonaws.com/test.txt", nil)
+	c.Assert(err, IsNil)
+	err = signer.Sign(req, "")
+	c.Assert(err, IsNil)
+	c.Assert(req.Header.Get("X-Amz-Date"), Equals, "20200102T020405Z")
+	c.Assert(req.Header.Get("Authorization"), Matches,
+		"AWS4-HMAC-SHA256 Credential=0PN5J17HBGZHT7JJ3X82/20200102/us-east-1/s3/aws4_request, .*")
+
+	// The signed URL expiry is relative to the clock too.
+	client := s3.New(testAuth, aws.USEast)
+	now := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	s3.SetClock(client, func() time.Time { return now })
+	src := s3.NewSignedURLSource(client.Bucket("bucket"), "name", time.Hour, time.Minute)
+	src.URL()
+	c.Assert(src.Expires(), Equals, now.Add(time.Hour))
+}
+
+func (s *S) TestCanonicalRequest(c *C) {
+	// Example from the "GET Object" example of
+	// http://docs.aws.amazon.com/AmazonS3/latest/API/sig-v4-header-based-auth.html
+	header := http.Header{
+		"Range":                {"bytes=0-9"},
+		"X-Amz-Content-Sha256": {"e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"},
+		"X-Amz-Date":           {"20130524T000000Z"},
+	}
+	creq, err := s3.CanonicalRequest("GET", "https://examplebucket.s3.amazonaws.com/test.txt", header, "")
+	c.Assert(err, IsNil)
+	c.Assert(creq, Equals, `GET
+/test.txt
+
+host:examplebucket.s3.amazonaws.com
+range:bytes=0-9
+x-amz-content-sha256:e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855
+x-amz-date:20130524T000000Z
+
+host;range;x-amz-content-sha256;x-amz-date
+e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855`)
+	c.Assert(header.Get("Host"), Equals, "")
+}
+
+func (s *S) TestCanonicalRequestContentTypeParams(c *C) {
+	header := http.Header{
+		"Content-Type": {` text/plain;   charset="utf-8"  `},
+		"X-Amz-Meta-A": {"b", "a"},
+		"X-Amz-Meta-B": {"tab\there"},
+		"X-Amz-Date":   {"20130524T000000Z"},
+	}
+	creq, err := s3.CanonicalRequest("PUT", "https://examplebucket.s3.amazonaws.com/test.txt", header, "")
+	c.Assert(err, IsNil)
+	c.Assert(creq, Equals, `PUT
+/test.txt
+
+content-type:text/plain; charset="utf-8"
+host:examplebucket.s3.amazonaws.com
+x-amz-date:20130524T000000Z
+x-amz-meta-a:b,a
+x-amz-meta-b:tab	here
+
+content-type;host;x-amz-date;x-amz-meta-a;x-amz-meta-b
+e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855`)
+	// The values sent are left as they are.
+	c.Assert(header["Content-Type"], DeepEquals, []string{` text/plain;   charset="utf-8"  `})
+	c.Assert(header["X-Amz-Meta-A"], DeepEquals, []string{"b", "a"})
+}
+
+func (s *S) TestSignContentTypeParams(c *C) {
+	testServer.Response(200, nil, "")
+
+	client := s3.New(testAuth, aws.Region{Name: "faux-region-1", S3Endpoint: testServer.URL, S3V4Signature: true})
+	s3.SetClock(client, func() time.Time { return time.Date(2013, 5, 24, 0, 0, 0, 0, time.UTC) })
+	b := client.Bucket("bucket")
+	err := b.Put("name", []byte("content"), "text/plain;  charset=utf-8", s3.Private)
+	c.Assert(err, IsNil)
+
+	req := testServer.WaitRequest()
+	c.Assert(req.Header["Content-Type"], DeepEquals, []string{"text/plain;  charset=utf-8"})
+
+	// The signature is that of the value with collapsed spaces, which
+	// is what S3 computes.
+	auth := req.Header.Get("Authorization")
+	m := regexp.MustCompile(`SignedHeaders=([^,]+),`).FindStringSubmatch(auth)
+	c.Assert(m, HasLen, 2)
+	signed := http.Header{}
+	for _, name := range strings.Split(m[1], ";") {
+		if name != "host" {
+			signed[http.CanonicalHeaderKey(name)] = req.Header[http.CanonicalHeaderKey(name)]
+		}
+	}
+	c.Assert(signed["Content-Type"], NotNil)
+	signed.Set("Content-Type", "text/plain; charset=utf-8")
+	hreq, err := http.NewRequest("PUT", testServer.URL+req.URL.Path, nil)
+	c.Assert(err, IsNil)
+	hreq.Header = signed
+	signer := s3.NewV4Signer(testAuth, "s3", aws.Region{Name: "faux-region-1"})
+	c.Assert(signer.Sign(hreq, req.Header.Get("X-Amz-Content-Sha256")), IsNil)
+	c.Assert(hreq.Header.Get("Authorization"), Equals, auth)
+}
+
+func (s *S) TestSignForRegion(c *C) {
+	newReq := func() *http.Request {
+		req, err := http.NewRequest("GET", "https://examplebucket.s3.amazonaws.com/test.txt", nil)
+		c.Assert(err, IsNil)
+		req.Header.Set("x-amz-date", "20130524T000000Z")
+		return req
+	}
+	sign := func(signer *s3.V4Signer, region *aws.Region) string {
+		req := newReq()
+		if region == nil {
+			c.Assert(signer.Sign(req, ""), IsNil)
+		} else {
+			c.Assert(signer.SignForRegion(req, *region, ""), IsNil)
+		}
+		return req.Header.Get("Authorization")
+	}
+
+	signer := s3.NewV4Signer(testAuth, "s3", aws.USEast)
+	east := sign(signer, &aws.USEast)
+	west := sign(signer, &aws.EUWest)
+	c.Assert(east, Matches, `AWS4-HMAC-SHA256 Credential=0PN5J17HBGZHT7JJ3X82/20130524/us-east-1/s3/aws4_request, .*`)
+	c.Assert(west, Matches, `AWS4-HMAC-SHA256 Credential=0PN5J17HBGZHT7JJ3X82/20130524/eu-west-1/s3/aws4_request, .*`)
+
+	// The results match those of signers for each region, whichever
+	// region the signing key was cached for first.
+	c.Assert(sign(signer, nil), Equals, east)
+	c.Assert(sign(signer, &aws.EUWest), Equals, west)
+	c.Assert(sign(s3.NewV4Signer(testAuth, "s3", aws.USEast), nil), Equals, east)
+	c.Assert(sign(s3.NewV4Signer(testAuth, "s3", aws.EUWest), nil), Equals, west)
+}
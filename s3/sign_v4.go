@@ -2,12 +2,19 @@ package s3
 
 import (
 	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"net/url"
 	"path"
 	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/koofr/goamz/aws"
@@ -19,6 +26,10 @@ const (
 	ISO8601BasicFormatShort = "20060102"
 )
 
+// UnsignedPayload may be given as the payload hash to Sign to leave the
+// request body out of the signature.
+const UnsignedPayload = "UNSIGNED-PAYLOAD"
+
 /*
 The V4Signer encapsulates all of the functionality to sign a request with the AWS
 Signature Version 4 Signing Process. (http://goo.gl/u1OWZz)
@@ -27,6 +38,17 @@ type V4Signer struct {
 	auth        aws.Auth
 	serviceName string
 	region      aws.Region
+	now         func() time.Time
+
+	// SpaceAsPlus encodes spaces in the canonical query string as "+"
+	// instead of "%20", as expected by some S3-compatible stores. AWS
+	// requires "%20".
+	SpaceAsPlus bool
+
+	// keys caches the signing keys derived for keyDate, by region.
+	mu      sync.Mutex
+	keyDate string
+	keys    map[string][]byte
 }
 
 /*
@@ -37,6 +59,7 @@ func NewV4Signer(auth aws.Auth, serviceName string, region aws.Region) *V4Signer
 		auth:        auth,
 		serviceName: serviceName,
 		region:      region,
+		now:         time.Now,
 	}
 }
 
@@ -50,6 +73,19 @@ The signed request will include a new "Authorization" header indicating that the
 Any changes to the request after signing the request will invalidate the signature.
 */
 func (s *V4Signer) Sign(req *http.Request, payloadHash string) (err error) {
+	return s.sign(req, s.region.Name, payloadHash)
+}
+
+/*
+SignForRegion signs a request like Sign, but for the given region instead of the
+one the signer was created for, so that one signer may sign requests for several
+regions. The signing keys derived for each region are cached by the signer.
+*/
+func (s *V4Signer) SignForRegion(req *http.Request, region aws.Region, payloadHash string) error {
+	return s.sign(req, region.Name, payloadHash)
+}
+
+func (s *V4Signer) sign(req *http.Request, region, payloadHash string) error {
 	if payloadHash == "" {
 		payloadHash = EmptyStringSHA256Hex
 	}
@@ -60,12 +96,12 @@ func (s *V4Signer) Sign(req *http.Request, payloadHash string) (err error) {
 	if _, ok := req.Form["X-Amz-Expires"]; ok {
 		// We are authenticating the the request by using query params
 		// (also known as pre-signing a url, http://docs.aws.amazon.com/AmazonS3/latest/API/sigv4-query-string-auth.html)
-		payloadHash = "UNSIGNED-PAYLOAD"
+		payloadHash = UnsignedPayload
 		req.Header.Del("x-amz-date")
 
 		req.Form["X-Amz-SignedHeaders"] = []string{s.signedHeaders(req.Header)}
 		req.Form["X-Amz-Algorithm"] = []string{"AWS4-HMAC-SHA256"}
-		req.Form["X-Amz-Credential"] = []string{s.auth.AccessKey + "/" + s.credentialScope(t)}
+		req.Form["X-Amz-Credential"] = []string{s.auth.AccessKey + "/" + s.credentialScope(t, region)}
 		req.Form["X-Amz-Date"] = []string{t.Format(ISO8601BasicFormat)}
 		req.URL.RawQuery = req.Form.Encode()
 	} else {
@@ -75,9 +111,9 @@ func (s *V4Signer) Sign(req *http.Request, payloadHash string) (err error) {
 	if err != nil {
 		return err
 	}
-	sts := s.stringToSign(t, creq)                    // Build string to sign
-	signature := s.signature(t, sts)                  // Calculate the AWS Signature Version 4
-	auth := s.authorization(req.Header, t, signature) // Create Authorization header value
+	sts := s.stringToSign(t, region, creq)                    // Build string to sign
+	signature := s.signature(t, region, sts)                  // Calculate the AWS Signature Version 4
+	auth := s.authorization(req.Header, t, region, signature) // Create Authorization header value
 
 	if _, ok := req.Form["X-Amz-Expires"]; ok {
 		req.Form["X-Amz-Signature"] = []string{signature}
@@ -87,6 +123,70 @@ func (s *V4Signer) Sign(req *http.Request, payloadHash string) (err error) {
 	return nil
 }
 
+/*
+SignBody signs a request like Sign, computing the payload hash from body, which
+should hold the content sent as the request body. The hash is computed by reading
+body from its current offset until EOF, after which it is seeked back to that offset
+so it can be sent. A nil body signs an empty payload.
+*/
+func (s *V4Signer) SignBody(req *http.Request, body io.ReadSeeker) error {
+	payloadHash, err := payloadSHA256Hex(body)
+	if err != nil {
+		return err
+	}
+	return s.Sign(req, payloadHash)
+}
+
+// payloadSHA256Hex returns the hex encoded SHA256 hash of the content
+// of body from its current offset, leaving body at that offset.
+func payloadSHA256Hex(body io.ReadSeeker) (string, error) {
+	if body == nil {
+		return EmptyStringSHA256Hex, nil
+	}
+	offset, err := body.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, body); err != nil {
+		return "", err
+	}
+	if _, err := body.Seek(offset, io.SeekStart); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+/*
+presign adds the query parameters presigning req at time t for expires to its URL.
+The signature is computed with key, the signing key derived for t (see derivedKey),
+so that it may be reused across requests presigned at the same time. The host
+header and every header in req.Header are signed and listed in X-Amz-SignedHeaders,
+so the request must be sent with the same values for them.
+*/
+func (s *V4Signer) presign(req *http.Request, t time.Time, expires time.Duration, key []byte) error {
+	query := req.URL.Query()
+	query.Set("X-Amz-Algorithm", "AWS4-HMAC-SHA256")
+	query.Set("X-Amz-Credential", s.auth.AccessKey+"/"+s.credentialScope(t, s.region.Name))
+	query.Set("X-Amz-Date", t.Format(ISO8601BasicFormat))
+	query.Set("X-Amz-Expires", strconv.FormatInt(int64(expires/time.Second), 10))
+	h := http.Header{"host": {req.Host}}
+	for k, v := range req.Header {
+		h[strings.ToLower(k)] = v
+	}
+	query.Set("X-Amz-SignedHeaders", s.signedHeaders(h))
+	req.URL.RawQuery = query.Encode()
+	req.Header = h
+
+	creq, err := s.canonicalRequest(req, UnsignedPayload)
+	if err != nil {
+		return err
+	}
+	query.Set("X-Amz-Signature", fmt.Sprintf("%x", HMAC(key, []byte(s.stringToSign(t, s.region.Name, creq)))))
+	req.URL.RawQuery = query.Encode()
+	return nil
+}
+
 /*
 requestTime method will parse the time from the request "x-amz-date" or "date" headers.
 If the "x-amz-date" header is present, that will take priority over the "date" header.
@@ -120,7 +220,7 @@ func (s *V4Signer) requestTime(req *http.Request) time.Time {
 	}
 
 	// Create a current time header to be used
-	t = time.Now().UTC()
+	t = s.now().UTC()
 	req.Header.Set("x-amz-date", t.Format(ISO8601BasicFormat))
 	return t
 }
@@ -151,6 +251,15 @@ func (s *V4Signer) canonicalURI(u *url.URL) string {
 	u = &url.URL{Path: u.Path}
 	canonicalPath := u.String()
 
+	// S3 signs the path as sent, without normalizing it, so that keys
+	// such as "a//b" or "a/./b" can be addressed.
+	if strings.HasPrefix(s.serviceName, "s3") {
+		if canonicalPath == "" {
+			canonicalPath = "/"
+		}
+		return canonicalPath
+	}
+
 	slash := strings.HasSuffix(canonicalPath, "/")
 	canonicalPath = path.Clean(canonicalPath)
 
@@ -200,15 +309,34 @@ func (s *V4Signer) canonicalQueryString(u *url.URL) string {
 	// http://docs.aws.amazon.com/general/latest/gr/sigv4-create-canonical-request.html
 	// https://github.com/golang/go/issues/4013
 	// https://groups.google.com/forum/#!topic/golang-nuts/BB443qEjPIk
-
+	if s.SpaceAsPlus {
+		return query_str
+	}
 	return strings.Replace(query_str, "+", "%20", -1)
 }
 
+// collapseSpaces replaces each run of spaces in s with a single space.
+// Other white space is left alone.
+func collapseSpaces(s string) string {
+	if !strings.Contains(s, "  ") {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == ' ' && i > 0 && s[i-1] == ' ' {
+			continue
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
 func (s *V4Signer) canonicalHeaders(h http.Header) string {
 	i, a, lowerCase := 0, make([]string, len(h)), make(map[string][]string)
 
 	for k, v := range h {
-		lowerCase[strings.ToLower(k)] = v
+		// Copy so the values sent are left as they are.
+		lowerCase[strings.ToLower(k)] = append([]string(nil), v...)
 	}
 
 	var keys []string
@@ -220,9 +348,12 @@ func (s *V4Signer) canonicalHeaders(h http.Header) string {
 	for _, k := range keys {
 		v := lowerCase[k]
 		for j, w := range v {
-			v[j] = strings.Trim(w, " ")
+			// Leading and trailing white space is trimmed and sequential
+			// spaces are collapsed, but the value is otherwise signed as
+			// sent, parameters included. Multiple values are joined in
+			// the order they are sent, as S3 does.
+			v[j] = collapseSpaces(strings.TrimSpace(w))
 		}
-		sort.Strings(v)
 		a[i] = strings.ToLower(k) + ":" + strings.Join(v, ",")
 		i++
 	}
@@ -247,25 +378,25 @@ stringToSign method creates the string to sign accorting to Task 2 of the AWS Si
       CredentialScope + '\n' +
       HexEncode(Hash(CanonicalRequest))
 */
-func (s *V4Signer) stringToSign(t time.Time, creq string) string {
+func (s *V4Signer) stringToSign(t time.Time, region, creq string) string {
 	w := new(bytes.Buffer)
 	fmt.Fprint(w, "AWS4-HMAC-SHA256\n")
 	fmt.Fprintf(w, "%s\n", t.Format(ISO8601BasicFormat))
-	fmt.Fprintf(w, "%s\n", s.credentialScope(t))
+	fmt.Fprintf(w, "%s\n", s.credentialScope(t, region))
 	fmt.Fprintf(w, "%s", SHA256Hex([]byte(creq)))
 	return w.String()
 }
 
-func (s *V4Signer) credentialScope(t time.Time) string {
-	return fmt.Sprintf("%s/%s/%s/aws4_request", t.Format(ISO8601BasicFormatShort), s.region.Name, s.serviceName)
+func (s *V4Signer) credentialScope(t time.Time, region string) string {
+	return fmt.Sprintf("%s/%s/%s/aws4_request", t.Format(ISO8601BasicFormatShort), region, s.serviceName)
 }
 
 /*
 signature method calculates the AWS Signature Version 4 according to Task 3 of the AWS Signature Version 4 Signing Process. (http://goo.gl/j0Yqe1)
 	signature = HexEncode(HMAC(derived-signing-key, string-to-sign))
 */
-func (s *V4Signer) signature(t time.Time, sts string) string {
-	h := HMAC(s.derivedKey(t), []byte(sts))
+func (s *V4Signer) signature(t time.Time, region, sts string) string {
+	h := HMAC(s.regionKey(t, region), []byte(sts))
 	return fmt.Sprintf("%x", h)
 }
 
@@ -278,21 +409,126 @@ derivedKey method derives a signing key to be used for signing a request.
     kSigning = HMAC(kService, "aws4_request")
 */
 func (s *V4Signer) derivedKey(t time.Time) []byte {
-	h := HMAC([]byte("AWS4"+s.auth.SecretKey), []byte(t.Format(ISO8601BasicFormatShort)))
-	h = HMAC(h, []byte(s.region.Name))
+	return s.regionKey(t, s.region.Name)
+}
+
+/*
+regionKey method returns the signing key for the given region, deriving it only
+if it isn't cached yet for the date of t. Only the keys for the latest date are kept.
+*/
+func (s *V4Signer) regionKey(t time.Time, region string) []byte {
+	date := t.Format(ISO8601BasicFormatShort)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if date != s.keyDate {
+		s.keyDate = date
+		s.keys = make(map[string][]byte)
+	}
+	if h, ok := s.keys[region]; ok {
+		return h
+	}
+	h := HMAC([]byte("AWS4"+s.auth.SecretKey), []byte(date))
+	h = HMAC(h, []byte(region))
 	h = HMAC(h, []byte(s.serviceName))
 	h = HMAC(h, []byte("aws4_request"))
+	s.keys[region] = h
 	return h
 }
 
 /*
 authorization method generates the authorization header value.
 */
-func (s *V4Signer) authorization(header http.Header, t time.Time, signature string) string {
+func (s *V4Signer) authorization(header http.Header, t time.Time, region, signature string) string {
 	w := new(bytes.Buffer)
 	fmt.Fprint(w, "AWS4-HMAC-SHA256 ")
-	fmt.Fprintf(w, "Credential=%s/%s, ", s.auth.AccessKey, s.credentialScope(t))
+	fmt.Fprintf(w, "Credential=%s/%s, ", s.auth.AccessKey, s.credentialScope(t, region))
 	fmt.Fprintf(w, "SignedHeaders=%s, ", s.signedHeaders(header))
 	fmt.Fprintf(w, "Signature=%s", signature)
 	return w.String()
 }
+
+/*
+VerifyPresignedRequest checks the AWS Signature Version 4 query parameters of a
+presigned request (http://docs.aws.amazon.com/AmazonS3/latest/API/sigv4-query-string-auth.html)
+against the given secret key. The region and service are taken from the request's
+credential scope. It reports whether the signature matches and whether the request
+has expired according to its X-Amz-Date and X-Amz-Expires parameters. An error is
+returned if the request is not a well-formed presigned request.
+*/
+func VerifyPresignedRequest(req *http.Request, secretKey string) (valid bool, expired bool, err error) {
+	return verifyPresignedRequest(req, secretKey, time.Now)
+}
+
+// verifyPresignedRequest implements VerifyPresignedRequest, telling
+// whether the request expired by the clock now.
+func verifyPresignedRequest(req *http.Request, secretKey string, now func() time.Time) (valid bool, expired bool, err error) {
+	query := req.URL.Query()
+	if query.Get("X-Amz-Algorithm") != "AWS4-HMAC-SHA256" {
+		return false, false, errors.New("presigned request has no AWS4-HMAC-SHA256 algorithm")
+	}
+	credential := strings.Split(query.Get("X-Amz-Credential"), "/")
+	if len(credential) != 5 || credential[4] != "aws4_request" {
+		return false, false, fmt.Errorf("bad presigned request credential: %q", query.Get("X-Amz-Credential"))
+	}
+	t, err := time.Parse(ISO8601BasicFormat, query.Get("X-Amz-Date"))
+	if err != nil {
+		return false, false, fmt.Errorf("bad presigned request date: %v", err)
+	}
+	expires, err := strconv.ParseInt(query.Get("X-Amz-Expires"), 10, 64)
+	if err != nil {
+		return false, false, fmt.Errorf("bad presigned request expiration: %v", err)
+	}
+	signature := query.Get("X-Amz-Signature")
+	query.Del("X-Amz-Signature")
+
+	// Rebuild the request as it looked when it was signed.
+	u := *req.URL
+	u.RawQuery = query.Encode()
+	sreq := &http.Request{Method: req.Method, URL: &u, Host: req.Host, Header: make(http.Header)}
+	for _, h := range strings.Split(query.Get("X-Amz-SignedHeaders"), ";") {
+		if h == "host" {
+			sreq.Header.Set("host", req.Host)
+		} else if v, ok := req.Header[http.CanonicalHeaderKey(h)]; ok {
+			sreq.Header[h] = append([]string(nil), v...)
+		}
+	}
+
+	s := NewV4Signer(aws.Auth{AccessKey: credential[0], SecretKey: secretKey}, credential[3], aws.Region{Name: credential[2]})
+	s.now = now
+	creq, err := s.canonicalRequest(sreq, UnsignedPayload)
+	if err != nil {
+		return false, false, err
+	}
+	expected := s.signature(t, credential[2], s.stringToSign(t, credential[2], creq))
+	valid = hmac.Equal([]byte(expected), []byte(signature)) && credential[1] == t.Format(ISO8601BasicFormatShort)
+	expired = s.now().After(t.Add(time.Duration(expires) * time.Second))
+	return valid, expired, nil
+}
+
+/*
+CanonicalRequest returns the canonical request that V4Signer computes, according to
+Task 1 of the AWS Signature Version 4 Signing Process (http://goo.gl/eUUZ3S), for a
+method request to rawurl with the given headers and payload hash. It allows comparing
+the canonical request of a request with the one AWS reports in SignatureDoesNotMatch
+errors. The headers should be the ones signed; the host header is added from rawurl
+if it is missing. As with Sign, an empty payloadHash stands for an empty payload.
+*/
+func CanonicalRequest(method, rawurl string, header http.Header, payloadHash string) (string, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return "", err
+	}
+	if payloadHash == "" {
+		payloadHash = EmptyStringSHA256Hex
+	}
+	// Copy so that the host header isn't added to header.
+	h := make(http.Header, len(header)+1)
+	for k, v := range header {
+		h[k] = v
+	}
+	if h.Get("host") == "" {
+		h.Set("host", u.Host)
+	}
+	req := &http.Request{Method: method, URL: u, Header: h}
+	return (&V4Signer{serviceName: "s3"}).canonicalRequest(req, payloadHash)
+}
@@ -0,0 +1,191 @@
+package s3
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// SignedURLSource hands out signed URLs for an object, as returned by
+// SignedURL, reusing the last URL until it is about to expire. It saves
+// re-signing on every call while never handing out an expired URL.
+//
+// A SignedURLSource is safe for concurrent use.
+type SignedURLSource struct {
+	bucket  *Bucket
+	path    string
+	expiry  time.Duration
+	refresh time.Duration
+	now     func() time.Time
+
+	mu      sync.Mutex
+	url     string
+	expires time.Time
+}
+
+// NewSignedURLSource returns a SignedURLSource for the object at path in b.
+// Each URL it signs is valid for expiry, and a new one is signed once the
+// last one expires within refresh. The refresh window should be long
+// enough for the URL to be used; it is capped to expiry.
+func NewSignedURLSource(b *Bucket, path string, expiry, refresh time.Duration) *SignedURLSource {
+	if refresh > expiry {
+		refresh = expiry
+	}
+	return &SignedURLSource{
+		bucket:  b,
+		path:    path,
+		expiry:  expiry,
+		refresh: refresh,
+		now:     b.S3.now,
+	}
+}
+
+// URL returns a signed URL for the object, valid for at least the
+// refresh window.
+func (s *SignedURLSource) URL() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	if s.url == "" || !now.Add(s.refresh).Before(s.expires) {
+		s.expires = now.Add(s.expiry)
+		s.url = s.bucket.SignedURL(s.path, s.expires)
+	}
+	return s.url
+}
+
+// Expires returns the time at which the URL last returned by URL
+// expires, or the zero time if URL wasn't called yet.
+func (s *SignedURLSource) Expires() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.expires
+}
+
+// maxPresignExpiry is the longest validity S3 accepts for URLs
+// presigned with Signature Version 4.
+const maxPresignExpiry = 7 * 24 * time.Hour
+
+func checkPresignExpiry(expires time.Duration) error {
+	if expires < time.Second || expires > maxPresignExpiry {
+		return fmt.Errorf("bad presigned URL expiry: %v (must be between 1s and %v)", expires, maxPresignExpiry)
+	}
+	return nil
+}
+
+// PresignExpiry returns the time at which a URL presigned at signTime to
+// be valid for expires stops being accepted. The signing time is sent
+// with a precision of one second, so the expiry is too.
+func PresignExpiry(signTime time.Time, expires time.Duration) time.Time {
+	return signTime.UTC().Truncate(time.Second).Add(expires.Truncate(time.Second))
+}
+
+// PresignedURLExpiry returns the time at which the presigned URL rawurl
+// stops being accepted: the signing time (X-Amz-Date) plus the validity
+// (X-Amz-Expires) for URLs signed with Signature Version 4, and the
+// Expires parameter for URLs returned by SignedURL.
+func PresignedURLExpiry(rawurl string) (time.Time, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return time.Time{}, err
+	}
+	query := u.Query()
+	if expires := query.Get("Expires"); expires != "" && query.Get("X-Amz-Date") == "" {
+		sec, err := strconv.ParseInt(expires, 10, 64)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("bad signed URL expiration: %v", err)
+		}
+		return time.Unix(sec, 0).UTC(), nil
+	}
+	t, err := time.Parse(ISO8601BasicFormat, query.Get("X-Amz-Date"))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("bad presigned URL date: %v", err)
+	}
+	expires, err := strconv.ParseInt(query.Get("X-Amz-Expires"), 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("bad presigned URL expiration: %v", err)
+	}
+	return PresignExpiry(t, time.Duration(expires)*time.Second), nil
+}
+
+// PresignURL returns a URL presigned with Signature Version 4 that allows
+// anyone holding it to send a method request for the object at path in b.
+// The query parameters in params, such as versionId, partNumber or
+// response-* overrides, are added to the URL and covered by the
+// signature, so they can't be altered. Overrides of response headers
+// include response-content-type, response-content-disposition and
+// response-expires, among others. The URL is valid for expires, which
+// must be at most seven days.
+func (b *Bucket) PresignURL(method, path string, params url.Values, expires time.Duration) (string, error) {
+	return b.PresignURLWithHeaders(method, path, params, nil, expires)
+}
+
+// PresignURLWithHeaders is like PresignURL, but the signature also
+// covers headers, which requests sent to the URL must carry with the
+// same values. This gives the URL conditional semantics with headers
+// such as If-None-Match or If-Modified-Since.
+func (b *Bucket) PresignURLWithHeaders(method, path string, params url.Values, headers http.Header, expires time.Duration) (string, error) {
+	if err := checkPresignExpiry(expires); err != nil {
+		return "", err
+	}
+	signer := b.S3.signer(b.Name)
+	t := b.S3.now().UTC()
+	return b.presignURL(signer, t, signer.derivedKey(t), method, path, params, headers, expires)
+}
+
+// PresignURLs returns URLs presigned with Signature Version 4 that allow
+// anyone holding them to retrieve the objects at paths in b, in the same
+// order. All of them are valid for expires, which must be at most seven
+// days. As the URLs share their signing time, the signing key is derived
+// only once, which makes presigning many URLs at once cheaper than
+// presigning them one at a time.
+func (b *Bucket) PresignURLs(paths []string, expires time.Duration) ([]string, error) {
+	if err := checkPresignExpiry(expires); err != nil {
+		return nil, err
+	}
+	signer := b.S3.signer(b.Name)
+	t := b.S3.now().UTC()
+	key := signer.derivedKey(t)
+	urls := make([]string, len(paths))
+	for i, path := range paths {
+		u, err := b.presignURL(signer, t, key, "GET", path, nil, nil, expires)
+		if err != nil {
+			return nil, err
+		}
+		urls[i] = u
+	}
+	return urls, nil
+}
+
+// presignURL presigns a method request for path with the query
+// parameters in params and the headers in headers using signer, the
+// signing time t and the signing key derived for it.
+func (b *Bucket) presignURL(signer *V4Signer, t time.Time, key []byte, method, path string, params url.Values, headers http.Header, expires time.Duration) (string, error) {
+	req := &request{
+		method: method,
+		bucket: b.Name,
+		path:   path,
+		params: params,
+	}
+	err := b.S3.prepare(req)
+	if err != nil {
+		return "", err
+	}
+	u, err := req.url()
+	if err != nil {
+		return "", err
+	}
+	hreq := &http.Request{
+		Method: req.method,
+		URL:    u,
+		Host:   req.headers.Get("Host"),
+		Header: headers,
+	}
+	err = signer.presign(hreq, t, expires, key)
+	if err != nil {
+		return "", err
+	}
+	return hreq.URL.String(), nil
+}
@@ -0,0 +1,187 @@
+package s3_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/koofr/goamz/aws"
+	"github.com/koofr/goamz/s3"
+)
+
+func (s *S) TestSignedURLSource(c *C) {
+	now := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	src := s3.NewSignedURLSource(s.s3.Bucket("bucket"), "name", time.Hour, 10*time.Minute)
+	s3.SetSignedURLSourceClock(src, func() time.Time { return now })
+
+	expires := func(rawurl string) time.Time {
+		u, err := url.Parse(rawurl)
+		c.Assert(err, IsNil)
+		n, err := strconv.ParseInt(u.Query().Get("Expires"), 10, 64)
+		c.Assert(err, IsNil)
+		return time.Unix(n, 0).UTC()
+	}
+
+	c.Assert(src.Expires().IsZero(), Equals, true)
+	first := src.URL()
+	c.Assert(expires(first), Equals, now.Add(time.Hour))
+	c.Assert(src.Expires(), Equals, now.Add(time.Hour))
+
+	// Outside the refresh window the URL is reused.
+	now = now.Add(49 * time.Minute)
+	c.Assert(src.URL(), Equals, first)
+
+	// Within the refresh window a new URL is signed.
+	now = now.Add(time.Minute)
+	second := src.URL()
+	c.Assert(second, Not(Equals), first)
+	c.Assert(expires(second), Equals, now.Add(time.Hour))
+	c.Assert(src.URL(), Equals, second)
+}
+
+func (s *S) TestPresignURLs(c *C) {
+	client := s3.New(testAuth, aws.EUWest)
+	b := client.Bucket("gallery")
+
+	paths := []string{"a.jpg", "photos/b c.jpg", "photos/ü.png"}
+	urls, err := b.PresignURLs(paths, time.Hour)
+	c.Assert(err, IsNil)
+	c.Assert(urls, HasLen, len(paths))
+	for i, u := range urls {
+		req, err := http.NewRequest("GET", u, nil)
+		c.Assert(err, IsNil)
+		c.Assert(req.URL.Path, Equals, "/gallery/"+paths[i])
+		c.Assert(req.URL.Query().Get("X-Amz-Expires"), Equals, "3600")
+		valid, expired, err := s3.VerifyPresignedRequest(req, testAuth.SecretKey)
+		c.Assert(err, IsNil)
+		c.Assert(valid, Equals, true, Commentf("%s", u))
+		c.Assert(expired, Equals, false)
+	}
+
+	_, err = b.PresignURLs(paths, 8*24*time.Hour)
+	c.Assert(err, ErrorMatches, "bad presigned URL expiry: .*")
+}
+
+func (s *S) TestPresignURLParams(c *C) {
+	b := s3.New(testAuth, aws.EUWest).Bucket("gallery")
+
+	params := url.Values{
+		"versionId":                    {"3HL4kqtJlcpXroDTDmJ+rmSpXd3dIbrHY"},
+		"response-content-disposition": {`attachment; filename="a.jpg"`},
+	}
+	u, err := b.PresignURL("GET", "a.jpg", params, time.Hour)
+	c.Assert(err, IsNil)
+
+	req, err := http.NewRequest("GET", u, nil)
+	c.Assert(err, IsNil)
+	c.Assert(req.URL.Path, Equals, "/gallery/a.jpg")
+	c.Assert(req.URL.Query().Get("versionId"), Equals, "3HL4kqtJlcpXroDTDmJ+rmSpXd3dIbrHY")
+	c.Assert(req.URL.Query().Get("response-content-disposition"), Equals, `attachment; filename="a.jpg"`)
+	valid, _, err := s3.VerifyPresignedRequest(req, testAuth.SecretKey)
+	c.Assert(err, IsNil)
+	c.Assert(valid, Equals, true)
+
+	// The version is covered by the signature.
+	query := req.URL.Query()
+	query.Set("versionId", "other")
+	req.URL.RawQuery = query.Encode()
+	valid, _, err = s3.VerifyPresignedRequest(req, testAuth.SecretKey)
+	c.Assert(err, IsNil)
+	c.Assert(valid, Equals, false)
+
+	// So is the method.
+	req, err = http.NewRequest("PUT", u, nil)
+	c.Assert(err, IsNil)
+	valid, _, err = s3.VerifyPresignedRequest(req, testAuth.SecretKey)
+	c.Assert(err, IsNil)
+	c.Assert(valid, Equals, false)
+}
+
+func (s *S) TestPresignURLWithHeaders(c *C) {
+	b := s3.New(testAuth, aws.EUWest).Bucket("gallery")
+
+	params := url.Values{"response-expires": {"Thu, 01 Dec 2030 16:00:00 GMT"}}
+	headers := http.Header{
+		"If-None-Match":     {`"9b2cf535f27731c974343645a3985328"`},
+		"If-Modified-Since": {"Wed, 01 Jan 2025 00:00:00 GMT"},
+	}
+	u, err := b.PresignURLWithHeaders("GET", "a.jpg", params, headers, time.Hour)
+	c.Assert(err, IsNil)
+
+	req, err := http.NewRequest("GET", u, nil)
+	c.Assert(err, IsNil)
+	c.Assert(req.URL.Query().Get("response-expires"), Equals, "Thu, 01 Dec 2030 16:00:00 GMT")
+	c.Assert(req.URL.Query().Get("X-Amz-SignedHeaders"), Equals, "host;if-modified-since;if-none-match")
+	for k, v := range headers {
+		req.Header[k] = v
+	}
+	valid, _, err := s3.VerifyPresignedRequest(req, testAuth.SecretKey)
+	c.Assert(err, IsNil)
+	c.Assert(valid, Equals, true)
+
+	// The headers are covered by the signature.
+	req.Header.Set("If-None-Match", `"other"`)
+	valid, _, err = s3.VerifyPresignedRequest(req, testAuth.SecretKey)
+	c.Assert(err, IsNil)
+	c.Assert(valid, Equals, false)
+	req.Header.Del("If-None-Match")
+	valid, _, err = s3.VerifyPresignedRequest(req, testAuth.SecretKey)
+	c.Assert(err, IsNil)
+	c.Assert(valid, Equals, false)
+
+	// So is the response-expires override.
+	req.Header = headers
+	valid, _, err = s3.VerifyPresignedRequest(req, testAuth.SecretKey)
+	c.Assert(err, IsNil)
+	c.Assert(valid, Equals, true)
+	query := req.URL.Query()
+	query.Set("response-expires", "Fri, 01 Dec 2040 16:00:00 GMT")
+	req.URL.RawQuery = query.Encode()
+	valid, _, err = s3.VerifyPresignedRequest(req, testAuth.SecretKey)
+	c.Assert(err, IsNil)
+	c.Assert(valid, Equals, false)
+}
+
+func (s *S) TestPresignedURLExpiry(c *C) {
+	now := time.Date(2025, 3, 1, 12, 0, 0, 500e6, time.UTC)
+	client := s3.New(testAuth, aws.EUWest)
+	s3.SetClock(client, func() time.Time { return now })
+	b := client.Bucket("gallery")
+
+	expiry := s3.PresignExpiry(now, 90*time.Minute)
+	c.Assert(expiry, Equals, time.Date(2025, 3, 1, 13, 30, 0, 0, time.UTC))
+
+	u, err := b.PresignURL("GET", "a.jpg", nil, 90*time.Minute)
+	c.Assert(err, IsNil)
+	parsed, err := s3.PresignedURLExpiry(u)
+	c.Assert(err, IsNil)
+	c.Assert(parsed, Equals, expiry)
+
+	parsed, err = s3.PresignedURLExpiry(b.SignedURL("a.jpg", time.Date(2025, 3, 2, 0, 0, 0, 0, time.UTC)))
+	c.Assert(err, IsNil)
+	c.Assert(parsed, Equals, time.Date(2025, 3, 2, 0, 0, 0, 0, time.UTC))
+
+	_, err = s3.PresignedURLExpiry("https://s3-eu-west-1.amazonaws.com/gallery/a.jpg")
+	c.Assert(err, ErrorMatches, "bad presigned URL date: .*")
+	_, err = s3.PresignedURLExpiry("https://s3-eu-west-1.amazonaws.com/gallery/a.jpg?X-Amz-Date=20250301T120000Z")
+	c.Assert(err, ErrorMatches, "bad presigned URL expiration: .*")
+}
+
+func (s *S) BenchmarkPresignURLs(c *C) {
+	b := s3.New(testAuth, aws.EUWest).Bucket("gallery")
+	paths := make([]string, 100)
+	for i := range paths {
+		paths[i] = fmt.Sprintf("photos/%d.jpg", i)
+	}
+	c.ResetTimer()
+	for i := 0; i < c.N; i++ {
+		_, err := b.PresignURLs(paths, time.Hour)
+		if err != nil {
+			c.Fatal(err)
+		}
+	}
+}
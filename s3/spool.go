@@ -0,0 +1,128 @@
+package s3
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+// SpooledReader holds a copy of the data read from a non-seekable
+// reader so that it may be read again, for example to retry a failed
+// upload. Up to a threshold of bytes are kept in memory; larger data
+// is spilled to a temporary file, which is removed by Close.
+type SpooledReader struct {
+	io.ReadSeeker
+	file      *os.File
+	size      int64
+	md5b64    string
+	sha256hex string
+}
+
+// Spool reads r until EOF and returns a SpooledReader holding its data.
+// If r holds more than threshold bytes, the data is written to a
+// temporary file instead of being kept in memory. The MD5 and SHA256
+// hashes of the data are computed while reading it.
+// It is the caller's responsibility to call Close on the returned
+// reader when it is no longer needed.
+func Spool(r io.Reader, threshold int64) (*SpooledReader, error) {
+	md5h := md5.New()
+	sha256h := sha256.New()
+	tee := io.TeeReader(r, io.MultiWriter(md5h, sha256h))
+
+	s := &SpooledReader{}
+	var buf bytes.Buffer
+	n, err := io.CopyN(&buf, tee, threshold+1)
+	if err == io.EOF {
+		s.ReadSeeker = bytes.NewReader(buf.Bytes())
+		s.size = n
+	} else if err != nil {
+		return nil, err
+	} else {
+		s.file, err = ioutil.TempFile("", "goamz-spool-")
+		if err != nil {
+			return nil, err
+		}
+		m, err := io.Copy(s.file, io.MultiReader(&buf, tee))
+		if err == nil {
+			_, err = s.file.Seek(0, 0)
+		}
+		if err != nil {
+			s.Close()
+			return nil, err
+		}
+		s.ReadSeeker = s.file
+		s.size = m
+	}
+	s.md5b64 = base64.StdEncoding.EncodeToString(md5h.Sum(nil))
+	s.sha256hex = fmt.Sprintf("%x", sha256h.Sum(nil))
+	return s, nil
+}
+
+// Size returns the number of bytes held by s.
+func (s *SpooledReader) Size() int64 {
+	return s.size
+}
+
+// MD5B64 returns the base64 encoded MD5 hash of the data held by s.
+func (s *SpooledReader) MD5B64() string {
+	return s.md5b64
+}
+
+// SHA256Hex returns the hex encoded SHA256 hash of the data held by s.
+func (s *SpooledReader) SHA256Hex() string {
+	return s.sha256hex
+}
+
+// Close releases the resources held by s, removing its temporary file
+// if the data was spilled to disk.
+func (s *SpooledReader) Close() error {
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	if rerr := os.Remove(s.file.Name()); err == nil {
+		err = rerr
+	}
+	s.file = nil
+	return err
+}
+
+// PutReaderSpooled inserts an object into the S3 bucket by consuming
+// data from r until EOF. As r need not be seekable, its data is first
+// spooled (see Spool) so that failed uploads can be retried.
+func (b *Bucket) PutReaderSpooled(path string, r io.Reader, contType string, perm ACL, threshold int64) error {
+	s, err := Spool(r, threshold)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	for attempt := b.S3.startAttempts(); attempt.Next(); {
+		_, err := s.Seek(0, 0)
+		if err != nil {
+			return err
+		}
+		err = b.PutReader(path, s, s.Size(), contType, perm, s.MD5B64(), s.SHA256Hex())
+		if b.S3.shouldRetry("PUT", err) && attempt.HasNext() {
+			continue
+		}
+		return err
+	}
+	panic("unreachable")
+}
+
+// PutPartSpooled sends part n of the multipart upload, reading all the
+// content from r until EOF. As r need not be seekable, its data is first
+// spooled (see Spool) so that failed uploads can be retried.
+func (m *Multi) PutPartSpooled(n int, r io.Reader, threshold int64) (Part, error) {
+	s, err := Spool(r, threshold)
+	if err != nil {
+		return Part{}, err
+	}
+	defer s.Close()
+	return m.PutPartHash(n, s, s.Size(), s.MD5B64(), s.SHA256Hex())
+}
@@ -0,0 +1,109 @@
+package s3_test
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/koofr/goamz/s3"
+)
+
+func (s *S) TestSpoolInMemory(c *C) {
+	payload := []byte("content")
+	sp, err := s3.Spool(bytes.NewReader(payload), 1024)
+	c.Assert(err, IsNil)
+	defer sp.Close()
+
+	c.Assert(s3.SpoolFileName(sp), Equals, "")
+	c.Assert(sp.Size(), Equals, int64(len(payload)))
+	c.Assert(sp.MD5B64(), Equals, s3.MD5B64(payload))
+	c.Assert(sp.SHA256Hex(), Equals, s3.SHA256Hex(payload))
+	c.Assert(readAll(sp), Equals, "content")
+}
+
+func (s *S) TestSpoolToFile(c *C) {
+	payload := []byte("content")
+	sp, err := s3.Spool(bytes.NewReader(payload), 3)
+	c.Assert(err, IsNil)
+
+	name := s3.SpoolFileName(sp)
+	c.Assert(name, Not(Equals), "")
+	c.Assert(sp.Size(), Equals, int64(len(payload)))
+	c.Assert(sp.MD5B64(), Equals, s3.MD5B64(payload))
+	c.Assert(sp.SHA256Hex(), Equals, s3.SHA256Hex(payload))
+	c.Assert(readAll(sp), Equals, "content")
+
+	_, err = sp.Seek(0, 0)
+	c.Assert(err, IsNil)
+	c.Assert(readAll(sp), Equals, "content")
+
+	err = sp.Close()
+	c.Assert(err, IsNil)
+	_, err = os.Stat(name)
+	c.Assert(os.IsNotExist(err), Equals, true)
+}
+
+func (s *S) TestPutReaderSpooledRetry(c *C) {
+	testServer.Response(500, nil, InternalErrorDump)
+	testServer.Response(200, nil, "")
+
+	pr, pw := io.Pipe()
+	go func() {
+		pw.Write([]byte("content"))
+		pw.Close()
+	}()
+
+	b := s.s3.Bucket("bucket")
+	err := b.PutReaderSpooled("name", pr, "content-type", s3.Private, 3)
+	c.Assert(err, IsNil)
+
+	for i := 0; i < 2; i++ {
+		req := testServer.WaitRequest()
+		c.Assert(req.Method, Equals, "PUT")
+		c.Assert(req.URL.Path, Equals, "/bucket/name")
+		c.Assert(req.Header["Content-Length"], DeepEquals, []string{"7"})
+		data, err := ioutil.ReadAll(req.Body)
+		c.Assert(err, IsNil)
+		c.Assert(string(data), Equals, "content")
+	}
+}
+
+func (s *S) TestPutPartSpooled(c *C) {
+	headers := map[string]string{
+		"ETag": `"26f90efd10d614f100252ff56d88dad8"`,
+	}
+	testServer.Response(200, nil, InitMultiResultDump)
+	testServer.Response(500, nil, InternalErrorDump)
+	testServer.Response(200, headers, "")
+
+	b := s.s3.Bucket("sample")
+
+	multi, err := b.InitMulti("multi", "text/plain", s3.Private)
+	c.Assert(err, IsNil)
+
+	pr, pw := io.Pipe()
+	go func() {
+		pw.Write([]byte("<part 1>"))
+		pw.Close()
+	}()
+
+	part, err := multi.PutPartSpooled(1, pr, 0)
+	c.Assert(err, IsNil)
+	c.Assert(part.N, Equals, 1)
+	c.Assert(part.Size, Equals, int64(8))
+	c.Assert(part.ETag, Equals, headers["ETag"])
+
+	testServer.WaitRequest()
+	for i := 0; i < 2; i++ {
+		req := testServer.WaitRequest()
+		c.Assert(req.Method, Equals, "PUT")
+		c.Assert(req.Form["partNumber"], DeepEquals, []string{"1"})
+		c.Assert(req.Header["Content-Md5"], DeepEquals, []string{"JvkO/RDWFPEAJS/1bYja2A=="})
+		data, err := ioutil.ReadAll(req.Body)
+		c.Assert(err, IsNil)
+		c.Assert(string(data), Equals, "<part 1>")
+	}
+}
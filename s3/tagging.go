@@ -0,0 +1,140 @@
+package s3
+
+import (
+	"encoding/xml"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Limits S3 puts on object tags.
+const (
+	maxTags           = 10
+	maxTagKeyLength   = 128
+	maxTagValueLength = 256
+)
+
+// ValidateTags checks that tags may be stored with an object: there
+// are at most 10 of them, keys are 1 to 128 characters long and values
+// at most 256, and both only hold letters, digits, spaces and the
+// characters + - = . _ : / @. Keys beginning with "aws:" are reserved.
+// PutTagging, uploads with Options.Tags and copies replacing tags check
+// them before sending them.
+func ValidateTags(tags map[string]string) error {
+	if len(tags) > maxTags {
+		return fmt.Errorf("s3: too many tags: %d", len(tags))
+	}
+	for k, v := range tags {
+		if n := utf8.RuneCountInString(k); n == 0 || n > maxTagKeyLength {
+			return fmt.Errorf("s3: bad tag key length: %q", k)
+		}
+		if utf8.RuneCountInString(v) > maxTagValueLength {
+			return fmt.Errorf("s3: tag value too long for key %q", k)
+		}
+		if strings.HasPrefix(k, "aws:") {
+			return fmt.Errorf("s3: reserved tag key: %q", k)
+		}
+		if !validTagString(k) {
+			return fmt.Errorf("s3: bad character in tag key %q", k)
+		}
+		if !validTagString(v) {
+			return fmt.Errorf("s3: bad character in value of tag %q", k)
+		}
+	}
+	return nil
+}
+
+// validTagString reports whether s only holds the characters allowed in
+// tag keys and values.
+func validTagString(s string) bool {
+	for _, r := range s {
+		switch {
+		case r == utf8.RuneError:
+			return false
+		case unicode.IsLetter(r), unicode.IsDigit(r):
+		case strings.ContainsRune(" +-=._:/@", r):
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+type tagging struct {
+	XMLName xml.Name `xml:"Tagging"`
+	Tags    []tag    `xml:"TagSet>Tag"`
+}
+
+type tag struct {
+	Key   string
+	Value string
+}
+
+// GetTagging returns the tags of the object at path.
+//
+// See https://docs.aws.amazon.com/AmazonS3/latest/API/API_GetObjectTagging.html for details.
+func (b *Bucket) GetTagging(path string) (map[string]string, error) {
+	req := &request{
+		bucket: b.Name,
+		path:   path,
+		params: map[string][]string{"tagging": {}},
+	}
+	for attempt := b.S3.startAttempts(); attempt.Next(); {
+		var resp tagging
+		err := b.S3.query(req, &resp)
+		if b.S3.shouldRetry(req.method, err) && attempt.HasNext() {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		tags := make(map[string]string, len(resp.Tags))
+		for _, t := range resp.Tags {
+			tags[t.Key] = t.Value
+		}
+		return tags, nil
+	}
+	panic("unreachable")
+}
+
+// PutTagging replaces the tags of the object at path with tags, after
+// checking that they are valid (see ValidateTags).
+//
+// See https://docs.aws.amazon.com/AmazonS3/latest/API/API_PutObjectTagging.html for details.
+func (b *Bucket) PutTagging(path string, tags map[string]string) error {
+	if err := ValidateTags(tags); err != nil {
+		return err
+	}
+	var config tagging
+	for k, v := range tags {
+		config.Tags = append(config.Tags, tag{k, v})
+	}
+	sort.Slice(config.Tags, func(i, j int) bool { return config.Tags[i].Key < config.Tags[j].Key })
+	data, err := xml.Marshal(&config)
+	if err != nil {
+		return err
+	}
+	headers := map[string][]string{
+		"Content-Length": {strconv.Itoa(len(data))},
+		"Content-MD5":    {MD5B64(data)},
+	}
+	req := &request{
+		method:  "PUT",
+		bucket:  b.Name,
+		path:    path,
+		params:  map[string][]string{"tagging": {}},
+		headers: headers,
+		payload: getPayload(data),
+	}
+	for attempt := b.S3.startAttempts(); attempt.Next(); {
+		err = b.S3.query(req, nil)
+		if b.S3.shouldRetry(req.method, err) && attempt.HasNext() {
+			continue
+		}
+		return err
+	}
+	panic("unreachable")
+}
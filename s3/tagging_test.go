@@ -0,0 +1,120 @@
+package s3_test
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io/ioutil"
+	"net/url"
+	"strings"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/koofr/goamz/s3"
+)
+
+// specialTags hold the characters that need encoding in the
+// x-amz-tagging header or in the tagging XML.
+var specialTags = map[string]string{
+	"a=b":      "c=d e",
+	"plus+one": "1 + 1 = 2",
+	"path":     "/a/b:c@d_e.f",
+	"ключ":     "значение ünïcødé",
+}
+
+func (s *S) TestPutTagging(c *C) {
+	testServer.Response(200, nil, "")
+
+	b := s.s3.Bucket("bucket")
+	err := b.PutTagging("name", specialTags)
+	c.Assert(err, IsNil)
+
+	req := testServer.WaitRequest()
+	c.Assert(req.Method, Equals, "PUT")
+	c.Assert(req.URL.Path, Equals, "/bucket/name")
+	c.Assert(req.Form["tagging"], DeepEquals, []string{""})
+	data, err := ioutil.ReadAll(req.Body)
+	c.Assert(err, IsNil)
+	c.Assert(req.Header.Get("Content-MD5"), Equals, s3.MD5B64(data))
+
+	var tagging struct {
+		Tags []struct{ Key, Value string } `xml:"TagSet>Tag"`
+	}
+	c.Assert(xml.Unmarshal(data, &tagging), IsNil)
+	tags := make(map[string]string)
+	for _, t := range tagging.Tags {
+		tags[t.Key] = t.Value
+	}
+	c.Assert(tags, DeepEquals, specialTags)
+}
+
+func (s *S) TestGetTagging(c *C) {
+	testServer.Response(200, nil, `<?xml version="1.0" encoding="UTF-8"?>
+<Tagging xmlns="http://s3.amazonaws.com/doc/2006-03-01/">
+  <TagSet>
+    <Tag><Key>a=b</Key><Value>c=d e</Value></Tag>
+    <Tag><Key>plus+one</Key><Value>1 + 1 = 2</Value></Tag>
+    <Tag><Key>path</Key><Value>/a/b:c@d_e.f</Value></Tag>
+    <Tag><Key>ключ</Key><Value>значение ünïcødé</Value></Tag>
+  </TagSet>
+</Tagging>`)
+
+	b := s.s3.Bucket("bucket")
+	tags, err := b.GetTagging("name")
+	c.Assert(err, IsNil)
+	c.Assert(tags, DeepEquals, specialTags)
+
+	req := testServer.WaitRequest()
+	c.Assert(req.Method, Equals, "GET")
+	c.Assert(req.Form["tagging"], DeepEquals, []string{""})
+}
+
+func (s *S) TestPutTagsHeader(c *C) {
+	testServer.Response(200, nil, "")
+
+	b := s.s3.Bucket("bucket")
+	payload := []byte("content")
+	_, err := b.PutReaderWithOptions("name", bytes.NewReader(payload), int64(len(payload)),
+		"text/plain", s3.Private, s3.MD5B64(payload), s3.SHA256Hex(payload),
+		s3.Options{Tags: specialTags})
+	c.Assert(err, IsNil)
+
+	req := testServer.WaitRequest()
+	header := req.Header.Get("x-amz-tagging")
+	c.Assert(strings.ContainsAny(header, " +/:@"), Equals, false)
+	values, err := url.ParseQuery(header)
+	c.Assert(err, IsNil)
+	tags := make(map[string]string)
+	for k, v := range values {
+		c.Assert(v, HasLen, 1)
+		tags[k] = v[0]
+	}
+	c.Assert(tags, DeepEquals, specialTags)
+}
+
+func (s *S) TestValidateTags(c *C) {
+	c.Assert(s3.ValidateTags(specialTags), IsNil)
+	c.Assert(s3.ValidateTags(nil), IsNil)
+
+	tests := []struct {
+		tags map[string]string
+		err  string
+	}{
+		{map[string]string{"a&b": "c"}, `s3: bad character in tag key "a&b"`},
+		{map[string]string{"a": "b?c"}, `s3: bad character in value of tag "a"`},
+		// Spaces are allowed, but no other white space.
+		{map[string]string{"a\tb": "c"}, `s3: bad character in tag key "a\\tb"`},
+		{map[string]string{"a b": "c\nd"}, `s3: bad character in value of tag "a b"`},
+		{map[string]string{"": "b"}, `s3: bad tag key length: ""`},
+		{map[string]string{strings.Repeat("k", 129): "b"}, `s3: bad tag key length: "k+"`},
+		{map[string]string{"a": strings.Repeat("v", 257)}, `s3: tag value too long for key "a"`},
+		{map[string]string{"aws:name": "b"}, `s3: reserved tag key: "aws:name"`},
+		{map[string]string{"0": "", "1": "", "2": "", "3": "", "4": "", "5": "", "6": "", "7": "", "8": "", "9": "", "10": ""}, `s3: too many tags: 11`},
+	}
+	for _, t := range tests {
+		c.Assert(s3.ValidateTags(t.tags), ErrorMatches, t.err)
+	}
+
+	b := s.s3.Bucket("bucket")
+	err := b.PutTagging("name", map[string]string{"a&b": "c"})
+	c.Assert(err, ErrorMatches, `s3: bad character in tag key "a&b"`)
+}
@@ -0,0 +1,121 @@
+package s3
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// http2Transport is the transport of clients with HTTP2 set. Unlike
+// the requests of other clients, theirs keep their connections open
+// for reuse.
+var http2Transport = newHTTP2Transport()
+
+func newHTTP2Transport() *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.ForceAttemptHTTP2 = true
+	return t
+}
+
+var (
+	http2Client           = &http.Client{Transport: http2Transport}
+	http2NoRedirectClient = &http.Client{
+		Transport:     http2Transport,
+		CheckRedirect: noRedirectClient.CheckRedirect,
+	}
+)
+
+// RequestTrace holds diagnostics about how a request was sent, as
+// reported to S3.OnTrace. Durations are zero for the steps that didn't
+// happen, such as the DNS lookup and connection of a request sent over
+// a reused connection.
+type RequestTrace struct {
+	Method string
+	URL    string
+	// Proto is the protocol of the response, such as "HTTP/1.1" or
+	// "HTTP/2.0". It is empty if no response was received.
+	Proto string
+	// ConnReused is true if the request was sent over a connection
+	// used by a previous request.
+	ConnReused bool
+	// DNS, Connect and TLSHandshake are the time spent looking up the
+	// host, connecting to it, and in the TLS handshake.
+	DNS          time.Duration
+	Connect      time.Duration
+	TLSHandshake time.Duration
+	// TimeToFirstByte is the time from the start of the request to the
+	// first byte of the response.
+	TimeToFirstByte time.Duration
+	// Err is the error the request failed with, if it failed before a
+	// response was received.
+	Err error
+}
+
+// traceRequest returns r with a client trace that collects a
+// RequestTrace, and a function to be called with the outcome of the
+// request that reports the trace to s3.OnTrace.
+func (s3 *S3) traceRequest(r *http.Request) (*http.Request, func(resp *http.Response, err error)) {
+	trace := RequestTrace{Method: r.Method, URL: r.URL.String()}
+	// The hooks may be called from other goroutines, some of them even
+	// after the request is done, as when a connection dialed for it is
+	// left for another request.
+	var mu sync.Mutex
+	var start, dnsStart, connectStart, tlsStart time.Time
+	since := func(t time.Time) time.Duration {
+		if t.IsZero() {
+			return 0
+		}
+		return time.Since(t)
+	}
+	record := func(f func()) {
+		mu.Lock()
+		f()
+		mu.Unlock()
+	}
+	ct := &httptrace.ClientTrace{
+		GetConn: func(string) {
+			record(func() { start = time.Now() })
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			record(func() { trace.ConnReused = info.Reused })
+		},
+		DNSStart: func(httptrace.DNSStartInfo) {
+			record(func() { dnsStart = time.Now() })
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			record(func() { trace.DNS = since(dnsStart) })
+		},
+		ConnectStart: func(string, string) {
+			record(func() {
+				if connectStart.IsZero() {
+					connectStart = time.Now()
+				}
+			})
+		},
+		ConnectDone: func(string, string, error) {
+			record(func() { trace.Connect = since(connectStart) })
+		},
+		TLSHandshakeStart: func() {
+			record(func() { tlsStart = time.Now() })
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			record(func() { trace.TLSHandshake = since(tlsStart) })
+		},
+		GotFirstResponseByte: func() {
+			record(func() { trace.TimeToFirstByte = since(start) })
+		},
+	}
+	r = r.WithContext(httptrace.WithClientTrace(r.Context(), ct))
+	return r, func(resp *http.Response, err error) {
+		mu.Lock()
+		t := trace
+		mu.Unlock()
+		if resp != nil {
+			t.Proto = resp.Proto
+		}
+		t.Err = err
+		s3.OnTrace(&t)
+	}
+}
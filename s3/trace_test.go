@@ -0,0 +1,41 @@
+package s3_test
+
+import (
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/koofr/goamz/s3"
+)
+
+func (s *S) TestOnTrace(c *C) {
+	testServer.Responses(2, 200, nil, "content")
+
+	var traces []*s3.RequestTrace
+	client := s3.New(s.s3.Auth, s.s3.Region)
+	client.HTTP2 = true
+	client.OnTrace = func(trace *s3.RequestTrace) {
+		traces = append(traces, trace)
+	}
+	b := client.Bucket("bucket")
+	for i := 0; i < 2; i++ {
+		data, err := b.Get("name")
+		c.Assert(err, IsNil)
+		c.Assert(string(data), Equals, "content")
+	}
+	testServer.WaitRequests(2)
+
+	c.Assert(traces, HasLen, 2)
+	c.Assert(traces[0].Method, Equals, "GET")
+	c.Assert(traces[0].URL, Equals, testServer.URL+"/bucket/name")
+	c.Assert(traces[0].Proto, Equals, "HTTP/1.1")
+	c.Assert(traces[0].ConnReused, Equals, false)
+	c.Assert(traces[0].Connect > 0, Equals, true)
+	c.Assert(traces[0].TimeToFirstByte > 0, Equals, true)
+	c.Assert(traces[0].Err, IsNil)
+
+	// The connection is kept for the next request.
+	c.Assert(traces[1].ConnReused, Equals, true)
+	c.Assert(traces[1].Connect, Equals, time.Duration(0))
+	c.Assert(traces[1].TimeToFirstByte > 0, Equals, true)
+}
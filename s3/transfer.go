@@ -0,0 +1,492 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// DefaultTransferPartSize is the part size used by CopyTo when
+// TransferOptions.PartSize is not set. It is the minimum size S3
+// accepts for all but the last part of a multipart upload.
+const DefaultTransferPartSize = 5 << 20
+
+// TransferOptions holds the options for CopyTo.
+type TransferOptions struct {
+	// PartSize is the size of the parts in which objects larger
+	// than it are uploaded. It defaults to DefaultTransferPartSize.
+	PartSize int64
+	// Progress, if not nil, is called after each part is transferred
+	// with the number of bytes transferred so far and the total size
+	// of the object.
+	Progress func(transferred, total int64)
+	// Resume makes CopyTo continue an unfinished multipart upload of
+	// the key in the destination bucket, if there is one. Parts that
+	// were already uploaded with the same content are not sent again,
+	// and a failed transfer leaves the upload in place so it can be
+	// resumed later.
+	Resume bool
+	// ResumeSizeOnly makes a resumed CopyTo keep the parts already
+	// uploaded whose size is right, without comparing their ETag with
+	// the MD5 sum of the content. It saves hashing the parts again, but
+	// a part with the right size and different content goes unnoticed,
+	// so the copied object is only verified against the part ETags.
+	ResumeSizeOnly bool
+}
+
+// CopyTo copies the object at key in b to the same key in dst, which
+// may belong to a different S3 client (e.g. another account or region),
+// streaming the content through the caller. Objects larger than the
+// part size are uploaded in parts, holding at most one part in memory.
+//
+// The copy is verified by comparing the ETag reported for the new object
+// with the one expected from the transferred content, and with the ETag
+// of the source object when it is the MD5 sum of the content. Sources
+// uploaded in parts of a different size can't be compared directly, so
+// for them only the transferred content and size are verified.
+//
+// The part size is checked against the limits of multipart uploads
+// before transferring anything (see PlanMultipart).
+func (b *Bucket) CopyTo(dst *Bucket, key string, perm ACL, options TransferOptions) error {
+	partSize := options.PartSize
+	if partSize <= 0 {
+		partSize = DefaultTransferPartSize
+	}
+	req := &request{
+		bucket: b.Name,
+		path:   key,
+	}
+	err := b.S3.prepare(req)
+	if err != nil {
+		return err
+	}
+	var hresp *http.Response
+	for attempt := b.S3.startAttempts(); attempt.Next(); {
+		hresp, err = b.S3.run(req)
+		if b.S3.shouldRetry(req.method, err) && attempt.HasNext() {
+			continue
+		}
+		break
+	}
+	if err != nil {
+		return err
+	}
+	defer hresp.Body.Close()
+
+	src := keyFromHeaders(key, hresp.Header)
+	if _, err := PlanMultipart(src.Size, partSize); err != nil {
+		return err
+	}
+	contType := hresp.Header.Get("Content-Type")
+	if contType == "" {
+		contType = "binary/octet-stream"
+	}
+	progress := func(n int64) {
+		if options.Progress != nil {
+			options.Progress(n, src.Size)
+		}
+	}
+	sum := md5.New()
+	r := io.TeeReader(hresp.Body, sum)
+
+	var etag, expected string
+	if src.Size <= partSize {
+		etag, expected, err = dst.transferSingle(key, r, src.Size, contType, perm)
+		if err == nil {
+			progress(src.Size)
+		}
+	} else {
+		etag, expected, err = dst.transferMulti(key, r, src.Size, contType, perm, partSize, options.Resume, options.ResumeSizeOnly, progress)
+	}
+	if err != nil {
+		return err
+	}
+
+	etag = strings.Trim(etag, `"`)
+	srcETag := strings.Trim(src.ETag, `"`)
+	if etag != expected {
+		return fmt.Errorf("s3: copy of %q not verified: got ETag %q, expected %q", key, etag, expected)
+	}
+	if !strings.Contains(srcETag, "-") && srcETag != hex.EncodeToString(sum.Sum(nil)) {
+		return fmt.Errorf("s3: copy of %q not verified: content does not match source ETag %q", key, srcETag)
+	}
+	return nil
+}
+
+// transferSingle uploads the size bytes read from r to key in a single
+// request and returns the reported and the expected ETag.
+func (b *Bucket) transferSingle(key string, r io.Reader, size int64, contType string, perm ACL) (etag, expected string, err error) {
+	data := make([]byte, size)
+	_, err = io.ReadFull(r, data)
+	if err != nil {
+		return "", "", err
+	}
+	sum := md5.Sum(data)
+	for attempt := b.S3.startAttempts(); attempt.Next(); {
+		var result *WriteResult
+		result, err = b.PutReaderWithOptions(key, bytes.NewReader(data), size, contType, perm,
+			base64.StdEncoding.EncodeToString(sum[:]), SHA256Hex(data), Options{})
+		if b.S3.shouldRetry("PUT", err) && attempt.HasNext() {
+			continue
+		}
+		if err != nil {
+			return "", "", err
+		}
+		return result.ETag, hex.EncodeToString(sum[:]), nil
+	}
+	panic("unreachable")
+}
+
+// transferMulti uploads the size bytes read from r to key in parts of
+// partSize bytes and returns the reported and the expected ETag. With
+// sizeOnly, resumed parts are checked by size only.
+func (b *Bucket) transferMulti(key string, r io.Reader, size int64, contType string, perm ACL, partSize int64, resume, sizeOnly bool, progress func(int64)) (etag, expected string, err error) {
+	var m *Multi
+	existing := map[int]Part{}
+	if resume {
+		m, err = b.Multi(key, contType, perm)
+		if err != nil {
+			return "", "", err
+		}
+		parts, err := m.ListParts()
+		if err != nil {
+			return "", "", err
+		}
+		for _, p := range parts {
+			existing[p.N] = p
+		}
+	} else {
+		m, err = b.InitMulti(key, contType, perm)
+		if err != nil {
+			return "", "", err
+		}
+		defer func() {
+			if err != nil {
+				m.Abort()
+			}
+		}()
+	}
+
+	var parts []Part
+	var sums [][]byte
+	buf := make([]byte, partSize)
+	var done int64
+	for n := 1; done < size; n++ {
+		data := buf
+		if size-done < partSize {
+			data = buf[:size-done]
+		}
+		_, err = io.ReadFull(r, data)
+		if err != nil {
+			return "", "", err
+		}
+		part, ok := existing[n]
+		ok = ok && part.Size == int64(len(data))
+		var sum []byte
+		if ok && sizeOnly {
+			sum, err = hex.DecodeString(strings.Trim(part.ETag, `"`))
+			if err != nil {
+				return "", "", fmt.Errorf("bad ETag for part %d: %q", n, part.ETag)
+			}
+		} else {
+			digest := md5.Sum(data)
+			sum = digest[:]
+			if !ok || strings.Trim(part.ETag, `"`) != hex.EncodeToString(sum) {
+				part, err = m.PutPartHash(n, bytes.NewReader(data), int64(len(data)),
+					base64.StdEncoding.EncodeToString(sum), SHA256Hex(data))
+				if err != nil {
+					return "", "", err
+				}
+			}
+		}
+		sums = append(sums, sum)
+		parts = append(parts, part)
+		done += int64(len(data))
+		progress(done)
+	}
+	result, err := m.CompleteWithResult(parts)
+	if err != nil {
+		return "", "", err
+	}
+	return result.ETag, ComputeMultipartETag(sums), nil
+}
+
+// putFilePartSize is the part size used by PutFile for files
+// larger than it.
+var putFilePartSize int64 = DefaultTransferPartSize
+
+// PutFile uploads the local file at localPath to path in b. Files larger
+// than DefaultTransferPartSize are uploaded in parts. If contType is
+// empty, the content type is guessed from the file extension or, failing
+// that, from the file content. An unfinished multipart upload is aborted
+// if the upload fails, and none is started if the file takes more than
+// MaxParts parts.
+func (b *Bucket) PutFile(path, localPath, contType string, perm ACL) (err error) {
+	f, err := os.Open(localPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	size := fi.Size()
+	if _, err := PlanMultipart(size, putFilePartSize); err != nil {
+		return err
+	}
+	if contType == "" {
+		contType, err = detectContentType(f, localPath)
+		if err != nil {
+			return err
+		}
+	}
+
+	if size <= putFilePartSize {
+		section := io.NewSectionReader(f, 0, size)
+		md5b64, sha256hex, err := hashReader(section)
+		if err != nil {
+			return err
+		}
+		for attempt := b.S3.startAttempts(); attempt.Next(); {
+			_, err = section.Seek(0, 0)
+			if err != nil {
+				return err
+			}
+			err = b.PutReader(path, section, size, contType, perm, md5b64, sha256hex)
+			if b.S3.shouldRetry("PUT", err) && attempt.HasNext() {
+				continue
+			}
+			return err
+		}
+		panic("unreachable")
+	}
+
+	m, err := b.InitMulti(path, contType, perm)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			m.Abort()
+		}
+	}()
+	parts, err := m.PutAllReaderAt(f, size, putFilePartSize)
+	if err != nil {
+		return err
+	}
+	return m.Complete(parts)
+}
+
+// detectContentType guesses the content type of the file f at path from
+// its extension, or else from its first 512 bytes.
+func detectContentType(f *os.File, path string) (string, error) {
+	if contType := mime.TypeByExtension(filepath.Ext(path)); contType != "" {
+		return contType, nil
+	}
+	buf := make([]byte, 512)
+	n, err := f.ReadAt(buf, 0)
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	return http.DetectContentType(buf[:n]), nil
+}
+
+// hashReader returns the base64 encoded MD5 and hex encoded SHA256
+// hashes of the content read from r until EOF.
+func hashReader(r io.Reader) (md5b64, sha256hex string, err error) {
+	md5h := md5.New()
+	sha256h := sha256.New()
+	_, err = io.Copy(io.MultiWriter(md5h, sha256h), r)
+	if err != nil {
+		return "", "", err
+	}
+	return base64.StdEncoding.EncodeToString(md5h.Sum(nil)), hex.EncodeToString(sha256h.Sum(nil)), nil
+}
+
+// PutParallel uploads the content read from r until EOF to path in b as
+// a multipart upload in parts of partSize bytes, sending up to
+// concurrency parts at a time. At most concurrency parts are read ahead
+// of those being sent, so memory use is bounded by concurrency*partSize
+// however slow the uploads are. The buffers holding the parts are pooled
+// and reused by later uploads with the same part size.
+//
+// If ctx is done or a part fails to upload, parts in flight are
+// abandoned, no more parts are read or sent, and the multipart upload is
+// aborted so that the parts already uploaded don't keep using storage.
+// PutParallel returns once all the goroutines it started have finished.
+//
+// The size of the content isn't known in advance, so partSize must not
+// be smaller than MinPartSize even if the content turns out to fit in a
+// single part. PutParallel checks it before starting the upload.
+func (b *Bucket) PutParallel(ctx context.Context, path string, r io.Reader, contType string, perm ACL, partSize int64, concurrency int) error {
+	if partSize < 1 {
+		return fmt.Errorf("bad part size: %d", partSize)
+	}
+	if partSize < minPartSize {
+		return fmt.Errorf("s3: part size %d is below the minimum of %d bytes", partSize, minPartSize)
+	}
+	if concurrency < 1 {
+		return fmt.Errorf("bad concurrency: %d", concurrency)
+	}
+	m, err := b.InitMulti(path, contType, perm)
+	if err != nil {
+		return err
+	}
+	parts, err := m.putParallel(ctx, r, partSize, concurrency)
+	if err == nil {
+		err = m.Complete(parts)
+	}
+	if err != nil {
+		m.Abort()
+		return err
+	}
+	return nil
+}
+
+// poolPartBuffers is whether PutParallel keeps the buffers of parts in
+// partBuffers. Tests disable it to measure what the pool saves.
+var poolPartBuffers = true
+
+// partBuffers holds a *sync.Pool of the buffers of the parts read by
+// PutParallel for each part size, so that uploads reuse the buffers of
+// earlier ones instead of allocating their own.
+var partBuffers sync.Map
+
+// getPartBuffer returns a buffer of size bytes from the pool, or a new
+// one if the pool has none.
+func getPartBuffer(size int64) []byte {
+	if p, ok := partBuffers.Load(size); ok && poolPartBuffers {
+		if buf, ok := p.(*sync.Pool).Get().(*[]byte); ok {
+			return *buf
+		}
+	}
+	return make([]byte, size)
+}
+
+// putPartBuffer returns buf, which must have been obtained from
+// getPartBuffer, to the pool.
+func putPartBuffer(buf []byte) {
+	if !poolPartBuffers {
+		return
+	}
+	buf = buf[:cap(buf)]
+	p, _ := partBuffers.LoadOrStore(int64(len(buf)), new(sync.Pool))
+	p.(*sync.Pool).Put(&buf)
+}
+
+// putParallel uploads the content read from r as parts of m, as
+// described in PutParallel, and returns them ordered by part number.
+func (m *Multi) putParallel(ctx context.Context, r io.Reader, partSize int64, concurrency int) ([]Part, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type chunk struct {
+		n    int
+		data []byte
+	}
+	// Each buffer holds a part being read or sent, so that no more
+	// than concurrency parts are in memory at once. They are taken
+	// from the pool on first use and returned to it at the end.
+	bufs := make(chan []byte, concurrency)
+	for i := 0; i < concurrency; i++ {
+		bufs <- nil
+	}
+	chunks := make(chan chunk)
+
+	var mu sync.Mutex
+	var parts partSlice
+	var failure error
+	fail := func(err error) {
+		mu.Lock()
+		if failure == nil {
+			failure = err
+			cancel()
+		}
+		mu.Unlock()
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for c := range chunks {
+				sum := md5.Sum(c.data)
+				part, err := m.PutPartHashContext(ctx, c.n, bytes.NewReader(c.data), int64(len(c.data)),
+					base64.StdEncoding.EncodeToString(sum[:]), SHA256Hex(c.data))
+				bufs <- c.data
+				if err != nil {
+					fail(err)
+					continue
+				}
+				mu.Lock()
+				parts = append(parts, part)
+				mu.Unlock()
+			}
+		}()
+	}
+
+	// buf is the buffer taken by the reader and not yet handed to a
+	// worker.
+	var buf []byte
+read:
+	for n := 1; ; n++ {
+		select {
+		case buf = <-bufs:
+		case <-ctx.Done():
+			break read
+		}
+		if buf == nil {
+			buf = getPartBuffer(partSize)
+		}
+		k, err := io.ReadFull(r, buf[:partSize])
+		if err == io.EOF && n > 1 {
+			break
+		}
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			fail(err)
+			break
+		}
+		select {
+		case chunks <- chunk{n, buf[:k]}:
+			buf = nil
+		case <-ctx.Done():
+			break read
+		}
+		if int64(k) < partSize {
+			break
+		}
+	}
+	close(chunks)
+	wg.Wait()
+	if buf != nil {
+		putPartBuffer(buf)
+	}
+	for len(bufs) > 0 {
+		if buf := <-bufs; buf != nil {
+			putPartBuffer(buf)
+		}
+	}
+
+	if failure != nil {
+		return nil, failure
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	sort.Sort(parts)
+	return parts, nil
+}
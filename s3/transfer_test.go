@@ -0,0 +1,365 @@
+package s3_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	. "gopkg.in/check.v1"
+
+	"github.com/koofr/goamz/s3"
+)
+
+// TransferSuite runs CopyTo between two separate s3test servers.
+type TransferSuite struct {
+	src, dst LocalServer
+}
+
+var _ = Suite(&TransferSuite{})
+
+func (s *TransferSuite) SetUpTest(c *C) {
+	s.src.SetUp(c)
+	s.dst.SetUp(c)
+	// Parts of a few bytes keep the tests small.
+	s3.SetMinPartSize(1)
+}
+
+func (s *TransferSuite) TearDownTest(c *C) {
+	s3.SetMinPartSize(s3.MinPartSize)
+	s.src.srv.Quit()
+	s.dst.srv.Quit()
+}
+
+func (s *TransferSuite) buckets(c *C) (src, dst *s3.Bucket) {
+	src = s3.New(s.src.auth, s.src.region).Bucket("src")
+	c.Assert(src.PutBucket(s3.Private), IsNil)
+	dst = s3.New(s.dst.auth, s.dst.region).Bucket("dst")
+	c.Assert(dst.PutBucket(s3.Private), IsNil)
+	return src, dst
+}
+
+func (s *TransferSuite) TestCopyToSingle(c *C) {
+	src, dst := s.buckets(c)
+	c.Assert(src.Put("name", []byte("content"), "text/plain", s3.Private), IsNil)
+
+	var progress [][2]int64
+	err := src.CopyTo(dst, "name", s3.Private, s3.TransferOptions{
+		Progress: func(n, total int64) { progress = append(progress, [2]int64{n, total}) },
+	})
+	c.Assert(err, IsNil)
+	c.Assert(progress, DeepEquals, [][2]int64{{7, 7}})
+
+	data, err := dst.Get("name")
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "content")
+	key, err := dst.Info("name")
+	c.Assert(err, IsNil)
+	c.Assert(key.ETag, Equals, `"9a0364b9e99bb480dd25e1f0284c8555"`)
+}
+
+func (s *TransferSuite) TestCopyToMulti(c *C) {
+	src, dst := s.buckets(c)
+	c.Assert(src.Put("name", []byte("0123456789"), "text/plain", s3.Private), IsNil)
+
+	var progress []int64
+	err := src.CopyTo(dst, "name", s3.Private, s3.TransferOptions{
+		PartSize: 4,
+		Progress: func(n, total int64) {
+			c.Check(total, Equals, int64(10))
+			progress = append(progress, n)
+		},
+	})
+	c.Assert(err, IsNil)
+	c.Assert(progress, DeepEquals, []int64{4, 8, 10})
+
+	data, err := dst.Get("name")
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "0123456789")
+	key, err := dst.Info("name")
+	c.Assert(err, IsNil)
+	c.Assert(strings.HasSuffix(key.ETag, `-3"`), Equals, true)
+
+	multis, _, err := dst.ListMulti("", "")
+	c.Assert(err, IsNil)
+	c.Assert(multis, HasLen, 0)
+}
+
+func (s *TransferSuite) TestCopyToResume(c *C) {
+	src, dst := s.buckets(c)
+	c.Assert(src.Put("name", []byte("0123456789"), "text/plain", s3.Private), IsNil)
+
+	multi, err := dst.InitMulti("name", "text/plain", s3.Private)
+	c.Assert(err, IsNil)
+	part := []byte("0123")
+	_, err = multi.PutPartHash(1, bytes.NewReader(part), 4, s3.MD5B64(part), s3.SHA256Hex(part))
+	c.Assert(err, IsNil)
+	part = []byte("xxxx")
+	_, err = multi.PutPartHash(2, bytes.NewReader(part), 4, s3.MD5B64(part), s3.SHA256Hex(part))
+	c.Assert(err, IsNil)
+
+	var uploaded []string
+	dst.S3.RequestModifier = func(req *http.Request) {
+		if req.Method == "PUT" {
+			uploaded = append(uploaded, req.URL.Query().Get("partNumber"))
+		}
+	}
+	err = src.CopyTo(dst, "name", s3.Private, s3.TransferOptions{
+		PartSize: 4,
+		Resume:   true,
+	})
+	c.Assert(err, IsNil)
+	c.Assert(uploaded, DeepEquals, []string{"2", "3"})
+
+	data, err := dst.Get("name")
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "0123456789")
+}
+
+func (s *TransferSuite) TestCopyToResumeSizeOnly(c *C) {
+	src, dst := s.buckets(c)
+	c.Assert(src.Put("name", []byte("0123456789"), "text/plain", s3.Private), IsNil)
+
+	multi, err := dst.InitMulti("name", "text/plain", s3.Private)
+	c.Assert(err, IsNil)
+	for i, part := range []string{"0123", "xxxx", "x"} {
+		_, err = multi.PutPartHash(i+1, strings.NewReader(part), int64(len(part)), s3.MD5B64([]byte(part)), s3.SHA256Hex([]byte(part)))
+		c.Assert(err, IsNil)
+	}
+
+	var uploaded []string
+	dst.S3.RequestModifier = func(req *http.Request) {
+		if req.Method == "PUT" {
+			uploaded = append(uploaded, req.URL.Query().Get("partNumber"))
+		}
+	}
+	err = src.CopyTo(dst, "name", s3.Private, s3.TransferOptions{
+		PartSize:       4,
+		Resume:         true,
+		ResumeSizeOnly: true,
+	})
+	c.Assert(err, IsNil)
+	// Only the part with the wrong size is sent again, so the part
+	// with the right size but different content is kept.
+	c.Assert(uploaded, DeepEquals, []string{"3"})
+
+	data, err := dst.Get("name")
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "0123xxxx89")
+}
+
+func (s *TransferSuite) TestCopyToResumeFullHash(c *C) {
+	src, dst := s.buckets(c)
+	c.Assert(src.Put("name", []byte("0123456789"), "text/plain", s3.Private), IsNil)
+
+	multi, err := dst.InitMulti("name", "text/plain", s3.Private)
+	c.Assert(err, IsNil)
+	for i, part := range []string{"0123", "xxxx", "89"} {
+		_, err = multi.PutPartHash(i+1, strings.NewReader(part), int64(len(part)), s3.MD5B64([]byte(part)), s3.SHA256Hex([]byte(part)))
+		c.Assert(err, IsNil)
+	}
+
+	var uploaded []string
+	dst.S3.RequestModifier = func(req *http.Request) {
+		if req.Method == "PUT" {
+			uploaded = append(uploaded, req.URL.Query().Get("partNumber"))
+		}
+	}
+	err = src.CopyTo(dst, "name", s3.Private, s3.TransferOptions{
+		PartSize: 4,
+		Resume:   true,
+	})
+	c.Assert(err, IsNil)
+	// All the parts have the right size, but the one whose content
+	// differs is sent again.
+	c.Assert(uploaded, DeepEquals, []string{"2"})
+
+	data, err := dst.Get("name")
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "0123456789")
+}
+
+func (s *TransferSuite) TestCopyToNotFound(c *C) {
+	src, dst := s.buckets(c)
+	err := src.CopyTo(dst, "missing", s3.Private, s3.TransferOptions{})
+	c.Assert(err.(*s3.Error).StatusCode, Equals, 404)
+	_, err = dst.Info("missing")
+	c.Assert(err, NotNil)
+}
+
+func (s *TransferSuite) TestPutFile(c *C) {
+	b, _ := s.buckets(c)
+	dir := c.MkDir()
+
+	path := filepath.Join(dir, "notes.txt")
+	c.Assert(ioutil.WriteFile(path, []byte("content"), 0644), IsNil)
+	c.Assert(b.PutFile("notes", path, "", s3.Private), IsNil)
+
+	resp, err := http.Get(b.URL("notes"))
+	c.Assert(err, IsNil)
+	data, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "content")
+	c.Assert(resp.Header.Get("Content-Type"), Equals, "text/plain; charset=utf-8")
+	c.Assert(resp.Header.Get("ETag"), Equals, `"9a0364b9e99bb480dd25e1f0284c8555"`)
+}
+
+func (s *TransferSuite) TestPutFileMulti(c *C) {
+	s3.SetPutFilePartSize(4)
+	defer s3.SetPutFilePartSize(s3.DefaultTransferPartSize)
+
+	b, _ := s.buckets(c)
+	path := filepath.Join(c.MkDir(), "data")
+	c.Assert(ioutil.WriteFile(path, []byte("<html>0123456789"), 0644), IsNil)
+	c.Assert(b.PutFile("data", path, "", s3.Private), IsNil)
+
+	resp, err := http.Get(b.URL("data"))
+	c.Assert(err, IsNil)
+	data, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, "<html>0123456789")
+	c.Assert(resp.Header.Get("Content-Type"), Equals, "text/html; charset=utf-8")
+	etag, err := s3.FileMultipartETag(path, 4)
+	c.Assert(err, IsNil)
+	c.Assert(resp.Header.Get("ETag"), Equals, `"`+etag+`"`)
+	c.Assert(strings.HasSuffix(etag, "-4"), Equals, true)
+
+	multis, _, err := b.ListMulti("", "")
+	c.Assert(err, IsNil)
+	c.Assert(multis, HasLen, 0)
+}
+
+func (s *TransferSuite) TestPutFileNotFound(c *C) {
+	b, _ := s.buckets(c)
+	err := b.PutFile("name", filepath.Join(c.MkDir(), "missing"), "", s3.Private)
+	c.Assert(os.IsNotExist(err), Equals, true)
+}
+
+func (s *TransferSuite) TestPutParallel(c *C) {
+	_, dst := s.buckets(c)
+	content := strings.Repeat("0123456789", 5)
+
+	err := dst.PutParallel(context.Background(), "name", strings.NewReader(content), "text/plain", s3.Private, 4, 3)
+	c.Assert(err, IsNil)
+
+	data, err := dst.Get("name")
+	c.Assert(err, IsNil)
+	c.Assert(string(data), Equals, content)
+	key, err := dst.Info("name")
+	c.Assert(err, IsNil)
+	c.Assert(strings.HasSuffix(key.ETag, `-13"`), Equals, true)
+}
+
+func (s *TransferSuite) TestPutParallelPartSize(c *C) {
+	_, dst := s.buckets(c)
+	s3.SetMinPartSize(5)
+
+	// The part size is checked before anything is read or sent.
+	r := &countingReader{r: strings.NewReader("0123456789")}
+	err := dst.PutParallel(context.Background(), "name", r, "text/plain", s3.Private, 4, 3)
+	c.Assert(err, ErrorMatches, "s3: part size 4 is below the minimum of 5 bytes")
+	c.Assert(r.n, Equals, int64(0))
+	multis, _, err := dst.ListMulti("", "")
+	c.Assert(err, IsNil)
+	c.Assert(multis, HasLen, 0)
+}
+
+func (s *TransferSuite) TestPutParallelReusesBuffers(c *C) {
+	_, dst := s.buckets(c)
+
+	// Later uploads reuse the buffers of earlier ones, so shorter
+	// parts must not carry bytes left over from longer ones.
+	for _, content := range []string{strings.Repeat("x", 50), "0123456789", "ab"} {
+		err := dst.PutParallel(context.Background(), "name", strings.NewReader(content), "text/plain", s3.Private, 4, 3)
+		c.Assert(err, IsNil)
+		data, err := dst.Get("name")
+		c.Assert(err, IsNil)
+		c.Assert(string(data), Equals, content)
+	}
+}
+
+func (s *TransferSuite) benchmarkPutParallel(c *C, pool bool) {
+	s3.SetPoolPartBuffers(pool)
+	defer s3.SetPoolPartBuffers(true)
+	_, dst := s.buckets(c)
+	content := bytes.Repeat([]byte("x"), 4<<20)
+	c.ResetTimer()
+	for i := 0; i < c.N; i++ {
+		err := dst.PutParallel(context.Background(), "name", bytes.NewReader(content), "text/plain", s3.Private, 1<<20, 4)
+		if err != nil {
+			c.Fatal(err)
+		}
+	}
+}
+
+// Run with -check.bmem to compare allocations.
+func (s *TransferSuite) BenchmarkPutParallelPooled(c *C) {
+	s.benchmarkPutParallel(c, true)
+}
+
+func (s *TransferSuite) BenchmarkPutParallelUnpooled(c *C) {
+	s.benchmarkPutParallel(c, false)
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	atomic.AddInt64(&r.n, int64(n))
+	return n, err
+}
+
+func (s *TransferSuite) TestPutParallelCancel(c *C) {
+	_, dst := s.buckets(c)
+	goroutines := runtime.NumGoroutine()
+
+	// Hold part uploads until the context is cancelled.
+	release := make(chan struct{})
+	var aborts int32
+	dst.S3.RequestModifier = func(req *http.Request) {
+		switch {
+		case req.Method == "PUT" && req.URL.Query().Get("partNumber") != "":
+			<-release
+		case req.Method == "DELETE" && req.URL.Query().Get("uploadId") != "":
+			atomic.AddInt32(&aborts, 1)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &countingReader{r: strings.NewReader(strings.Repeat("x", 100))}
+	done := make(chan error)
+	go func() {
+		done <- dst.PutParallel(ctx, "name", r, "text/plain", s3.Private, 4, 2)
+	}()
+
+	// With both uploads held, no more than two parts are read.
+	time.Sleep(100 * time.Millisecond)
+	c.Assert(atomic.LoadInt64(&r.n), Equals, int64(8))
+
+	cancel()
+	close(release)
+	c.Assert(<-done, Equals, context.Canceled)
+	c.Assert(atomic.LoadInt32(&aborts), Equals, int32(1))
+
+	multis, _, err := dst.ListMulti("", "")
+	c.Assert(err, IsNil)
+	c.Assert(multis, HasLen, 0)
+
+	for i := 0; runtime.NumGoroutine() > goroutines && i < 100; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	c.Assert(runtime.NumGoroutine() <= goroutines, Equals, true)
+}